@@ -25,6 +25,9 @@ func (handler ProxyAuthHandlerAWSDefaultIdentity) createProxy(options *CloudSecr
 	if err != nil {
 		return nil, wrapError("unable to create Secrets Manager service client", err)
 	}
+	if handler.ParameterStore {
+		return createParameterStoreProxyFromConfig(handler.Region, &awsConfig, options), nil
+	}
 	return createProxyFromConfig(handler.Region, &awsConfig, options), nil
 
 }
@@ -43,6 +46,9 @@ func (handler ProxyAuthHandlerAWSConfiguredIdentity) createProxy(options *CloudS
 	if err != nil {
 		return nil, wrapError("unable to create Secrets Manager service client", err)
 	}
+	if handler.ParameterStore {
+		return createParameterStoreProxyFromConfig(handler.Region, &awsConfig, options), nil
+	}
 	return createProxyFromConfig(handler.Region, &awsConfig, options), nil
 }
 
@@ -0,0 +1,97 @@
+package secrets
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"golang.org/x/net/context"
+	"time"
+)
+
+type AWSParameterStoreSecretsProxy struct {
+	parameterServicesClient *ssm.Client
+	cache                   *secretCache
+}
+
+func createParameterStoreProxyFromConfig(accountRegion string, awsConfig *aws.Config, options *CloudSecretsCacheOptions) CloudSecretsProxy {
+	client := ssm.NewFromConfig(*awsConfig, func(o *ssm.Options) {
+		if accountRegion != "" {
+			o.Region = accountRegion
+		}
+	})
+	cache := secretCache{
+		secrets:    make(map[string]secret),
+		maxEntries: options.MaxEntries,
+		ttl:        options.TTL,
+	}
+	return &AWSParameterStoreSecretsProxy{
+		parameterServicesClient: client,
+		cache:                   &cache,
+	}
+}
+
+func (ps *AWSParameterStoreSecretsProxy) addToCache(name string, value string) secret {
+	thisSecret := secret{
+		value:     value,
+		timeAdded: time.Now(),
+	}
+	ps.cache.secrets[name] = thisSecret
+	if len(ps.cache.secrets) > ps.cache.maxEntries {
+		ps.cache.evict()
+	}
+	return thisSecret
+}
+
+func (ps *AWSParameterStoreSecretsProxy) getSecretFromCache(ctx context.Context, name string) (secret, error) {
+	s, ok := ps.cache.secrets[name]
+	if ok && time.Now().Sub(s.timeAdded) < ps.cache.ttl {
+		return s, nil
+	}
+	resp, err := ps.parameterServicesClient.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return secret{}, wrapError("unable to retrieve parameter", err)
+	}
+	return ps.addToCache(name, aws.ToString(resp.Parameter.Value)), nil
+}
+
+// GetSecret returns the value of a parameter, decrypting SecureString parameters.
+// StringList values are returned as stored, separated by commas.
+func (ps *AWSParameterStoreSecretsProxy) GetSecret(ctx context.Context, name string) (string, error) {
+	s, err := ps.getSecretFromCache(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return s.value, nil
+}
+
+func (ps *AWSParameterStoreSecretsProxy) GetBinarySecret(ctx context.Context, name string) ([]byte, error) {
+	// Parameter Store only stores text, so this is the same value as GetSecret
+	value, err := ps.GetSecret(ctx, name)
+	return []byte(value), err
+}
+
+// GetParametersByPath returns every parameter under a hierarchy such as "/hl7/prod", including those in nested
+// hierarchies, keyed by full parameter name. The listing always comes from Parameter Store, and the values
+// it returns refresh the cache used by GetSecret.
+func (ps *AWSParameterStoreSecretsProxy) GetParametersByPath(ctx context.Context, path string) (map[string]string, error) {
+	parameters := make(map[string]string)
+	paginator := ssm.NewGetParametersByPathPaginator(ps.parameterServicesClient, &ssm.GetParametersByPathInput{
+		Path:           aws.String(path),
+		Recursive:      aws.Bool(true),
+		WithDecryption: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, wrapError("unable to retrieve parameters under "+path, err)
+		}
+		for _, parameter := range page.Parameters {
+			name := aws.ToString(parameter.Name)
+			parameters[name] = aws.ToString(parameter.Value)
+			ps.addToCache(name, parameters[name])
+		}
+	}
+	return parameters, nil
+}
@@ -0,0 +1,77 @@
+package secrets
+
+import (
+	"golang.org/x/net/context"
+	"strings"
+)
+
+// ChainedCloudSecretsProxy returns a secret from the first of its sources that has it. It only moves on to
+// the next source when a source reports that the secret does not exist; any other error, such as an
+// authentication or network failure, is returned immediately so that a broken source is never silently skipped.
+type ChainedCloudSecretsProxy struct {
+	sources []ChainedSource
+}
+
+func (handler ProxyAuthHandlerChain) createProxy(options *CloudSecretsCacheOptions) (CloudSecretsProxy, error) {
+	if len(handler.Sources) == 0 {
+		return nil, &CloudSecretsError{message: "at least one source is required"}
+	}
+	for _, source := range handler.Sources {
+		if source.Proxy == nil {
+			return nil, &CloudSecretsError{message: "source " + source.Name + " has no proxy"}
+		}
+	}
+	return &ChainedCloudSecretsProxy{sources: handler.Sources}, nil
+}
+
+func (ch *ChainedCloudSecretsProxy) getSecret(ctx context.Context, name string,
+	get func(proxy CloudSecretsProxy) error) (string, error) {
+	for _, source := range ch.sources {
+		err := get(source.Proxy)
+		if err == nil {
+			return source.Name, nil
+		}
+		// the error is classified again in case the source is a proxy from outside this package
+		if classifyError(err) != ErrNotFound {
+			return source.Name, wrapError("unable to retrieve secret "+name+" from "+source.Name, err)
+		}
+	}
+	names := make([]string, len(ch.sources))
+	for i, source := range ch.sources {
+		names[i] = source.Name
+	}
+	// not found is reported the same way the other proxies report it, so that chains can be nested
+	return "", wrapError("secret "+name+" not found in "+strings.Join(names, ", "), ErrNotFound)
+}
+
+// GetSecretWithSource returns a secret along with the name of the source that served it
+func (ch *ChainedCloudSecretsProxy) GetSecretWithSource(ctx context.Context, name string) (string, string, error) {
+	var value string
+	source, err := ch.getSecret(ctx, name, func(proxy CloudSecretsProxy) error {
+		var err error
+		value, err = proxy.GetSecret(ctx, name)
+		return err
+	})
+	return value, source, err
+}
+
+// GetBinarySecretWithSource returns a binary secret along with the name of the source that served it
+func (ch *ChainedCloudSecretsProxy) GetBinarySecretWithSource(ctx context.Context, name string) ([]byte, string, error) {
+	var value []byte
+	source, err := ch.getSecret(ctx, name, func(proxy CloudSecretsProxy) error {
+		var err error
+		value, err = proxy.GetBinarySecret(ctx, name)
+		return err
+	})
+	return value, source, err
+}
+
+func (ch *ChainedCloudSecretsProxy) GetSecret(ctx context.Context, name string) (string, error) {
+	value, _, err := ch.GetSecretWithSource(ctx, name)
+	return value, err
+}
+
+func (ch *ChainedCloudSecretsProxy) GetBinarySecret(ctx context.Context, name string) ([]byte, error) {
+	value, _, err := ch.GetBinarySecretWithSource(ctx, name)
+	return value, err
+}
@@ -0,0 +1,105 @@
+package secrets
+
+import (
+	"errors"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/smithy-go"
+	vault "github.com/hashicorp/vault/api"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io/fs"
+	"net"
+	"net/http"
+)
+
+// The errors returned by the proxies can be classified with errors.Is against these, whichever provider they came from
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrAccessDenied = errors.New("access denied")
+	ErrThrottled    = errors.New("throttled")
+	ErrTimeout      = errors.New("timeout")
+)
+
+// classifyError maps an error from a provider SDK to one of the exported errors, or returns nil if it is not one of them
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, kind := range []error{ErrNotFound, ErrAccessDenied, ErrThrottled, ErrTimeout} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	var smNotFound *smtypes.ResourceNotFoundException
+	var ssmNotFound *ssmtypes.ParameterNotFound
+	switch {
+	case errors.Is(err, vault.ErrSecretNotFound), errors.As(err, &smNotFound), errors.As(err, &ssmNotFound):
+		return ErrNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return ErrAccessDenied
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout
+	}
+	var apiError smithy.APIError
+	if errors.As(err, &apiError) {
+		switch apiError.ErrorCode() {
+		case "ParameterVersionNotFound":
+			return ErrNotFound
+		case "AccessDeniedException", "UnrecognizedClientException", "ExpiredTokenException":
+			return ErrAccessDenied
+		case "ThrottlingException", "TooManyRequestsException":
+			return ErrThrottled
+		}
+	}
+	if grpcStatus, ok := status.FromError(err); ok {
+		switch grpcStatus.Code() {
+		case codes.NotFound:
+			return ErrNotFound
+		case codes.PermissionDenied, codes.Unauthenticated:
+			return ErrAccessDenied
+		case codes.ResourceExhausted:
+			return ErrThrottled
+		case codes.DeadlineExceeded:
+			return ErrTimeout
+		}
+	}
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return ErrTimeout
+	}
+	return classifyStatusCode(statusCode(err))
+}
+
+// statusCode returns the HTTP status of a failed request, or 0 if the error did not come from a response
+func statusCode(err error) int {
+	var azureError *azcore.ResponseError
+	if errors.As(err, &azureError) {
+		return azureError.StatusCode
+	}
+	var vaultError *vault.ResponseError
+	if errors.As(err, &vaultError) {
+		return vaultError.StatusCode
+	}
+	var awsError interface{ HTTPStatusCode() int }
+	if errors.As(err, &awsError) {
+		return awsError.HTTPStatusCode()
+	}
+	return 0
+}
+
+func classifyStatusCode(code int) error {
+	switch code {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAccessDenied
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return ErrThrottled
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return ErrTimeout
+	}
+	return nil
+}
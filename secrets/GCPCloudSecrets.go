@@ -0,0 +1,153 @@
+package secrets
+
+import (
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"encoding/json"
+	"golang.org/x/net/context"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"hash/crc32"
+	"os"
+	"strings"
+	"time"
+)
+
+// SECRET_MANAGER_EMULATOR_HOST points the proxy at a plaintext, unauthenticated Secret Manager
+// fake, the same way STORAGE_EMULATOR_HOST does for Cloud Storage
+const gcp_EMULATOR_HOST_ENV = "SECRET_MANAGER_EMULATOR_HOST"
+
+// GCPCloudSecretsProxy reads secrets from Secret Manager. Call Close to close its connection.
+type GCPCloudSecretsProxy struct {
+	secretServicesClient *secretmanager.Client
+	projectID            string
+	cache                *secretCache
+}
+
+func (handler ProxyAuthHandlerGCPDefaultIdentity) createProxy(options *CloudSecretsCacheOptions) (CloudSecretsProxy, error) {
+	return createProxyFromOptions(handler.ProjectID, handler.Endpoint, options)
+}
+
+func (handler ProxyAuthHandlerGCPServiceAccountJSON) createProxy(options *CloudSecretsCacheOptions) (CloudSecretsProxy, error) {
+	projectID := handler.ProjectID
+	if projectID == "" {
+		// fall back to the project the service account belongs to
+		var serviceAccount struct {
+			ProjectID string `json:"project_id"`
+		}
+		if err := json.Unmarshal([]byte(handler.CredentialsJSON), &serviceAccount); err != nil {
+			return nil, wrapError("unable to parse service account credentials", err)
+		}
+		projectID = serviceAccount.ProjectID
+	}
+	return createProxyFromOptions(projectID, handler.Endpoint, options,
+		option.WithCredentialsJSON([]byte(handler.CredentialsJSON)))
+}
+
+func createProxyFromOptions(projectID string, endpoint string, options *CloudSecretsCacheOptions,
+	opts ...option.ClientOption) (CloudSecretsProxy, error) {
+	// the client closes a connection passed with WithGRPCConn along with its own, so the connection to the emulator
+	// only has to be closed here when the client cannot be created
+	var emulatorConn *grpc.ClientConn
+	if emulatorHost := os.Getenv(gcp_EMULATOR_HOST_ENV); emulatorHost != "" {
+		conn, err := grpc.NewClient(emulatorHost, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, wrapError("unable to connect to Secret Manager emulator", err)
+		}
+		emulatorConn = conn
+		opts = []option.ClientOption{option.WithGRPCConn(conn)}
+	} else if endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+	client, err := secretmanager.NewClient(context.Background(), opts...)
+	if err != nil {
+		if emulatorConn != nil {
+			_ = emulatorConn.Close()
+		}
+		return nil, wrapError("unable to create Secret Manager service client", err)
+	}
+	cache := secretCache{
+		secrets:    make(map[string]secret),
+		maxEntries: options.MaxEntries,
+		ttl:        options.TTL,
+	}
+	return &GCPCloudSecretsProxy{
+		secretServicesClient: client,
+		projectID:            projectID,
+		cache:                &cache,
+	}, nil
+}
+
+// Close closes the connection to Secret Manager, or to the emulator
+func (gc *GCPCloudSecretsProxy) Close() error {
+	if err := gc.secretServicesClient.Close(); err != nil {
+		return wrapError("unable to close Secret Manager service client", err)
+	}
+	return nil
+}
+
+// versionName accepts a secret ID, which resolves to the latest version in the proxy's project,
+// or a full resource name, with or without a version
+func (gc *GCPCloudSecretsProxy) versionName(name string) (string, error) {
+	if strings.HasPrefix(name, "projects/") {
+		if !strings.Contains(name, "/versions/") {
+			name += "/versions/latest"
+		}
+		return name, nil
+	}
+	if gc.projectID == "" {
+		return "", &CloudSecretsError{message: "a project ID is required to retrieve secret " + name}
+	}
+	return "projects/" + gc.projectID + "/secrets/" + name + "/versions/latest", nil
+}
+
+func (gc *GCPCloudSecretsProxy) getSecretFromCache(ctx context.Context, name string) (secret, error) {
+	s, ok := gc.cache.secrets[name]
+	if ok && time.Now().Sub(s.timeAdded) < gc.cache.ttl {
+		return s, nil
+	}
+	versionName, err := gc.versionName(name)
+	if err != nil {
+		return secret{}, err
+	}
+	resp, err := gc.secretServicesClient.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
+		Name: versionName,
+	})
+	if err != nil {
+		return secret{}, wrapError("unable to retrieve secret", err)
+	}
+	data := resp.GetPayload().GetData()
+	if checksum := resp.GetPayload().DataCrc32C; checksum != nil &&
+		int64(crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))) != *checksum {
+		return secret{}, &CloudSecretsError{message: "checksum mismatch for secret " + name}
+	}
+
+	thisSecret := secret{
+		value:     string(data),
+		binary:    data,
+		timeAdded: time.Now(),
+	}
+	gc.cache.secrets[name] = thisSecret
+	if len(gc.cache.secrets) > gc.cache.maxEntries {
+		gc.cache.evict()
+	}
+	return thisSecret, nil
+}
+
+func (gc *GCPCloudSecretsProxy) GetSecret(ctx context.Context, name string) (string, error) {
+	s, err := gc.getSecretFromCache(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return s.value, nil
+}
+
+// GetBinarySecret returns the raw payload bytes; Secret Manager stores every secret as bytes
+func (gc *GCPCloudSecretsProxy) GetBinarySecret(ctx context.Context, name string) ([]byte, error) {
+	s, err := gc.getSecretFromCache(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.binary, nil
+}
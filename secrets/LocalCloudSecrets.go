@@ -0,0 +1,177 @@
+package secrets
+
+import (
+	"errors"
+	"github.com/joho/godotenv"
+	"golang.org/x/net/context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LocalCloudSecretsProxy struct {
+	secretsDir     string
+	dotEnvFiles    []string
+	useEnvironment bool
+	envPrefix      string
+	cache          *secretCache
+	// the file each cached secret was read from, so that changes to it invalidate the cache
+	sources map[string]localSource
+	mutex   sync.Mutex
+}
+
+type localSource struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+func (handler ProxyAuthHandlerLocal) createProxy(options *CloudSecretsCacheOptions) (CloudSecretsProxy, error) {
+	if handler.SecretsDir == "" && len(handler.DotEnvFiles) == 0 && !handler.UseEnvironment {
+		return nil, &CloudSecretsError{message: "a secrets directory, dotenv files or the environment must be configured"}
+	}
+	if handler.SecretsDir != "" {
+		info, err := os.Stat(handler.SecretsDir)
+		if err != nil {
+			return nil, wrapError("unable to open secrets directory "+handler.SecretsDir, err)
+		}
+		if !info.IsDir() {
+			return nil, &CloudSecretsError{message: handler.SecretsDir + " is not a directory"}
+		}
+	}
+	cache := secretCache{
+		secrets:    make(map[string]secret),
+		maxEntries: options.MaxEntries,
+		ttl:        options.TTL,
+	}
+	return &LocalCloudSecretsProxy{
+		secretsDir:     handler.SecretsDir,
+		dotEnvFiles:    handler.DotEnvFiles,
+		useEnvironment: handler.UseEnvironment,
+		envPrefix:      handler.EnvPrefix,
+		cache:          &cache,
+		sources:        make(map[string]localSource),
+	}, nil
+}
+
+// sourceOf records the current state of a file; a source with no path is the environment, which never changes
+func sourceOf(path string) localSource {
+	info, err := os.Stat(path)
+	if err != nil {
+		return localSource{path: path}
+	}
+	return localSource{path: path, modTime: info.ModTime(), size: info.Size()}
+}
+
+func (source localSource) changed() bool {
+	return source.path != "" && sourceOf(source.path) != source
+}
+
+// envNames returns the variable names a secret is looked up by, most specific first
+func (lp *LocalCloudSecretsProxy) envNames(name string) []string {
+	upper := strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, name)
+	if upper == name {
+		return []string{lp.envPrefix + name}
+	}
+	return []string{lp.envPrefix + name, lp.envPrefix + upper}
+}
+
+func (lp *LocalCloudSecretsProxy) readSecret(name string) ([]byte, localSource, error) {
+	if lp.secretsDir != "" && fs.ValidPath(name) && !strings.HasPrefix(name, ".") {
+		// os.Stat follows the symlinks Kubernetes uses to swap in updated secrets
+		path := filepath.Join(lp.secretsDir, filepath.FromSlash(name))
+		source := sourceOf(path)
+		if content, err := os.ReadFile(path); err == nil {
+			return content, source, nil
+		} else if !errors.Is(err, fs.ErrNotExist) && !isDirError(path) {
+			return nil, source, wrapError("unable to read secret file "+path, err)
+		}
+	}
+	envNames := lp.envNames(name)
+	if lp.useEnvironment {
+		for _, envName := range envNames {
+			if value, ok := os.LookupEnv(envName); ok {
+				return []byte(value), localSource{}, nil
+			}
+		}
+	}
+	for _, dotEnvFile := range lp.dotEnvFiles {
+		source := sourceOf(dotEnvFile)
+		values, err := godotenv.Read(dotEnvFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, source, wrapError("unable to read dotenv file "+dotEnvFile, err)
+		}
+		for _, envName := range envNames {
+			if value, ok := values[envName]; ok {
+				return []byte(value), source, nil
+			}
+		}
+	}
+	return nil, localSource{}, wrapError("unable to retrieve secret "+name, ErrNotFound)
+}
+
+func isDirError(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func (lp *LocalCloudSecretsProxy) getSecretFromCache(ctx context.Context, name string) (secret, error) {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	s, ok := lp.cache.secrets[name]
+	if ok && time.Now().Sub(s.timeAdded) < lp.cache.ttl && !lp.sources[name].changed() {
+		return s, nil
+	}
+	content, source, err := lp.readSecret(name)
+	if err != nil {
+		return secret{}, err
+	}
+
+	thisSecret := secret{
+		value:     string(content),
+		binary:    content,
+		timeAdded: time.Now(),
+	}
+	lp.cache.secrets[name] = thisSecret
+	lp.sources[name] = source
+	if len(lp.cache.secrets) > lp.cache.maxEntries {
+		lp.cache.evict()
+		for cached := range lp.sources {
+			if _, ok := lp.cache.secrets[cached]; !ok {
+				delete(lp.sources, cached)
+			}
+		}
+	}
+	return thisSecret, nil
+}
+
+// GetSecret returns the content of a secret exactly as stored, including any trailing newline in a secret file
+func (lp *LocalCloudSecretsProxy) GetSecret(ctx context.Context, name string) (string, error) {
+	s, err := lp.getSecretFromCache(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return s.value, nil
+}
+
+func (lp *LocalCloudSecretsProxy) GetBinarySecret(ctx context.Context, name string) ([]byte, error) {
+	s, err := lp.getSecretFromCache(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.binary, nil
+}
@@ -15,12 +15,80 @@ type ProxyAuthHandlerAzureClientSecretIdentity struct {
 	ClientSecret string
 }
 
+// Setting ParameterStore on either AWS handler returns an AWSParameterStoreSecretsProxy, which reads
+// SSM Parameter Store parameters instead of Secrets Manager secrets.
+
 type ProxyAuthHandlerAWSDefaultIdentity struct {
-	Region string
+	Region         string
+	ParameterStore bool
 }
 
 type ProxyAuthHandlerAWSConfiguredIdentity struct {
-	AccessID  string
-	AccessKey string
-	Region    string
+	AccessID       string
+	AccessKey      string
+	Region         string
+	ParameterStore bool
+}
+
+type ProxyAuthHandlerGCPDefaultIdentity struct {
+	ProjectID string
+	Endpoint  string
+}
+
+type ProxyAuthHandlerGCPServiceAccountJSON struct {
+	ProjectID       string
+	CredentialsJSON string
+	Endpoint        string
+}
+
+// The Vault handlers read from the KV v2 secrets engine mounted at MountPath ("secret" when empty).
+// Address and Token default to the VAULT_ADDR and VAULT_TOKEN environment variables.
+
+type ProxyAuthHandlerVaultToken struct {
+	Address   string
+	Token     string
+	Namespace string
+	MountPath string
+}
+
+type ProxyAuthHandlerVaultAppRole struct {
+	Address       string
+	RoleID        string
+	SecretID      string
+	Namespace     string
+	MountPath     string
+	AuthMountPath string
+}
+
+// ProxyAuthHandlerVaultKubernetes logs in with the pod's service account token, read from
+// ServiceAccountTokenPath or from the default in-cluster location when empty
+type ProxyAuthHandlerVaultKubernetes struct {
+	Address                 string
+	Role                    string
+	ServiceAccountTokenPath string
+	Namespace               string
+	MountPath               string
+	AuthMountPath           string
+}
+
+// ProxyAuthHandlerLocal reads secrets from the local machine instead of a secret store. A secret is looked up
+// first as a file in SecretsDir (e.g. a mounted Kubernetes secret), then, if UseEnvironment is set, as an
+// environment variable, and finally in each of DotEnvFiles in order. Environment and dotenv lookups try
+// EnvPrefix followed by the name as given, then as an upper-case variable name ("db-password" -> "DB_PASSWORD").
+type ProxyAuthHandlerLocal struct {
+	SecretsDir     string
+	DotEnvFiles    []string
+	UseEnvironment bool
+	EnvPrefix      string
+}
+
+// ProxyAuthHandlerChain combines other proxies, which are tried in order. Each source keeps its own cache,
+// so the chain's cache options are not used.
+type ProxyAuthHandlerChain struct {
+	Sources []ChainedSource
+}
+
+type ChainedSource struct {
+	Name  string
+	Proxy CloudSecretsProxy
 }
@@ -0,0 +1,226 @@
+package secrets
+
+import (
+	"encoding/json"
+	vault "github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/api/auth/approle"
+	"github.com/hashicorp/vault/api/auth/kubernetes"
+	"golang.org/x/net/context"
+	"sync"
+	"time"
+)
+
+// how long to wait before trying again when logging back in to Vault fails
+const vault_RELOGIN_INTERVAL = 10 * time.Second
+
+// VaultCloudSecretsProxy reads KV v2 secrets from HashiCorp Vault. Its token is renewed in the background
+// for as long as Vault allows, after which the proxy logs in again with the handler's credentials.
+// Call Close to stop renewing.
+type VaultCloudSecretsProxy struct {
+	secretServicesClient *vault.Client
+	mountPath            string
+	cache                *secretCache
+	mutex                sync.Mutex
+	ctx                  context.Context
+	cancel               context.CancelFunc
+}
+
+func (handler ProxyAuthHandlerVaultToken) createProxy(options *CloudSecretsCacheOptions) (CloudSecretsProxy, error) {
+	return createVaultProxy(handler.Address, handler.Namespace, handler.MountPath, handler.Token, nil, options)
+}
+
+func (handler ProxyAuthHandlerVaultAppRole) createProxy(options *CloudSecretsCacheOptions) (CloudSecretsProxy, error) {
+	var loginOptions []approle.LoginOption
+	if handler.AuthMountPath != "" {
+		loginOptions = append(loginOptions, approle.WithMountPath(handler.AuthMountPath))
+	}
+	authMethod, err := approle.NewAppRoleAuth(handler.RoleID, &approle.SecretID{FromString: handler.SecretID},
+		loginOptions...)
+	if err != nil {
+		return nil, wrapError("unable to configure Vault AppRole login", err)
+	}
+	return createVaultProxy(handler.Address, handler.Namespace, handler.MountPath, "", authMethod, options)
+}
+
+func (handler ProxyAuthHandlerVaultKubernetes) createProxy(options *CloudSecretsCacheOptions) (CloudSecretsProxy, error) {
+	var loginOptions []kubernetes.LoginOption
+	if handler.AuthMountPath != "" {
+		loginOptions = append(loginOptions, kubernetes.WithMountPath(handler.AuthMountPath))
+	}
+	if handler.ServiceAccountTokenPath != "" {
+		loginOptions = append(loginOptions, kubernetes.WithServiceAccountTokenPath(handler.ServiceAccountTokenPath))
+	}
+	authMethod, err := kubernetes.NewKubernetesAuth(handler.Role, loginOptions...)
+	if err != nil {
+		return nil, wrapError("unable to configure Vault Kubernetes login", err)
+	}
+	return createVaultProxy(handler.Address, handler.Namespace, handler.MountPath, "", authMethod, options)
+}
+
+func createVaultProxy(address string, namespace string, mountPath string, token string, authMethod vault.AuthMethod,
+	options *CloudSecretsCacheOptions) (CloudSecretsProxy, error) {
+	config := vault.DefaultConfig()
+	if address != "" {
+		config.Address = address
+	}
+	client, err := vault.NewClient(config)
+	if err != nil {
+		return nil, wrapError("unable to create Vault client", err)
+	}
+	if namespace != "" {
+		client.SetNamespace(namespace)
+	}
+	if mountPath == "" {
+		mountPath = "secret"
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var authSecret *vault.Secret
+	if authMethod != nil {
+		authSecret, err = client.Auth().Login(ctx, authMethod)
+		if err != nil {
+			cancel()
+			return nil, wrapError("unable to log in to Vault", err)
+		}
+	} else {
+		if token != "" {
+			client.SetToken(token)
+		}
+		self, err := client.Auth().Token().LookupSelfWithContext(ctx)
+		if err != nil {
+			cancel()
+			return nil, wrapError("unable to look up Vault token", err)
+		}
+		renewable, _ := self.TokenIsRenewable()
+		ttl, _ := self.TokenTTL()
+		authSecret = &vault.Secret{Auth: &vault.SecretAuth{
+			ClientToken:   client.Token(),
+			Renewable:     renewable,
+			LeaseDuration: int(ttl.Seconds()),
+		}}
+	}
+	proxy := &VaultCloudSecretsProxy{
+		secretServicesClient: client,
+		mountPath:            mountPath,
+		cache: &secretCache{
+			secrets:    make(map[string]secret),
+			maxEntries: options.MaxEntries,
+			ttl:        options.TTL,
+		},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	// tokens without a TTL, such as root tokens, never need renewing
+	if authSecret.Auth != nil && authSecret.Auth.LeaseDuration > 0 {
+		go proxy.manageToken(authSecret, authMethod)
+	}
+	return proxy, nil
+}
+
+// manageToken renews the token until it reaches its max TTL or can no longer be renewed, then logs in again.
+// A token that was supplied directly cannot be replaced, so its renewal simply stops.
+func (vp *VaultCloudSecretsProxy) manageToken(authSecret *vault.Secret, authMethod vault.AuthMethod) {
+	for {
+		vp.watch(authSecret)
+		if vp.ctx.Err() != nil || authMethod == nil {
+			return
+		}
+		for {
+			var err error
+			authSecret, err = vp.secretServicesClient.Auth().Login(vp.ctx, authMethod)
+			if err == nil {
+				break
+			}
+			select {
+			case <-vp.ctx.Done():
+				return
+			case <-time.After(vault_RELOGIN_INTERVAL):
+			}
+		}
+	}
+}
+
+// watch renews a token or lease until it expires or the proxy is closed
+func (vp *VaultCloudSecretsProxy) watch(renewable *vault.Secret) {
+	watcher, err := vp.secretServicesClient.NewLifetimeWatcher(&vault.LifetimeWatcherInput{Secret: renewable})
+	if err != nil {
+		return
+	}
+	go watcher.Start()
+	defer watcher.Stop()
+	for {
+		select {
+		case <-vp.ctx.Done():
+			return
+		case <-watcher.DoneCh():
+			return
+		case <-watcher.RenewCh():
+		}
+	}
+}
+
+// Close stops renewing the proxy's token and any leases; the token itself is not revoked
+func (vp *VaultCloudSecretsProxy) Close() error {
+	vp.cancel()
+	return nil
+}
+
+func (vp *VaultCloudSecretsProxy) getSecretFromCache(ctx context.Context, name string) (secret, error) {
+	vp.mutex.Lock()
+	s, ok := vp.cache.secrets[name]
+	vp.mutex.Unlock()
+	if ok && time.Now().Sub(s.timeAdded) < vp.cache.ttl {
+		return s, nil
+	}
+	resp, err := vp.secretServicesClient.KVv2(vp.mountPath).Get(ctx, name)
+	if err == nil && resp.Data == nil {
+		// the latest version has been deleted
+		err = vault.ErrSecretNotFound
+	}
+	if err != nil {
+		return secret{}, wrapError("unable to retrieve secret", err)
+	}
+	value, err := json.Marshal(resp.Data)
+	if err != nil {
+		return secret{}, wrapError("unable to serialize secret", err)
+	}
+
+	thisSecret := secret{
+		value:     string(value),
+		timeAdded: time.Now(),
+	}
+	vp.mutex.Lock()
+	vp.cache.secrets[name] = thisSecret
+	if len(vp.cache.secrets) > vp.cache.maxEntries {
+		vp.cache.evict()
+	}
+	vp.mutex.Unlock()
+	if resp.Raw != nil && resp.Raw.Renewable && resp.Raw.LeaseID != "" {
+		go vp.manageLease(name, thisSecret, resp.Raw)
+	}
+	return thisSecret, nil
+}
+
+// manageLease keeps a leased secret renewed and drops it from the cache once the lease can no longer be renewed
+func (vp *VaultCloudSecretsProxy) manageLease(name string, cached secret, leased *vault.Secret) {
+	vp.watch(leased)
+	vp.mutex.Lock()
+	defer vp.mutex.Unlock()
+	if s, ok := vp.cache.secrets[name]; ok && s.timeAdded.Equal(cached.timeAdded) {
+		delete(vp.cache.secrets, name)
+	}
+}
+
+// GetSecret returns the data of the latest version of the secret as a JSON object of key/value pairs
+func (vp *VaultCloudSecretsProxy) GetSecret(ctx context.Context, name string) (string, error) {
+	s, err := vp.getSecretFromCache(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return s.value, nil
+}
+
+func (vp *VaultCloudSecretsProxy) GetBinarySecret(ctx context.Context, name string) ([]byte, error) {
+	// KV secrets are key/value pairs, so the binary form is the same JSON as GetSecret
+	value, err := vp.GetSecret(ctx, name)
+	return []byte(value), err
+}
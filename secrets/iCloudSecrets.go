@@ -36,6 +36,8 @@ func CloudSecretsProxyFactory(handler ProxyAuthHandler, options *CloudSecretsCac
 type CloudSecretsError struct {
 	message       string
 	internalError error
+	// kind is one of the exported errors, or nil when the error could not be classified
+	kind error
 }
 
 func (err *CloudSecretsError) Error() string {
@@ -46,8 +48,13 @@ func (err *CloudSecretsError) Unwrap() error {
 	return err.internalError
 }
 
+// Is lets errors.Is match a classified error against the exported errors, such as ErrNotFound
+func (err *CloudSecretsError) Is(target error) bool {
+	return err.kind != nil && err.kind == target
+}
+
 func wrapError(msg string, err error) *CloudSecretsError {
-	return &CloudSecretsError{message: msg, internalError: err}
+	return &CloudSecretsError{message: msg, internalError: err, kind: classifyError(err)}
 }
 
 func (cache *secretCache) evict() {
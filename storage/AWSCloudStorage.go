@@ -6,12 +6,17 @@ import (
 	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 	"io"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
@@ -115,18 +120,142 @@ func (aw *AWSCloudStorageProxy) ListFolders(ctx context.Context, containerName s
 	prefix string) ([]string, error) {
 	return aw.listFilesOrFolders(ctx, containerName, maxNumber, prefix, listTypeFolder)
 }
+
+func (aw *AWSCloudStorageProxy) ListObjects(ctx context.Context, containerName string, maxNumber int,
+	prefix string, includeMetadata bool) ([]ObjectInfo, error) {
+	if maxNumber <= 0 {
+		maxNumber = max_RESULT
+	}
+	objects := make([]ObjectInfo, 0)
+	paginator := s3.NewListObjectsV2Paginator(aw.s3ServicesClient, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(containerName),
+		MaxKeys:   aws.Int32(int32(min(maxNumber, 1000))),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	for paginator.HasMorePages() && len(objects) < maxNumber {
+		result, err := paginator.NextPage(ctx)
+		if err != nil {
+			return objects, wrapError("unable to list contents of bucket "+containerName, err)
+		}
+		for _, obj := range result.Contents {
+			if len(objects) >= maxNumber {
+				break
+			}
+			objects = append(objects, readS3ObjectInfo(obj))
+		}
+	}
+	if includeMetadata {
+		if err := aw.headObjects(ctx, containerName, objects); err != nil {
+			return objects, err
+		}
+	}
+	return objects, nil
+}
+
+func (aw *AWSCloudStorageProxy) ListObjectsPage(ctx context.Context, containerName string,
+	options ListOptions) (ObjectPage, error) {
+	page := ObjectPage{Objects: make([]ObjectInfo, 0), Folders: make([]string, 0)}
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(containerName),
+		MaxKeys: aws.Int32(int32(min(options.pageSize(), 1000))),
+		Prefix:  aws.String(options.Prefix),
+	}
+	if delimiter := options.delimiter(); delimiter != "" {
+		input.Delimiter = aws.String(delimiter)
+	}
+	if options.PageToken != "" {
+		input.ContinuationToken = aws.String(options.PageToken)
+	}
+	result, err := aw.s3ServicesClient.ListObjectsV2(ctx, input)
+	if err != nil {
+		return page, wrapError("unable to list contents of bucket "+containerName, err)
+	}
+	for _, obj := range result.Contents {
+		page.Objects = append(page.Objects, readS3ObjectInfo(obj))
+	}
+	for _, obj := range result.CommonPrefixes {
+		page.Folders = append(page.Folders, aws.ToString(obj.Prefix))
+	}
+	if aws.ToBool(result.IsTruncated) {
+		page.ContinuationToken = aws.ToString(result.NextContinuationToken)
+	}
+	if options.IncludeMetadata {
+		if err := aw.headObjects(ctx, containerName, page.Objects); err != nil {
+			return page, err
+		}
+	}
+	return page, nil
+}
+
+// readS3ObjectInfo leaves ContentType empty, since listings do not include it, until headObjects fills it in
+func readS3ObjectInfo(obj types.Object) ObjectInfo {
+	return ObjectInfo{
+		Name:         aws.ToString(obj.Key),
+		Size:         aws.ToInt64(obj.Size),
+		LastModified: aws.ToTime(obj.LastModified),
+		ETag:         aws.ToString(obj.ETag),
+		StorageTier:  string(obj.StorageClass),
+	}
+}
+
+// headObjects fills in the content type and metadata of listed objects, which S3 listings do not include
+func (aw *AWSCloudStorageProxy) headObjects(ctx context.Context, containerName string, objects []ObjectInfo) error {
+	wg := sync.WaitGroup{}
+	errCh := make(chan error, 1)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	semaphore := make(chan struct{}, 10)
+	for i := range objects {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(object *ObjectInfo) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			resp, err := aw.s3ServicesClient.HeadObject(ctx, &s3.HeadObjectInput{
+				Bucket: aws.String(containerName),
+				Key:    aws.String(object.Name),
+			})
+			if err != nil {
+				select {
+				case errCh <- wrapError("unable to get metadata for object "+object.Name, err):
+				default:
+				}
+				cancel()
+				return
+			}
+			object.ContentType = aws.ToString(resp.ContentType)
+			object.Metadata = resp.Metadata
+		}(&objects[i])
+	}
+	wg.Wait()
+	select {
+	case err := <-errCh:
+		return err
+	default:
+		return nil
+	}
+}
+
 func (aw *AWSCloudStorageProxy) getFileContentAndMetadata(ctx context.Context, containerName string, fileName string,
-	includeMetadata bool) (string, map[string]string, error) {
+	includeMetadata bool, options fileOptions) (string, map[string]string, error) {
 	var metadata map[string]string
 	resp, err := aw.s3ServicesClient.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(containerName),
-		Key:    aws.String(fileName),
+		Bucket:    aws.String(containerName),
+		Key:       aws.String(fileName),
+		VersionId: optionalString(options.versionID),
 	})
 	if err == nil {
 		if includeMetadata {
 			metadata = resp.Metadata
 			metadata["last_modified"] = resp.LastModified.Format(time_FORMAT)
 			metadata["content_length"] = strconv.Itoa(int(*resp.ContentLength))
+			metadata["etag"] = aws.ToString(resp.ETag)
+			if resp.VersionId != nil {
+				metadata["version_id"] = aws.ToString(resp.VersionId)
+			}
+			readS3ContentHeaders(resp.ContentType, resp.ContentEncoding, resp.ContentLanguage, resp.ContentDisposition,
+				resp.CacheControl).addTo(metadata)
 		}
 
 		defer resp.Body.Close()
@@ -139,8 +268,9 @@ func (aw *AWSCloudStorageProxy) getFileContentAndMetadata(ctx context.Context, c
 	return "", metadata, wrapError("unable to get file "+fileName, err)
 }
 
-func (aw *AWSCloudStorageProxy) GetFile(ctx context.Context, containerName string, fileName string) (CloudFile, error) {
-	content, metadata, err := aw.getFileContentAndMetadata(ctx, containerName, fileName, true)
+func (aw *AWSCloudStorageProxy) GetFile(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) (CloudFile, error) {
+	content, metadata, err := aw.getFileContentAndMetadata(ctx, containerName, fileName, true, applyFileOptions(options))
 	cloudFile := CloudFile{
 		Container: containerName,
 		FileName:  fileName,
@@ -151,14 +281,16 @@ func (aw *AWSCloudStorageProxy) GetFile(ctx context.Context, containerName strin
 }
 
 func (aw *AWSCloudStorageProxy) GetFileContentAsString(ctx context.Context, containerName string, fileName string) (string, error) {
-	content, _, err := aw.getFileContentAndMetadata(ctx, containerName, fileName, false)
+	content, _, err := aw.getFileContentAndMetadata(ctx, containerName, fileName, false, fileOptions{})
 	return content, err
 }
 
-func (aw *AWSCloudStorageProxy) GetFileContentAsInputStream(ctx context.Context, containerName string, fileName string) (io.ReadCloser, error) {
+func (aw *AWSCloudStorageProxy) GetFileContentAsInputStream(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) (io.ReadCloser, error) {
 	resp, err := aw.s3ServicesClient.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(containerName),
-		Key:    aws.String(fileName),
+		Bucket:    aws.String(containerName),
+		Key:       aws.String(fileName),
+		VersionId: optionalString(applyFileOptions(options).versionID),
 	})
 	if err == nil {
 		return resp.Body, nil
@@ -166,6 +298,34 @@ func (aw *AWSCloudStorageProxy) GetFileContentAsInputStream(ctx context.Context,
 	return nil, wrapError("unable to get stream reader for file "+fileName, err)
 }
 
+// GetFileRange accepts WithVersion and IfMatch
+func (aw *AWSCloudStorageProxy) GetFileRange(ctx context.Context, containerName string, fileName string, offset int64,
+	length int64, options ...FileOption) (io.ReadCloser, error) {
+	if err := checkRange(fileName, offset, length); err != nil {
+		return nil, err
+	}
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+	applied := applyFileOptions(options)
+	resp, err := aw.s3ServicesClient.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:    aws.String(containerName),
+		Key:       aws.String(fileName),
+		Range:     aws.String(byteRange),
+		VersionId: optionalString(applied.versionID),
+		IfMatch:   optionalString(applied.ifMatch),
+	})
+	if err != nil {
+		return nil, wrapConditionalError("unable to get range of file "+fileName, err, applied)
+	}
+	return resp.Body, nil
+}
+
+func (aw *AWSCloudStorageProxy) OpenReader(ctx context.Context, containerName string, fileName string) (*FileReader, error) {
+	return openReader(ctx, aw, containerName, fileName)
+}
+
 func (aw *AWSCloudStorageProxy) GetLargeFileContentAsByteArray(ctx context.Context, containerName string, fileName string,
 	fileSize int64, concurrency int) ([]byte, error) {
 	if concurrency <= 0 {
@@ -193,36 +353,115 @@ func (aw *AWSCloudStorageProxy) GetLargeFileContentAsByteArray(ctx context.Conte
 
 func (aw *AWSCloudStorageProxy) GetMetadata(ctx context.Context, containerName string,
 	fileName string) (map[string]string, error) {
+	return aw.getMetadata(ctx, containerName, fileName, "")
+}
+
+func (aw *AWSCloudStorageProxy) getMetadata(ctx context.Context, containerName string, fileName string,
+	versionID string) (map[string]string, error) {
 	resp, err := aw.s3ServicesClient.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(containerName),
-		Key:    aws.String(fileName),
+		Bucket:    aws.String(containerName),
+		Key:       aws.String(fileName),
+		VersionId: optionalString(versionID),
 	})
 	if err == nil {
 		metadata := resp.Metadata
 		metadata["last_modified"] = resp.LastModified.Format(time_FORMAT)
 		metadata["content_length"] = strconv.Itoa(int(*resp.ContentLength))
+		metadata["etag"] = aws.ToString(resp.ETag)
+		if resp.VersionId != nil {
+			metadata["version_id"] = aws.ToString(resp.VersionId)
+		}
+		readS3ContentHeaders(resp.ContentType, resp.ContentEncoding, resp.ContentLanguage, resp.ContentDisposition,
+			resp.CacheControl).addTo(metadata)
 		return metadata, nil
 	}
 	return nil, wrapError("unable to get metadata for object "+fileName, err)
 }
 
+func readS3ContentHeaders(contentType *string, contentEncoding *string, contentLanguage *string,
+	contentDisposition *string, cacheControl *string) contentHeaders {
+	return contentHeaders{
+		ContentType:        aws.ToString(contentType),
+		ContentEncoding:    aws.ToString(contentEncoding),
+		ContentLanguage:    aws.ToString(contentLanguage),
+		ContentDisposition: aws.ToString(contentDisposition),
+		CacheControl:       aws.ToString(cacheControl),
+	}
+}
+
+// optionalString leaves headers that are not set to the defaults of the service
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return aws.String(value)
+}
+
+func (aw *AWSCloudStorageProxy) Exists(ctx context.Context, containerName string, fileName string) (bool, error) {
+	_, err := aw.s3ServicesClient.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(containerName),
+		Key:    aws.String(fileName),
+	})
+	if classifyError(err) == ErrNotFound {
+		// the response to HEAD has no body to tell a missing bucket apart, so the bucket is checked as well
+		_, bucketErr := aw.s3ServicesClient.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(containerName)})
+		if classifyError(bucketErr) == ErrNotFound {
+			return false, wrapError("bucket "+containerName+" does not exist", bucketErr)
+		}
+	}
+	return existsResult(fileName, err)
+}
+
+// s3Conditions adds the If-Match header to the requests that write or delete an object, since this version of the
+// SDK has no field for it. If-None-Match is set through the input of the request.
+func s3Conditions(options fileOptions) []func(*s3.Options) {
+	if options.ifMatch == "" {
+		return nil
+	}
+	return []func(*s3.Options){s3.WithAPIOptions(func(stack *middleware.Stack) error {
+		return stack.Build.Add(middleware.BuildMiddlewareFunc("IfMatch", func(ctx context.Context, in middleware.BuildInput,
+			next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+			switch awsmiddleware.GetOperationName(ctx) {
+			case "PutObject", "CompleteMultipartUpload", "DeleteObject":
+				if request, ok := in.Request.(*smithyhttp.Request); ok {
+					request.Header.Set("If-Match", options.ifMatch)
+				}
+			}
+			return next.HandleBuild(ctx, in)
+		}), middleware.After)
+	})}
+}
+
+// UploadFileFromString returns the ETag of the new object, and accepts IfMatch and IfNoneMatch
 func (aw *AWSCloudStorageProxy) UploadFileFromString(ctx context.Context, containerName string, fileName string,
-	metadata map[string]string, content string) error {
+	metadata map[string]string, content string, options ...FileOption) (string, error) {
 	contentReader := strings.NewReader(content)
-	_, err := aw.s3ServicesClient.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:   aws.String(containerName),
-		Key:      aws.String(fileName),
-		Body:     contentReader,
-		Metadata: metadata,
-	})
+	metadata, headers := splitContentHeaders(metadata)
+	applied := applyFileOptions(options)
+	resp, err := aw.s3ServicesClient.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:             aws.String(containerName),
+		Key:                aws.String(fileName),
+		Body:               contentReader,
+		Metadata:           metadata,
+		ContentType:        optionalString(headers.ContentType),
+		ContentEncoding:    optionalString(headers.ContentEncoding),
+		ContentLanguage:    optionalString(headers.ContentLanguage),
+		ContentDisposition: optionalString(headers.ContentDisposition),
+		CacheControl:       optionalString(headers.CacheControl),
+		IfNoneMatch:        optionalString(applied.ifNoneMatch),
+	}, s3Conditions(applied)...)
 	if err != nil {
-		return wrapError("Could not upload file "+fileName, err)
+		return "", wrapConditionalError("Could not upload file "+fileName, err, applied)
 	}
-	return nil
+	return aws.ToString(resp.ETag), nil
 }
 
+// UploadFileFromInputStream returns the ETag of the new object, and accepts IfMatch and IfNoneMatch
 func (aw *AWSCloudStorageProxy) UploadFileFromInputStream(ctx context.Context, containerName string, fileName string, metadata map[string]string,
-	inputStream io.Reader, fileSizeBytes int64, concurrency int) error {
+	inputStream io.Reader, fileSizeBytes int64, concurrency int, options ...FileOption) (string, error) {
+	if fileSizeBytes < 0 {
+		return uploadStream(ctx, aw, containerName, fileName, metadata, inputStream, concurrency, options)
+	}
 	var uploader *manager.Uploader
 	var partSize int64
 	partSize = size_5MiB
@@ -231,7 +470,7 @@ func (aw *AWSCloudStorageProxy) UploadFileFromInputStream(ctx context.Context, c
 	}
 	if fileSizeBytes > size_5MiB*max_PARTS {
 		// we need to increase the Part size
-		partSize = fileSizeBytes / max_PARTS
+		partSize = (fileSizeBytes + max_PARTS - 1) / max_PARTS
 	}
 	uploader = manager.NewUploader(aw.s3ServicesClient, func(u *manager.Uploader) {
 		u.PartSize = partSize
@@ -239,29 +478,171 @@ func (aw *AWSCloudStorageProxy) UploadFileFromInputStream(ctx context.Context, c
 		u.BufferProvider = manager.NewBufferedReadSeekerWriteToPool(int(partSize))
 	})
 
-	_, err := uploader.Upload(ctx, &s3.PutObjectInput{
-		Bucket:   aws.String(containerName),
-		Key:      aws.String(fileName),
-		Body:     inputStream,
-		Metadata: metadata,
+	metadata, headers := splitContentHeaders(metadata)
+	applied := applyFileOptions(options)
+	// the uploader copies If-None-Match to the request that completes a multipart upload
+	resp, err := uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:             aws.String(containerName),
+		Key:                aws.String(fileName),
+		Body:               inputStream,
+		Metadata:           metadata,
+		ContentType:        optionalString(headers.ContentType),
+		ContentEncoding:    optionalString(headers.ContentEncoding),
+		ContentLanguage:    optionalString(headers.ContentLanguage),
+		ContentDisposition: optionalString(headers.ContentDisposition),
+		CacheControl:       optionalString(headers.CacheControl),
+		IfNoneMatch:        optionalString(applied.ifNoneMatch),
+	}, func(u *manager.Uploader) {
+		u.ClientOptions = append(u.ClientOptions, s3Conditions(applied)...)
+	})
+	if err != nil {
+		return "", wrapConditionalError("unable to upload file "+fileName, err, applied)
+	}
+	return aws.ToString(resp.ETag), nil
+}
+
+// OpenWriter uploads the parts of the file as a multipart upload
+func (aw *AWSCloudStorageProxy) OpenWriter(ctx context.Context, containerName string, fileName string,
+	options WriterOptions) (*FileWriter, error) {
+	resp, err := aw.s3ServicesClient.CreateMultipartUpload(ctx, newS3MultipartUploadInput(containerName, fileName,
+		options.Metadata))
+	if err != nil {
+		return nil, wrapError("unable to start upload of file "+fileName, err)
+	}
+	uploader := &s3PartUploader{
+		client:   aw.s3ServicesClient,
+		bucket:   containerName,
+		key:      fileName,
+		uploadID: aws.ToString(resp.UploadId),
+		options:  applyFileOptions(options.FileOptions),
+	}
+	return newFileWriter(ctx, fileName, uploader, max(options.partSize(), size_5MiB), options.concurrency(),
+		partLimits{maxParts: max_PARTS, maxPartSize: size_5GiB, maxSize: size_5TiB}), nil
+}
+
+type s3PartUploader struct {
+	client   *s3.Client
+	bucket   string
+	key      string
+	uploadID string
+	options  fileOptions
+	mutex    sync.Mutex
+	parts    []types.CompletedPart
+}
+
+func (uploader *s3PartUploader) uploadPart(ctx context.Context, number int, data []byte) error {
+	resp, err := uploader.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(uploader.bucket),
+		Key:        aws.String(uploader.key),
+		UploadId:   aws.String(uploader.uploadID),
+		PartNumber: aws.Int32(int32(number)),
+		Body:       bytes.NewReader(data),
 	})
 	if err != nil {
-		return wrapError("unable to upload file "+fileName, err)
+		return wrapError(fmt.Sprintf("unable to upload part %d of file %s", number, uploader.key), err)
 	}
+	uploader.mutex.Lock()
+	defer uploader.mutex.Unlock()
+	uploader.parts = append(uploader.parts, types.CompletedPart{ETag: resp.ETag, PartNumber: aws.Int32(int32(number))})
 	return nil
 }
 
-func (aw *AWSCloudStorageProxy) DeleteFile(ctx context.Context, containerName string, fileName string) error {
-	_, err := aw.s3ServicesClient.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(containerName),
-		Key:    aws.String(fileName),
+func (uploader *s3PartUploader) commit(ctx context.Context, parts int) (string, error) {
+	if parts == 0 {
+		// a multipart upload needs at least one part, even for an empty file
+		if err := uploader.uploadPart(ctx, 1, nil); err != nil {
+			return "", err
+		}
+		parts = 1
+	}
+	completedParts := make([]types.CompletedPart, parts)
+	for _, part := range uploader.parts {
+		completedParts[*part.PartNumber-1] = part
+	}
+	resp, err := uploader.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(uploader.bucket),
+		Key:             aws.String(uploader.key),
+		UploadId:        aws.String(uploader.uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completedParts},
+		IfNoneMatch:     optionalString(uploader.options.ifNoneMatch),
+	}, s3Conditions(uploader.options)...)
+	if err != nil {
+		return "", wrapConditionalError("unable to complete upload of file "+uploader.key, err, uploader.options)
+	}
+	return aws.ToString(resp.ETag), nil
+}
+
+func (uploader *s3PartUploader) abort(ctx context.Context) {
+	_, _ = uploader.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(uploader.bucket),
+		Key:      aws.String(uploader.key),
+		UploadId: aws.String(uploader.uploadID),
 	})
+}
+
+// DeleteFile accepts WithVersion and IfMatch
+func (aw *AWSCloudStorageProxy) DeleteFile(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) error {
+	applied := applyFileOptions(options)
+	_, err := aw.s3ServicesClient.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:    aws.String(containerName),
+		Key:       aws.String(fileName),
+		VersionId: optionalString(applied.versionID),
+	}, s3Conditions(applied)...)
 	if err != nil {
-		return wrapError("unable to delete file "+fileName, err)
+		return wrapConditionalError("unable to delete file "+fileName, err, applied)
 	}
 	return nil
 }
 
+// DeleteFiles deletes up to 1000 files per request. If a request fails as a whole, every file in it is
+// reported with that error, and the first such error is also returned.
+func (aw *AWSCloudStorageProxy) DeleteFiles(ctx context.Context, containerName string,
+	fileNames []string) ([]FileResult, error) {
+	results := make([]FileResult, len(fileNames))
+	var firstErr error
+	for start := 0; start < len(fileNames); start += 1000 {
+		batch := fileNames[start:min(start+1000, len(fileNames))]
+		objects := make([]types.ObjectIdentifier, len(batch))
+		for i, fileName := range batch {
+			objects[i] = types.ObjectIdentifier{Key: aws.String(fileName)}
+			results[start+i].Name = fileName
+		}
+		// quiet mode only reports the keys that could not be deleted
+		resp, err := aw.s3ServicesClient.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(containerName),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			err = wrapError("unable to delete files from bucket "+containerName, err)
+			for i := range batch {
+				results[start+i].Err = err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		failed := make(map[string]error, len(resp.Errors))
+		for _, deleteError := range resp.Errors {
+			key := aws.ToString(deleteError.Key)
+			failed[key] = wrapError("unable to delete file "+key, &smithy.GenericAPIError{
+				Code:    aws.ToString(deleteError.Code),
+				Message: aws.ToString(deleteError.Message),
+			})
+		}
+		for i, fileName := range batch {
+			results[start+i].Err = failed[fileName]
+		}
+	}
+	return results, firstErr
+}
+
+func (aw *AWSCloudStorageProxy) DeletePrefix(ctx context.Context, containerName string, prefix string,
+	concurrency int) ([]FileResult, error) {
+	return deletePrefix(ctx, aw, containerName, prefix, concurrency)
+}
+
 func (aw *AWSCloudStorageProxy) GetSourceBlobSignedURL(ctx context.Context, containerName string, fileName string) (string, error) {
 	presignClient := s3.NewPresignClient(aw.s3ServicesClient)
 	request, err := presignClient.PresignGetObject(ctx,
@@ -291,6 +672,7 @@ func (aw *AWSCloudStorageProxy) CopyFileFromRemoteStorage(ctx context.Context, s
 		return wrapError("unable to read source file metadata", err)
 	}
 	fileSize := getStringAsInt64(metadata["content_length"])
+	metadata = userMetadata(metadata)
 	if fileSize == 0 {
 		fileSize = 1
 	}
@@ -300,7 +682,7 @@ func (aw *AWSCloudStorageProxy) CopyFileFromRemoteStorage(ctx context.Context, s
 		if err != nil {
 			return wrapError("unable to read source file as stream", err)
 		}
-		if er := aw.UploadFileFromInputStream(ctx, destContainer, destFile, metadata, inputStream,
+		if _, er := aw.UploadFileFromInputStream(ctx, destContainer, destFile, metadata, inputStream,
 			fileSize, concurrency); er != nil {
 			return er
 		}
@@ -322,15 +704,26 @@ func (aw *AWSCloudStorageProxy) CopyFileFromRemoteStorage(ctx context.Context, s
 	return nil
 }
 
+// newS3MultipartUploadInput starts a multipart upload with the user metadata and content headers of the metadata
+func newS3MultipartUploadInput(containerName string, fileName string, metadata map[string]string) *s3.CreateMultipartUploadInput {
+	metadata, headers := splitContentHeaders(metadata)
+	return &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(containerName),
+		Key:                aws.String(fileName),
+		Metadata:           metadata,
+		ContentType:        optionalString(headers.ContentType),
+		ContentEncoding:    optionalString(headers.ContentEncoding),
+		ContentLanguage:    optionalString(headers.ContentLanguage),
+		ContentDisposition: optionalString(headers.ContentDisposition),
+		CacheControl:       optionalString(headers.CacheControl),
+	}
+}
+
 func (aw *AWSCloudStorageProxy) doMultipartUpload(ctx context.Context, destContainer string, destFile string,
 	metadata map[string]string, content []byte, concurrency int) error {
 	lengthInt := len(content)
 	length64 := int64(lengthInt)
-	upload, err := aw.s3ServicesClient.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
-		Bucket:   aws.String(destContainer),
-		Key:      aws.String(destFile),
-		Metadata: metadata,
-	})
+	upload, err := aw.s3ServicesClient.CreateMultipartUpload(ctx, newS3MultipartUploadInput(destContainer, destFile, metadata))
 	if err != nil {
 		return wrapError("unable to create multipart upload", err)
 	}
@@ -448,7 +841,15 @@ func (aw *AWSCloudStorageProxy) CopyFileFromLocalStorage(ctx context.Context, so
 	if e != nil {
 		return e
 	}
+	return aw.copyObject(ctx, source, metadata, destContainer, destFile, concurrency)
+}
+
+// copyObject copies the object named by a copy source within S3, which may include a version ID. Objects too
+// large for a single copy are copied in parts, with the metadata of the source given to the new upload.
+func (aw *AWSCloudStorageProxy) copyObject(ctx context.Context, source string, metadata map[string]string,
+	destContainer string, destFile string, concurrency int) error {
 	length := getStringAsInt64(metadata["content_length"])
+	metadata = userMetadata(metadata)
 	if length < size_LARGEOBJECT {
 		if _, err := aw.s3ServicesClient.CopyObject(ctx, &s3.CopyObjectInput{
 			CopySource: aws.String(source),
@@ -459,11 +860,7 @@ func (aw *AWSCloudStorageProxy) CopyFileFromLocalStorage(ctx context.Context, so
 		}
 	} else {
 		lengthInt := int(length)
-		upload, err := aw.s3ServicesClient.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
-			Bucket:   aws.String(destContainer),
-			Key:      aws.String(destFile),
-			Metadata: metadata,
-		})
+		upload, err := aw.s3ServicesClient.CreateMultipartUpload(ctx, newS3MultipartUploadInput(destContainer, destFile, metadata))
 		if err != nil {
 			return wrapError("unable to create multipart upload", err)
 		}
@@ -564,6 +961,184 @@ func (aw *AWSCloudStorageProxy) CopyFileFromLocalStorage(ctx context.Context, so
 	return nil
 }
 
+func (aw *AWSCloudStorageProxy) MoveFile(ctx context.Context, sourceContainer string, sourceFile string,
+	destContainer string, destFile string) error {
+	return moveFile(ctx, aw, sourceContainer, sourceFile, destContainer, destFile)
+}
+
+func (aw *AWSCloudStorageProxy) MovePrefix(ctx context.Context, sourceContainer string, sourcePrefix string,
+	destContainer string, destPrefix string, concurrency int) ([]FileResult, error) {
+	return movePrefix(ctx, aw, sourceContainer, sourcePrefix, destContainer, destPrefix, concurrency)
+}
+
+func (aw *AWSCloudStorageProxy) GetTags(ctx context.Context, containerName string, fileName string) (map[string]string, error) {
+	resp, err := aw.s3ServicesClient.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(containerName),
+		Key:    aws.String(fileName),
+	})
+	if err != nil {
+		return nil, wrapError("unable to get tags for object "+fileName, err)
+	}
+	tags := make(map[string]string, len(resp.TagSet))
+	for _, tag := range resp.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return tags, nil
+}
+
+// SetTags replaces all the tags of an object; S3 allows up to 10
+func (aw *AWSCloudStorageProxy) SetTags(ctx context.Context, containerName string, fileName string,
+	tags map[string]string) error {
+	tagSet := make([]types.Tag, 0, len(tags))
+	for key, value := range tags {
+		tagSet = append(tagSet, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	_, err := aw.s3ServicesClient.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(containerName),
+		Key:     aws.String(fileName),
+		Tagging: &types.Tagging{TagSet: tagSet},
+	})
+	if err != nil {
+		return wrapError("unable to set tags for object "+fileName, err)
+	}
+	return nil
+}
+
+// FindFilesByTags reads the tags of every object under the prefix, since S3 cannot query objects by tag
+func (aw *AWSCloudStorageProxy) FindFilesByTags(ctx context.Context, containerName string, prefix string,
+	tags map[string]string) ([]string, error) {
+	return findFilesByTags(ctx, aw, containerName, prefix, tags)
+}
+
+// ListFileVersions lists the versions and delete markers of a file in a bucket with versioning enabled.
+// A bucket that has never had versioning enabled returns the current object as the single version "null".
+func (aw *AWSCloudStorageProxy) ListFileVersions(ctx context.Context, containerName string,
+	fileName string) ([]FileVersion, error) {
+	versions := make([]FileVersion, 0)
+	paginator := s3.NewListObjectVersionsPaginator(aw.s3ServicesClient, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(containerName),
+		Prefix: aws.String(fileName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return versions, wrapError("unable to list versions of file "+fileName, err)
+		}
+		for _, version := range page.Versions {
+			// the prefix also matches longer names
+			if aws.ToString(version.Key) != fileName {
+				continue
+			}
+			versions = append(versions, FileVersion{
+				ObjectInfo: readS3VersionInfo(version),
+				VersionID:  aws.ToString(version.VersionId),
+				IsCurrent:  aws.ToBool(version.IsLatest),
+			})
+		}
+		for _, marker := range page.DeleteMarkers {
+			if aws.ToString(marker.Key) != fileName {
+				continue
+			}
+			versions = append(versions, FileVersion{
+				ObjectInfo:     ObjectInfo{Name: fileName, LastModified: aws.ToTime(marker.LastModified)},
+				VersionID:      aws.ToString(marker.VersionId),
+				IsCurrent:      aws.ToBool(marker.IsLatest),
+				IsDeleteMarker: true,
+			})
+		}
+	}
+	if len(versions) == 0 {
+		return versions, &CloudStorageError{message: "no versions found for file " + fileName, kind: ErrNotFound}
+	}
+	sortVersions(versions)
+	return versions, nil
+}
+
+func readS3VersionInfo(version types.ObjectVersion) ObjectInfo {
+	return ObjectInfo{
+		Name:         aws.ToString(version.Key),
+		Size:         aws.ToInt64(version.Size),
+		LastModified: aws.ToTime(version.LastModified),
+		ETag:         aws.ToString(version.ETag),
+		StorageTier:  string(version.StorageClass),
+	}
+}
+
+// RestoreFileVersion copies a version over the file, so it becomes the current version. The versions that
+// were newer are kept.
+func (aw *AWSCloudStorageProxy) RestoreFileVersion(ctx context.Context, containerName string, fileName string,
+	versionID string) error {
+	metadata, err := aw.getMetadata(ctx, containerName, fileName, versionID)
+	if err != nil {
+		return wrapError("unable to restore version "+versionID+" of file "+fileName, err)
+	}
+	source := fmt.Sprintf("%s/%s?versionId=%s", containerName, fileName, url.QueryEscape(versionID))
+	return aw.copyObject(ctx, source, metadata, containerName, fileName, 15)
+}
+
+// checkVersioning fails for a bucket that has never had versioning enabled, since S3 only keeps deleted
+// objects as versions
+func (aw *AWSCloudStorageProxy) checkVersioning(ctx context.Context, containerName string) error {
+	resp, err := aw.s3ServicesClient.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{
+		Bucket: aws.String(containerName),
+	})
+	if err != nil {
+		return wrapError("unable to get versioning status of bucket "+containerName, err)
+	}
+	if resp.Status == "" {
+		return recoveryNotEnabled(containerName, "versioning")
+	}
+	return nil
+}
+
+// ListDeletedFiles lists the objects under a prefix whose current version is a delete marker, with the newest
+// version that UndeleteFile brings back
+func (aw *AWSCloudStorageProxy) ListDeletedFiles(ctx context.Context, containerName string,
+	prefix string) ([]DeletedFile, error) {
+	deleted := make([]DeletedFile, 0)
+	if err := aw.checkVersioning(ctx, containerName); err != nil {
+		return deleted, err
+	}
+	markers := make(map[string]time.Time)
+	newest := make(map[string]ObjectInfo)
+	paginator := s3.NewListObjectVersionsPaginator(aw.s3ServicesClient, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(containerName),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return deleted, wrapError("unable to list deleted files in bucket "+containerName, err)
+		}
+		for _, marker := range page.DeleteMarkers {
+			if aws.ToBool(marker.IsLatest) {
+				markers[aws.ToString(marker.Key)] = aws.ToTime(marker.LastModified)
+			}
+		}
+		for _, version := range page.Versions {
+			// the versions of each key are listed newest first
+			if _, ok := newest[aws.ToString(version.Key)]; !ok {
+				newest[aws.ToString(version.Key)] = readS3VersionInfo(version)
+			}
+		}
+	}
+	for name, deletedTime := range markers {
+		if object, ok := newest[name]; ok {
+			deleted = append(deleted, DeletedFile{ObjectInfo: object, DeletedTime: deletedTime})
+		}
+	}
+	sortDeletedFiles(deleted)
+	return deleted, nil
+}
+
+// UndeleteFile removes the delete markers of an object in a versioned bucket, so its newest version is current again
+func (aw *AWSCloudStorageProxy) UndeleteFile(ctx context.Context, containerName string, fileName string) error {
+	if err := aw.checkVersioning(ctx, containerName); err != nil {
+		return err
+	}
+	return removeDeleteMarkers(ctx, aw, containerName, fileName)
+}
+
 func (aw *AWSCloudStorageProxy) CreateContainerIfNotExists(ctx context.Context, containerName string) error {
 	_, err := aw.s3ServicesClient.CreateBucket(ctx, &s3.CreateBucketInput{
 		Bucket: aws.String(containerName),
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
@@ -13,17 +14,27 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/lease"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake/service"
 	"github.com/google/uuid"
 	"golang.org/x/net/context"
 	"io"
 	"lib-cloud-proxy-go/util"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+// a block blob can have up to max_BLOCKS blocks of up to size_MAXBLOCK
+const (
+	max_BLOCKS    = 50000
+	size_MAXBLOCK = 4000 * 1024 * 1024
+)
+
 type AzureCloudStorageProxy struct {
 	blobServiceClient *azblob.Client
 }
@@ -31,7 +42,7 @@ type AzureCloudStorageProxy struct {
 func (handler ProxyAuthHandlerAzureDefaultIdentity) createProxy() (CloudStorageProxy, error) {
 	credential, err := azidentity.NewDefaultAzureCredential(nil)
 	if err == nil {
-		return createProxyFromCredential(handler.AccountURL, credential)
+		return createProxyFromCredential(handler.AccountURL, credential, handler.HierarchicalNamespace)
 	}
 	return nil, err
 }
@@ -40,26 +51,39 @@ func (handler ProxyAuthHandlerAzureClientSecretIdentity) createProxy() (CloudSto
 	credential, err := azidentity.NewClientSecretCredential(handler.TenantID, handler.ClientID,
 		handler.ClientSecret, nil)
 	if err == nil {
-		return createProxyFromCredential(handler.AccountURL, credential)
+		return createProxyFromCredential(handler.AccountURL, credential, handler.HierarchicalNamespace)
 	}
 	return nil, err
 }
 
-func createProxyFromCredential(accountURL string, credential azcore.TokenCredential) (CloudStorageProxy, error) {
+func createProxyFromCredential(accountURL string, credential azcore.TokenCredential, hierarchicalNamespace bool) (CloudStorageProxy, error) {
 	client, err := azblob.NewClient(accountURL, credential, nil)
-	if err == nil {
-		return &AzureCloudStorageProxy{blobServiceClient: client}, nil
+	if err != nil {
+		return nil, wrapError("unable to create Azure Storage service client", err)
 	}
-	return nil, wrapError("unable to create Azure Storage service client", err)
-
+	if hierarchicalNamespace {
+		dataLakeClient, err := service.NewClient(accountURL, credential, nil)
+		if err != nil {
+			return nil, wrapError("unable to create Azure Data Lake service client", err)
+		}
+		return newDataLakeProxy(client, dataLakeClient), nil
+	}
+	return &AzureCloudStorageProxy{blobServiceClient: client}, nil
 }
 
 func (handler ProxyAuthHandlerAzureConnectionString) createProxy() (CloudStorageProxy, error) {
 	client, err := azblob.NewClientFromConnectionString(handler.ConnectionString, nil)
-	if err == nil {
-		return &AzureCloudStorageProxy{blobServiceClient: client}, nil
+	if err != nil {
+		return nil, wrapError("unable to create Azure Storage service client", err)
 	}
-	return nil, wrapError("unable to create Azure Storage service client", err)
+	if handler.HierarchicalNamespace {
+		dataLakeClient, err := service.NewClientFromConnectionString(handler.ConnectionString, nil)
+		if err != nil {
+			return nil, wrapError("unable to create Azure Data Lake service client", err)
+		}
+		return newDataLakeProxy(client, dataLakeClient), nil
+	}
+	return &AzureCloudStorageProxy{blobServiceClient: client}, nil
 }
 
 func (handler ProxyAuthHandlerAzureSASToken) createProxy() (CloudStorageProxy, error) {
@@ -92,10 +116,18 @@ func (handler ProxyAuthHandlerAzureSASToken) createProxy() (CloudStorageProxy, e
 	)
 
 	client, err := azblob.NewClientWithNoCredential(sasURL, nil)
-	if err == nil {
-		return &AzureCloudStorageProxy{blobServiceClient: client}, nil
+	if err != nil {
+		return nil, wrapError("unable to create Azure Storage service client", err)
 	}
-	return nil, wrapError("unable to create Azure Storage service client", err)
+	if handler.HierarchicalNamespace {
+		// an account SAS is valid for both the blob and dfs endpoints
+		dataLakeClient, err := service.NewClientWithNoCredential(sasURL, nil)
+		if err != nil {
+			return nil, wrapError("unable to create Azure Data Lake service client", err)
+		}
+		return newDataLakeProxy(client, dataLakeClient), nil
+	}
+	return &AzureCloudStorageProxy{blobServiceClient: client}, nil
 }
 
 func (az *AzureCloudStorageProxy) listFilesOrFolders(ctx context.Context, containerName string,
@@ -115,6 +147,9 @@ func (az *AzureCloudStorageProxy) listFilesOrFolders(ctx context.Context, contai
 		if err == nil {
 			if listType == listTypeFile {
 				for _, file := range resp.Segment.BlobItems {
+					if isFolderMarker(file) {
+						continue
+					}
 					if len(resultsList) < maxNumber {
 						resultsList = append(resultsList, *file.Name)
 					} else {
@@ -123,9 +158,19 @@ func (az *AzureCloudStorageProxy) listFilesOrFolders(ctx context.Context, contai
 					}
 				}
 			} else {
+				folders := make([]string, 0, len(resp.Segment.BlobPrefixes))
 				for _, folder := range resp.Segment.BlobPrefixes {
+					folders = append(folders, *folder.Name)
+				}
+				// with a hierarchical namespace, empty directories are only listed as folder marker blobs
+				for _, file := range resp.Segment.BlobItems {
+					if isFolderMarker(file) && !slices.Contains(folders, *file.Name+"/") {
+						folders = append(folders, *file.Name+"/")
+					}
+				}
+				for _, folder := range folders {
 					if len(resultsList) < maxNumber {
-						resultsList = append(resultsList, *folder.Name)
+						resultsList = append(resultsList, folder)
 					} else {
 						maxReached = true
 						break
@@ -140,6 +185,17 @@ func (az *AzureCloudStorageProxy) listFilesOrFolders(ctx context.Context, contai
 	return resultsList, nil
 }
 
+// isFolderMarker reports whether a blob is the placeholder that represents a directory
+// in an account with a hierarchical namespace
+func isFolderMarker(item *container.BlobItem) bool {
+	for key, value := range item.Metadata {
+		if strings.EqualFold(key, "hdi_isfolder") && value != nil && strings.EqualFold(*value, "true") {
+			return true
+		}
+	}
+	return false
+}
+
 func (az *AzureCloudStorageProxy) ListFiles(ctx context.Context, containerName string, maxNumber int, prefix string) ([]string, error) {
 	return az.listFilesOrFolders(ctx, containerName, maxNumber, prefix, listTypeFile)
 }
@@ -148,8 +204,117 @@ func (az *AzureCloudStorageProxy) ListFolders(ctx context.Context, containerName
 	return az.listFilesOrFolders(ctx, containerName, maxNumber, prefix, listTypeFolder)
 }
 
-func (az *AzureCloudStorageProxy) GetFile(ctx context.Context, containerName string, fileName string) (CloudFile, error) {
-	content, metadata, err := az.getFileContentAndMetadata(ctx, containerName, fileName)
+func (az *AzureCloudStorageProxy) ListObjects(ctx context.Context, containerName string, maxNumber int, prefix string,
+	includeMetadata bool) ([]ObjectInfo, error) {
+	if maxNumber <= 0 {
+		maxNumber = max_RESULT
+	}
+	objects := make([]ObjectInfo, 0)
+	containerClient := az.blobServiceClient.ServiceClient().NewContainerClient(containerName)
+	// metadata is always requested, since it is needed to recognize folder markers
+	pager := containerClient.NewListBlobsHierarchyPager("/", &container.ListBlobsHierarchyOptions{
+		Include: azblob.ListBlobsInclude{Metadata: true},
+		Prefix:  &prefix,
+	})
+	for pager.More() && len(objects) < maxNumber {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return objects, wrapError("Error listing contents of container", err)
+		}
+		for _, file := range resp.Segment.BlobItems {
+			if isFolderMarker(file) {
+				continue
+			}
+			if len(objects) >= maxNumber {
+				break
+			}
+			objects = append(objects, readObjectInfo(file, includeMetadata))
+		}
+	}
+	return objects, nil
+}
+
+func (az *AzureCloudStorageProxy) ListObjectsPage(ctx context.Context, containerName string,
+	options ListOptions) (ObjectPage, error) {
+	page := ObjectPage{Objects: make([]ObjectInfo, 0), Folders: make([]string, 0)}
+	containerClient := az.blobServiceClient.ServiceClient().NewContainerClient(containerName)
+	include := azblob.ListBlobsInclude{Metadata: true}
+	maxResults := int32(min(options.pageSize(), 5000))
+	var marker *string
+	if options.PageToken != "" {
+		marker = &options.PageToken
+	}
+	var blobItems []*container.BlobItem
+	if options.Recursive {
+		resp, err := containerClient.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{
+			Include:    include,
+			Marker:     marker,
+			MaxResults: &maxResults,
+			Prefix:     &options.Prefix,
+		}).NextPage(ctx)
+		if err != nil {
+			return page, wrapError("Error listing contents of container", err)
+		}
+		blobItems = resp.Segment.BlobItems
+		page.ContinuationToken = valueOrZero(resp.NextMarker)
+	} else {
+		resp, err := containerClient.NewListBlobsHierarchyPager("/", &container.ListBlobsHierarchyOptions{
+			Include:    include,
+			Marker:     marker,
+			MaxResults: &maxResults,
+			Prefix:     &options.Prefix,
+		}).NextPage(ctx)
+		if err != nil {
+			return page, wrapError("Error listing contents of container", err)
+		}
+		blobItems = resp.Segment.BlobItems
+		for _, prefix := range resp.Segment.BlobPrefixes {
+			page.Folders = append(page.Folders, *prefix.Name)
+		}
+		page.ContinuationToken = valueOrZero(resp.NextMarker)
+	}
+	for _, file := range blobItems {
+		if !isFolderMarker(file) {
+			page.Objects = append(page.Objects, readObjectInfo(file, options.IncludeMetadata))
+		} else if !options.Recursive && !slices.Contains(page.Folders, *file.Name+"/") {
+			// empty directories only show up as folder markers
+			page.Folders = append(page.Folders, *file.Name+"/")
+		}
+	}
+	sort.Strings(page.Folders)
+	return page, nil
+}
+
+func valueOrZero[T any](value *T) T {
+	var zero T
+	if value == nil {
+		return zero
+	}
+	return *value
+}
+
+func readObjectInfo(item *container.BlobItem, includeMetadata bool) ObjectInfo {
+	object := ObjectInfo{Name: *item.Name}
+	if properties := item.Properties; properties != nil {
+		object.Size = valueOrZero(properties.ContentLength)
+		object.LastModified = valueOrZero(properties.LastModified)
+		object.ContentType = valueOrZero(properties.ContentType)
+		if properties.ETag != nil {
+			object.ETag = string(*properties.ETag)
+		}
+		if properties.AccessTier != nil {
+			object.StorageTier = string(*properties.AccessTier)
+		}
+	}
+	if includeMetadata {
+		object.Metadata = readMetadata(item.Metadata)
+	}
+	return object
+}
+
+func (az *AzureCloudStorageProxy) GetFile(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) (CloudFile, error) {
+	content, metadata, err := az.getFileContentAndMetadata(ctx, containerName, fileName, applyFileOptions(options))
 	file := CloudFile{Container: containerName,
 		FileName: fileName,
 		Metadata: metadata,
@@ -158,21 +323,44 @@ func (az *AzureCloudStorageProxy) GetFile(ctx context.Context, containerName str
 }
 
 func (az *AzureCloudStorageProxy) GetFileContentAsString(ctx context.Context, containerName string, fileName string) (string, error) {
-	content, _, err := az.getFileContentAndMetadata(ctx, containerName, fileName)
+	content, _, err := az.getFileContentAndMetadata(ctx, containerName, fileName, fileOptions{})
 	return content, err
 }
 
+// blobClient returns the client of a blob, or of one of its versions
+func (az *AzureCloudStorageProxy) blobClient(containerName string, fileName string, options fileOptions) (*blob.Client, error) {
+	blobClient := az.blobServiceClient.ServiceClient().NewContainerClient(containerName).NewBlobClient(fileName)
+	if options.versionID == "" {
+		return blobClient, nil
+	}
+	versionClient, err := blobClient.WithVersionID(options.versionID)
+	if err != nil {
+		return nil, wrapError("invalid version "+options.versionID+" of blob "+fileName, err)
+	}
+	return versionClient, nil
+}
+
 func (az *AzureCloudStorageProxy) getFileContentAndMetadata(ctx context.Context, containerName string,
-	fileName string) (string, map[string]string, error) {
+	fileName string, options fileOptions) (string, map[string]string, error) {
 
 	metadata := make(map[string]string)
-	streamResp, err := az.blobServiceClient.DownloadStream(ctx, containerName, fileName, nil)
+	blobClient, err := az.blobClient(containerName, fileName, options)
+	if err != nil {
+		return "", metadata, err
+	}
+	streamResp, err := blobClient.DownloadStream(ctx, nil)
 	if err != nil {
 		return "", metadata, wrapError("Unable to get file content", err)
 	} else {
 		metadata = readMetadata(streamResp.Metadata)
 		metadata["last_modified"] = streamResp.LastModified.Format(time_FORMAT)
 		metadata["content_length"] = strconv.Itoa(int(*streamResp.ContentLength))
+		metadata["etag"] = string(valueOrZero(streamResp.ETag))
+		if streamResp.VersionID != nil {
+			metadata["version_id"] = *streamResp.VersionID
+		}
+		readHTTPHeaders(streamResp.ContentType, streamResp.ContentEncoding, streamResp.ContentLanguage,
+			streamResp.ContentDisposition, streamResp.CacheControl).addTo(metadata)
 		data := bytes.Buffer{}
 		retryReader := streamResp.NewRetryReader(ctx, &azblob.RetryReaderOptions{})
 		_, err := data.ReadFrom(retryReader)
@@ -183,13 +371,44 @@ func (az *AzureCloudStorageProxy) getFileContentAndMetadata(ctx context.Context,
 	}
 }
 
-func (az *AzureCloudStorageProxy) GetFileContentAsInputStream(ctx context.Context, containerName string, fileName string) (io.ReadCloser, error) {
-	streamResp, err := az.blobServiceClient.DownloadStream(ctx, containerName, fileName, nil)
+func (az *AzureCloudStorageProxy) GetFileContentAsInputStream(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) (io.ReadCloser, error) {
+	blobClient, err := az.blobClient(containerName, fileName, applyFileOptions(options))
+	if err != nil {
+		return nil, err
+	}
+	streamResp, err := blobClient.DownloadStream(ctx, nil)
 	if err == nil {
 		return streamResp.NewRetryReader(ctx, &azblob.RetryReaderOptions{}), nil
 	} else {
+		return nil, wrapError("unable to download blob "+fileName, err)
+	}
+}
+
+// GetFileRange accepts WithVersion and IfMatch
+func (az *AzureCloudStorageProxy) GetFileRange(ctx context.Context, containerName string, fileName string, offset int64,
+	length int64, options ...FileOption) (io.ReadCloser, error) {
+	if err := checkRange(fileName, offset, length); err != nil {
+		return nil, err
+	}
+	applied := applyFileOptions(options)
+	blobClient, err := az.blobClient(containerName, fileName, applied)
+	if err != nil {
 		return nil, err
 	}
+	// a count of 0 reads to the end of the blob
+	streamResp, err := blobClient.DownloadStream(ctx, &blob.DownloadStreamOptions{
+		Range:            blob.HTTPRange{Offset: offset, Count: max(length, 0)},
+		AccessConditions: accessConditions(applied),
+	})
+	if err != nil {
+		return nil, wrapConditionalError("unable to get range of blob "+fileName, err, applied)
+	}
+	return streamResp.NewRetryReader(ctx, &azblob.RetryReaderOptions{}), nil
+}
+
+func (az *AzureCloudStorageProxy) OpenReader(ctx context.Context, containerName string, fileName string) (*FileReader, error) {
+	return openReader(ctx, az, containerName, fileName)
 }
 
 func (az *AzureCloudStorageProxy) GetLargeFileContentAsByteArray(ctx context.Context, containerName string, fileName string, fileSize int64, concurrency int) ([]byte, error) {
@@ -224,12 +443,27 @@ func (az *AzureCloudStorageProxy) GetMetadata(ctx context.Context, containerName
 		props = readMetadata(resp.Metadata)
 		props["last_modified"] = resp.LastModified.Format(time_FORMAT)
 		props["content_length"] = strconv.Itoa(int(*resp.ContentLength))
+		props["etag"] = string(valueOrZero(resp.ETag))
+		if resp.VersionID != nil {
+			props["version_id"] = *resp.VersionID
+		}
+		if len(resp.ContentMD5) > 0 {
+			props["content_md5"] = base64.StdEncoding.EncodeToString(resp.ContentMD5)
+		}
+		readHTTPHeaders(resp.ContentType, resp.ContentEncoding, resp.ContentLanguage, resp.ContentDisposition,
+			resp.CacheControl).addTo(props)
 	} else {
 		return props, wrapError("Error getting blob metadata", err)
 	}
 	return props, nil
 }
 
+func (az *AzureCloudStorageProxy) Exists(ctx context.Context, containerName string, fileName string) (bool, error) {
+	blobClient := az.blobServiceClient.ServiceClient().NewContainerClient(containerName).NewBlobClient(fileName)
+	_, err := blobClient.GetProperties(ctx, nil)
+	return existsResult(fileName, err)
+}
+
 func readMetadata(metadata map[string]*string) map[string]string {
 	props := make(map[string]string)
 	for key, value := range metadata {
@@ -250,52 +484,290 @@ func writeMetadata(metadata map[string]string) map[string]*string {
 	return props
 }
 
+func readHTTPHeaders(contentType *string, contentEncoding *string, contentLanguage *string,
+	contentDisposition *string, cacheControl *string) contentHeaders {
+	return contentHeaders{
+		ContentType:        valueOrZero(contentType),
+		ContentEncoding:    valueOrZero(contentEncoding),
+		ContentLanguage:    valueOrZero(contentLanguage),
+		ContentDisposition: valueOrZero(contentDisposition),
+		CacheControl:       valueOrZero(cacheControl),
+	}
+}
+
+// writeMetadataAndHeaders splits the content headers out of the metadata, since Azure sets them as blob properties
+func writeMetadataAndHeaders(metadata map[string]string) (map[string]*string, *blob.HTTPHeaders) {
+	metadata, headers := splitContentHeaders(metadata)
+	httpHeaders := &blob.HTTPHeaders{}
+	if headers.ContentType != "" {
+		httpHeaders.BlobContentType = to.Ptr(headers.ContentType)
+	}
+	if headers.ContentEncoding != "" {
+		httpHeaders.BlobContentEncoding = to.Ptr(headers.ContentEncoding)
+	}
+	if headers.ContentLanguage != "" {
+		httpHeaders.BlobContentLanguage = to.Ptr(headers.ContentLanguage)
+	}
+	if headers.ContentDisposition != "" {
+		httpHeaders.BlobContentDisposition = to.Ptr(headers.ContentDisposition)
+	}
+	if headers.CacheControl != "" {
+		httpHeaders.BlobCacheControl = to.Ptr(headers.CacheControl)
+	}
+	return writeMetadata(metadata), httpHeaders
+}
+
+// accessConditions turns IfMatch and IfNoneMatch into the access conditions of a request, or nil when there are none
+func accessConditions(options fileOptions) *blob.AccessConditions {
+	if !options.hasConditions() {
+		return nil
+	}
+	conditions := &blob.ModifiedAccessConditions{}
+	if options.ifMatch != "" {
+		conditions.IfMatch = to.Ptr(azcore.ETag(options.ifMatch))
+	}
+	if options.ifNoneMatch != "" {
+		conditions.IfNoneMatch = to.Ptr(azcore.ETag(options.ifNoneMatch))
+	}
+	return &blob.AccessConditions{ModifiedAccessConditions: conditions}
+}
+
+// UploadFileFromString returns the ETag of the new blob, and accepts IfMatch and IfNoneMatch
 func (az *AzureCloudStorageProxy) UploadFileFromString(ctx context.Context, containerName string, fileName string,
-	metadata map[string]string, content string) error {
+	metadata map[string]string, content string, options ...FileOption) (string, error) {
 	contentReader := strings.NewReader(content)
-	_, err := az.blobServiceClient.UploadStream(ctx, containerName, fileName, contentReader, &azblob.UploadStreamOptions{
-		Metadata: writeMetadata(metadata),
+	blobMetadata, httpHeaders := writeMetadataAndHeaders(metadata)
+	applied := applyFileOptions(options)
+	resp, err := az.blobServiceClient.UploadStream(ctx, containerName, fileName, contentReader, &azblob.UploadStreamOptions{
+		Metadata:         blobMetadata,
+		HTTPHeaders:      httpHeaders,
+		AccessConditions: accessConditions(applied),
 	})
 	if err != nil {
-		return wrapError("unable to save file from text", err)
+		return "", wrapConditionalError("unable to save file from text", err, applied)
 	} else {
-		return nil
+		return string(valueOrZero(resp.ETag)), nil
 	}
 }
 
+// UploadFileFromInputStream returns the ETag of the new blob, and accepts IfMatch and IfNoneMatch
 func (az *AzureCloudStorageProxy) UploadFileFromInputStream(ctx context.Context, containerName string, fileName string, metadata map[string]string,
-	inputStream io.Reader, fileSizeBytes int64, concurrency int) error {
+	inputStream io.Reader, fileSizeBytes int64, concurrency int, options ...FileOption) (string, error) {
+	if fileSizeBytes < 0 {
+		return uploadStream(ctx, az, containerName, fileName, metadata, inputStream, concurrency, options)
+	}
 	if concurrency <= 0 {
 		concurrency = 5
 	}
+	// blocks of 5 MiB allow for about 244 GiB, so larger blobs need larger blocks
+	blockSize := max(size_5MiB, (fileSizeBytes+max_BLOCKS-1)/max_BLOCKS)
 
-	_, err := az.blobServiceClient.UploadStream(ctx, containerName, fileName, inputStream, &azblob.UploadStreamOptions{
-		BlockSize:   size_5MiB,
-		Concurrency: concurrency,
-		Metadata:    writeMetadata(metadata),
+	blobMetadata, httpHeaders := writeMetadataAndHeaders(metadata)
+	applied := applyFileOptions(options)
+	resp, err := az.blobServiceClient.UploadStream(ctx, containerName, fileName, inputStream, &azblob.UploadStreamOptions{
+		BlockSize:        blockSize,
+		Concurrency:      concurrency,
+		Metadata:         blobMetadata,
+		HTTPHeaders:      httpHeaders,
+		AccessConditions: accessConditions(applied),
 	})
 	if err != nil {
-		return wrapError("unable to save file from input stream", err)
+		return "", wrapConditionalError("unable to save file from input stream", err, applied)
 	} else {
-		return nil
+		return string(valueOrZero(resp.ETag)), nil
+	}
+}
+
+// OpenWriter uploads the parts of the file as staged blocks, which Close commits as the block list of the blob
+func (az *AzureCloudStorageProxy) OpenWriter(ctx context.Context, containerName string, fileName string,
+	options WriterOptions) (*FileWriter, error) {
+	metadata, httpHeaders := writeMetadataAndHeaders(options.Metadata)
+	uploader := &azureBlockUploader{
+		client:   az.blobServiceClient.ServiceClient().NewContainerClient(containerName).NewBlockBlobClient(fileName),
+		fileName: fileName,
+		// blocks staged by other writers of the same blob must have other IDs
+		prefix:      uuid.NewString(),
+		metadata:    metadata,
+		httpHeaders: httpHeaders,
+		options:     applyFileOptions(options.FileOptions),
+	}
+	return newFileWriter(ctx, fileName, uploader, options.partSize(), options.concurrency(),
+		partLimits{maxParts: max_BLOCKS, maxPartSize: size_MAXBLOCK, maxSize: max_BLOCKS * size_MAXBLOCK}), nil
+}
+
+type azureBlockUploader struct {
+	client      *blockblob.Client
+	fileName    string
+	prefix      string
+	metadata    map[string]*string
+	httpHeaders *blob.HTTPHeaders
+	options     fileOptions
+}
+
+// blockID returns the ID of a block, which must have the same length for every block of a blob
+func (uploader *azureBlockUploader) blockID(number int) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s-%05d", uploader.prefix, number)))
+}
+
+func (uploader *azureBlockUploader) uploadPart(ctx context.Context, number int, data []byte) error {
+	_, err := uploader.client.StageBlock(ctx, uploader.blockID(number), streaming.NopCloser(bytes.NewReader(data)), nil)
+	if err != nil {
+		return wrapError(fmt.Sprintf("unable to stage block %d of blob %s", number, uploader.fileName), err)
+	}
+	return nil
+}
+
+func (uploader *azureBlockUploader) commit(ctx context.Context, parts int) (string, error) {
+	blockIDs := make([]string, parts)
+	for i := range blockIDs {
+		blockIDs[i] = uploader.blockID(i + 1)
+	}
+	resp, err := uploader.client.CommitBlockList(ctx, blockIDs, &blockblob.CommitBlockListOptions{
+		HTTPHeaders:      uploader.httpHeaders,
+		Metadata:         uploader.metadata,
+		AccessConditions: accessConditions(uploader.options),
+	})
+	if err != nil {
+		return "", wrapConditionalError("unable to commit blocks of blob "+uploader.fileName, err, uploader.options)
+	}
+	return string(valueOrZero(resp.ETag)), nil
+}
+
+// abort discards the staged blocks, which Azure otherwise keeps for a week, by committing the blocks the blob
+// already has, with its properties and metadata. A blob that did not exist is committed empty and deleted again. A
+// blob that was not uploaded as blocks cannot be committed as it is, and its staged blocks are left to expire.
+func (uploader *azureBlockUploader) abort(ctx context.Context) {
+	props, err := uploader.client.GetProperties(ctx, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		resp, err := uploader.client.CommitBlockList(ctx, nil, &blockblob.CommitBlockListOptions{
+			AccessConditions: &blob.AccessConditions{ModifiedAccessConditions: &blob.ModifiedAccessConditions{
+				IfNoneMatch: to.Ptr(azcore.ETagAny),
+			}},
+		})
+		if err == nil {
+			_, _ = uploader.client.Delete(ctx, &blob.DeleteOptions{AccessConditions: &blob.AccessConditions{
+				ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfMatch: resp.ETag},
+			}})
+		}
+		return
+	}
+	if err != nil {
+		return
+	}
+	current := &blob.AccessConditions{ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfMatch: props.ETag}}
+	blocks, err := uploader.client.GetBlockList(ctx, blockblob.BlockListTypeCommitted,
+		&blockblob.GetBlockListOptions{AccessConditions: current})
+	if err != nil {
+		return
+	}
+	var blockIDs []string
+	var size int64
+	for _, block := range blocks.BlockList.CommittedBlocks {
+		blockIDs = append(blockIDs, valueOrZero(block.Name))
+		size += valueOrZero(block.Size)
+	}
+	if size != valueOrZero(props.ContentLength) {
+		return
+	}
+	httpHeaders := blob.ParseHTTPHeaders(props)
+	_, _ = uploader.client.CommitBlockList(ctx, blockIDs, &blockblob.CommitBlockListOptions{
+		HTTPHeaders:      &httpHeaders,
+		Metadata:         props.Metadata,
+		AccessConditions: current,
+	})
+}
+
+// DeleteFile accepts WithVersion and IfMatch
+func (az *AzureCloudStorageProxy) DeleteFile(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) error {
+	applied := applyFileOptions(options)
+	blobClient, err := az.blobClient(containerName, fileName, applied)
+	if err != nil {
+		return err
+	}
+	_, err = blobClient.Delete(ctx, &blob.DeleteOptions{AccessConditions: accessConditions(applied)})
+	if err != nil {
+		return wrapConditionalError("unable to delete blob", err, applied)
+	}
+	return nil
+}
+
+// DeleteFiles deletes up to 256 blobs per batch request. If a request fails as a whole, every blob in it is
+// reported with that error, and the first such error is also returned. A blob that the batch response does not
+// answer for is reported with an error as well.
+func (az *AzureCloudStorageProxy) DeleteFiles(ctx context.Context, containerName string,
+	fileNames []string) ([]FileResult, error) {
+	results := make([]FileResult, len(fileNames))
+	containerClient := az.blobServiceClient.ServiceClient().NewContainerClient(containerName)
+	var firstErr error
+	for start := 0; start < len(fileNames); start += 256 {
+		batch := fileNames[start:min(start+256, len(fileNames))]
+		for i, fileName := range batch {
+			results[start+i].Name = fileName
+		}
+		err := az.submitDeleteBatch(ctx, containerClient, batch, results[start:start+len(batch)])
+		if err != nil {
+			err = wrapError("unable to delete blobs from container "+containerName, err)
+			for i := range batch {
+				results[start+i].Err = err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
 	}
+	return results, firstErr
 }
 
-func (az *AzureCloudStorageProxy) DeleteFile(ctx context.Context, containerName string, fileName string) error {
-	_, err := az.blobServiceClient.DeleteBlob(ctx, containerName, fileName, nil)
+func (az *AzureCloudStorageProxy) submitDeleteBatch(ctx context.Context, containerClient *container.Client,
+	fileNames []string, results []FileResult) error {
+	batchBuilder, err := containerClient.NewBatchBuilder()
+	if err != nil {
+		return err
+	}
+	for _, fileName := range fileNames {
+		if err := batchBuilder.Delete(fileName, nil); err != nil {
+			return err
+		}
+	}
+	resp, err := containerClient.SubmitBatch(ctx, batchBuilder, nil)
 	if err != nil {
-		return wrapError("unable to delete blob", err)
+		return err
+	}
+	// the content ID of each response is the index of its sub-request
+	answered := make([]bool, len(results))
+	for _, item := range resp.Responses {
+		if item.ContentID == nil || *item.ContentID < 0 || *item.ContentID >= len(results) {
+			continue
+		}
+		answered[*item.ContentID] = true
+		if item.Error != nil && !bloberror.HasCode(item.Error, bloberror.BlobNotFound) {
+			results[*item.ContentID].Err = wrapError("unable to delete blob "+results[*item.ContentID].Name, item.Error)
+		}
+	}
+	// a blob without a response of its own may not have been deleted
+	for i, result := range results {
+		if !answered[i] {
+			results[i].Err = &CloudStorageError{message: "no response to the deletion of blob " + result.Name}
+		}
 	}
 	return nil
 }
 
+func (az *AzureCloudStorageProxy) DeletePrefix(ctx context.Context, containerName string, prefix string,
+	concurrency int) ([]FileResult, error) {
+	return deletePrefix(ctx, az, containerName, prefix, concurrency)
+}
+
 func (az *AzureCloudStorageProxy) copyFileFromSignedURL(ctx context.Context, sourceSignedURL string, destContainer string,
 	destFile string, metadata map[string]string) error {
 	destBlob := az.blobServiceClient.ServiceClient().NewContainerClient(destContainer).NewBlockBlobClient(destFile)
 
+	blobMetadata, httpHeaders := writeMetadataAndHeaders(metadata)
 	_, e := destBlob.UploadBlobFromURL(ctx, sourceSignedURL,
 		&blockblob.UploadBlobFromURLOptions{
-			Metadata: writeMetadata(metadata),
+			Metadata:    blobMetadata,
+			HTTPHeaders: httpHeaders,
 		})
 
 	if e != nil {
@@ -327,10 +799,22 @@ func (az *AzureCloudStorageProxy) CopyFileFromRemoteStorage(ctx context.Context,
 		return err
 	}
 	length := getStringAsInt64(metadata["content_length"])
+	metadata = userMetadata(metadata)
 	url, er := s.GetSourceBlobSignedURL(ctx, sourceContainer, sourceFile)
 	if er != nil {
 		return er
 	}
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		// the Azure service cannot reach the source (e.g. a file:// url from local storage),
+		// so the content is streamed through this process instead of copied server-side
+		inputStream, err := s.GetFileContentAsInputStream(ctx, sourceContainer, sourceFile)
+		if err != nil {
+			return wrapError("unable to read source file as stream", err)
+		}
+		defer inputStream.Close()
+		_, err = az.UploadFileFromInputStream(ctx, destContainer, destFile, metadata, inputStream, length, concurrency)
+		return err
+	}
 	if length < size_LARGEOBJECT {
 		return az.copyFileFromSignedURL(ctx, url, destContainer, destFile, metadata)
 	} else {
@@ -397,8 +881,9 @@ func (az *AzureCloudStorageProxy) CopyFileFromRemoteStorage(ctx context.Context,
 		default:
 			// no error was encountered
 		}
+		blobMetadata, httpHeaders := writeMetadataAndHeaders(metadata)
 		_, err = blockBlobClient.CommitBlockList(ctx, blockIDs,
-			&blockblob.CommitBlockListOptions{Metadata: writeMetadata(metadata)})
+			&blockblob.CommitBlockListOptions{Metadata: blobMetadata, HTTPHeaders: httpHeaders})
 		if err != nil {
 			return wrapError("unable to commit blocks", err)
 		}
@@ -412,6 +897,313 @@ func (az *AzureCloudStorageProxy) CopyFileFromLocalStorage(ctx context.Context,
 	return az.CopyFileFromRemoteStorage(ctx, sourceContainer, sourceFile, destContainer, destFile, &s, concurrency)
 }
 
+func (az *AzureCloudStorageProxy) MoveFile(ctx context.Context, sourceContainer string, sourceFile string,
+	destContainer string, destFile string) error {
+	return moveFile(ctx, az, sourceContainer, sourceFile, destContainer, destFile)
+}
+
+func (az *AzureCloudStorageProxy) MovePrefix(ctx context.Context, sourceContainer string, sourcePrefix string,
+	destContainer string, destPrefix string, concurrency int) ([]FileResult, error) {
+	return movePrefix(ctx, az, sourceContainer, sourcePrefix, destContainer, destPrefix, concurrency)
+}
+
+func (az *AzureCloudStorageProxy) GetTags(ctx context.Context, containerName string, fileName string) (map[string]string, error) {
+	blobClient := az.blobServiceClient.ServiceClient().NewContainerClient(containerName).NewBlobClient(fileName)
+	resp, err := blobClient.GetTags(ctx, nil)
+	if err != nil {
+		return nil, wrapError("unable to get tags for blob "+fileName, err)
+	}
+	return readTags(resp.BlobTagSet), nil
+}
+
+func readTags(tagSet []*blob.Tags) map[string]string {
+	tags := make(map[string]string, len(tagSet))
+	for _, tag := range tagSet {
+		tags[valueOrZero(tag.Key)] = valueOrZero(tag.Value)
+	}
+	return tags
+}
+
+// SetTags replaces all the blob index tags of a blob; Azure allows up to 10
+func (az *AzureCloudStorageProxy) SetTags(ctx context.Context, containerName string, fileName string,
+	tags map[string]string) error {
+	blobClient := az.blobServiceClient.ServiceClient().NewContainerClient(containerName).NewBlobClient(fileName)
+	if _, err := blobClient.SetTags(ctx, tags, nil); err != nil {
+		return wrapError("unable to set tags for blob "+fileName, err)
+	}
+	return nil
+}
+
+// FindFilesByTags queries the blob index of the container. The index is updated asynchronously,
+// so a blob can take a moment to be found after its tags are set.
+func (az *AzureCloudStorageProxy) FindFilesByTags(ctx context.Context, containerName string, prefix string,
+	tags map[string]string) ([]string, error) {
+	matches := make([]string, 0)
+	if err := checkTagQuery(containerName, tags); err != nil {
+		return matches, err
+	}
+	where, err := tagFilterExpression(tags)
+	if err != nil {
+		return matches, err
+	}
+	containerClient := az.blobServiceClient.ServiceClient().NewContainerClient(containerName)
+	var marker *string
+	for {
+		resp, err := containerClient.FilterBlobs(ctx, where, &container.FilterBlobsOptions{Marker: marker})
+		if err != nil {
+			return matches, wrapError("unable to find blobs by tags in container "+containerName, err)
+		}
+		for _, item := range resp.Blobs {
+			if name := valueOrZero(item.Name); strings.HasPrefix(name, prefix) {
+				matches = append(matches, name)
+			}
+		}
+		if valueOrZero(resp.NextMarker) == "" {
+			break
+		}
+		marker = resp.NextMarker
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// tagFilterExpression matches every tag of a query. The keys and values are checked against the characters that
+// Azure allows in tags, which include no quotes, so they need no escaping.
+func tagFilterExpression(tags map[string]string) (string, error) {
+	conditions := make([]string, 0, len(tags))
+	for key, value := range tags {
+		if len(key) == 0 || len(key) > 128 || !validTagText(key) {
+			return "", &CloudStorageError{message: "invalid tag key " + key}
+		}
+		if len(value) > 256 || !validTagText(value) {
+			return "", &CloudStorageError{message: "invalid value " + value + " of tag " + key}
+		}
+		conditions = append(conditions, fmt.Sprintf(`"%s" = '%s'`, key, value))
+	}
+	sort.Strings(conditions)
+	return strings.Join(conditions, " AND "), nil
+}
+
+// validTagText reports whether a tag key or value has only letters, digits, spaces and the characters + - . / : = _
+func validTagText(text string) bool {
+	for _, c := range text {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.ContainsRune(" +-./:=_", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ListFileVersions lists the versions of a blob in an account with blob versioning enabled. Azure keeps no delete
+// markers: a deleted blob has no current version, but its earlier versions are listed.
+func (az *AzureCloudStorageProxy) ListFileVersions(ctx context.Context, containerName string,
+	fileName string) ([]FileVersion, error) {
+	versions := make([]FileVersion, 0)
+	containerClient := az.blobServiceClient.ServiceClient().NewContainerClient(containerName)
+	pager := containerClient.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{
+		Include: container.ListBlobsInclude{Versions: true},
+		Prefix:  &fileName,
+	})
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return versions, wrapError("unable to list versions of blob "+fileName, err)
+		}
+		for _, item := range resp.Segment.BlobItems {
+			// the prefix also matches longer names
+			if valueOrZero(item.Name) != fileName {
+				continue
+			}
+			versions = append(versions, FileVersion{
+				ObjectInfo: readObjectInfo(item, false),
+				VersionID:  valueOrZero(item.VersionID),
+				// without versioning the blob is listed once, as the current version
+				IsCurrent: item.VersionID == nil || valueOrZero(item.IsCurrentVersion),
+			})
+		}
+	}
+	if len(versions) == 0 {
+		return versions, &CloudStorageError{message: "no versions found for blob " + fileName, kind: ErrNotFound}
+	}
+	sortVersions(versions)
+	return versions, nil
+}
+
+// RestoreFileVersion copies a version over the blob, so it becomes the current version. The copy is made by the
+// service, and this waits for it to complete.
+func (az *AzureCloudStorageProxy) RestoreFileVersion(ctx context.Context, containerName string, fileName string,
+	versionID string) error {
+	versionClient, err := az.blobClient(containerName, fileName, fileOptions{versionID: versionID})
+	if err != nil {
+		return err
+	}
+	blobClient := az.blobServiceClient.ServiceClient().NewContainerClient(containerName).NewBlobClient(fileName)
+	resp, err := blobClient.StartCopyFromURL(ctx, versionClient.URL(), nil)
+	if err != nil {
+		return wrapError("unable to restore version "+versionID+" of blob "+fileName, err)
+	}
+	status := valueOrZero(resp.CopyStatus)
+	for status == blob.CopyStatusTypePending {
+		select {
+		case <-ctx.Done():
+			return wrapError("unable to restore version "+versionID+" of blob "+fileName, ctx.Err())
+		case <-time.After(time.Second):
+		}
+		props, err := blobClient.GetProperties(ctx, nil)
+		if err != nil {
+			return wrapError("unable to restore version "+versionID+" of blob "+fileName, err)
+		}
+		status = valueOrZero(props.CopyStatus)
+	}
+	if status != blob.CopyStatusTypeSuccess {
+		return &CloudStorageError{message: fmt.Sprintf("restore of version %s of blob %s ended with status %s",
+			versionID, fileName, status)}
+	}
+	return nil
+}
+
+// checkSoftDelete fails for a storage account without blob soft delete, which is what keeps deleted blobs
+func (az *AzureCloudStorageProxy) checkSoftDelete(ctx context.Context, containerName string) error {
+	resp, err := az.blobServiceClient.ServiceClient().GetProperties(ctx, nil)
+	if err != nil {
+		return wrapError("unable to get the soft delete policy of the storage account", err)
+	}
+	if resp.DeleteRetentionPolicy == nil || !valueOrZero(resp.DeleteRetentionPolicy.Enabled) {
+		return recoveryNotEnabled(containerName, "blob soft delete")
+	}
+	return nil
+}
+
+// ListDeletedFiles lists the soft-deleted blobs under a prefix that have not been uploaded again since
+func (az *AzureCloudStorageProxy) ListDeletedFiles(ctx context.Context, containerName string,
+	prefix string) ([]DeletedFile, error) {
+	deleted := make([]DeletedFile, 0)
+	if err := az.checkSoftDelete(ctx, containerName); err != nil {
+		return deleted, err
+	}
+	live := make(map[string]bool)
+	newest := make(map[string]DeletedFile)
+	containerClient := az.blobServiceClient.ServiceClient().NewContainerClient(containerName)
+	pager := containerClient.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{
+		Include: container.ListBlobsInclude{Deleted: true},
+		Prefix:  &prefix,
+	})
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return deleted, wrapError("unable to list deleted blobs in container "+containerName, err)
+		}
+		for _, item := range resp.Segment.BlobItems {
+			if !valueOrZero(item.Deleted) {
+				live[*item.Name] = true
+				continue
+			}
+			file := DeletedFile{ObjectInfo: readObjectInfo(item, false)}
+			if item.Properties != nil {
+				file.DeletedTime = valueOrZero(item.Properties.DeletedTime)
+			}
+			if previous, ok := newest[*item.Name]; !ok || file.DeletedTime.After(previous.DeletedTime) {
+				newest[*item.Name] = file
+			}
+		}
+	}
+	for name, file := range newest {
+		if !live[name] {
+			deleted = append(deleted, file)
+		}
+	}
+	sortDeletedFiles(deleted)
+	return deleted, nil
+}
+
+// UndeleteFile restores a soft-deleted blob. A blob that is not deleted is left as it is.
+func (az *AzureCloudStorageProxy) UndeleteFile(ctx context.Context, containerName string, fileName string) error {
+	if err := az.checkSoftDelete(ctx, containerName); err != nil {
+		return err
+	}
+	blobClient := az.blobServiceClient.ServiceClient().NewContainerClient(containerName).NewBlobClient(fileName)
+	if _, err := blobClient.Undelete(ctx, nil); err != nil {
+		return wrapError("unable to undelete blob "+fileName, err)
+	}
+	// undeleting a blob that was never soft-deleted succeeds without restoring anything
+	exists, err := az.Exists(ctx, containerName, fileName)
+	if err != nil {
+		return wrapError("unable to undelete blob "+fileName, err)
+	}
+	if !exists {
+		return &CloudStorageError{message: "blob " + fileName + " has no soft-deleted data to recover", kind: ErrNotFound}
+	}
+	return nil
+}
+
+// leaseClient returns the client that leases a blob, with a new lease ID when leaseID is empty
+func (az *AzureCloudStorageProxy) leaseClient(containerName string, fileName string, leaseID string) (*lease.BlobClient, error) {
+	blobClient, err := az.blobClient(containerName, fileName, fileOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var options *lease.BlobClientOptions
+	if leaseID != "" {
+		options = &lease.BlobClientOptions{LeaseID: &leaseID}
+	}
+	leaseClient, err := lease.NewBlobClient(blobClient, options)
+	if err != nil {
+		return nil, wrapError("unable to lease blob "+fileName, err)
+	}
+	return leaseClient, nil
+}
+
+// AcquireLease leases a blob for between 15 and 60 seconds, creating it empty when it does not exist yet
+func (az *AzureCloudStorageProxy) AcquireLease(ctx context.Context, containerName string, fileName string,
+	duration time.Duration) (string, error) {
+	seconds := int32(duration / time.Second)
+	if seconds < 15 || seconds > 60 {
+		return "", &CloudStorageError{message: "a lease on blob " + fileName + " must last between 15 and 60 seconds"}
+	}
+	// only a blob that exists can be leased
+	createOnly := fileOptions{ifNoneMatch: "*"}
+	_, err := az.blobServiceClient.UploadBuffer(ctx, containerName, fileName, []byte{}, &azblob.UploadBufferOptions{
+		AccessConditions: accessConditions(createOnly),
+	})
+	if err != nil {
+		wrapped := wrapConditionalError("unable to create blob "+fileName+" to lease", err, createOnly)
+		if !errors.Is(wrapped, ErrPreconditionFailed) {
+			return "", wrapped
+		}
+	}
+	leaseClient, err := az.leaseClient(containerName, fileName, "")
+	if err != nil {
+		return "", err
+	}
+	resp, err := leaseClient.AcquireLease(ctx, seconds, nil)
+	if err != nil {
+		return "", wrapError("unable to lease blob "+fileName, err)
+	}
+	return valueOrZero(resp.LeaseID), nil
+}
+
+func (az *AzureCloudStorageProxy) RenewLease(ctx context.Context, containerName string, fileName string, leaseID string) error {
+	leaseClient, err := az.leaseClient(containerName, fileName, leaseID)
+	if err != nil {
+		return err
+	}
+	if _, err = leaseClient.RenewLease(ctx, nil); err != nil {
+		return wrapError("unable to renew lease on blob "+fileName, err)
+	}
+	return nil
+}
+
+func (az *AzureCloudStorageProxy) ReleaseLease(ctx context.Context, containerName string, fileName string, leaseID string) error {
+	leaseClient, err := az.leaseClient(containerName, fileName, leaseID)
+	if err != nil {
+		return err
+	}
+	if _, err = leaseClient.ReleaseLease(ctx, nil); err != nil {
+		return wrapError("unable to release lease on blob "+fileName, err)
+	}
+	return nil
+}
+
 func (az *AzureCloudStorageProxy) CreateContainerIfNotExists(ctx context.Context, containerName string) error {
 	_, err := az.blobServiceClient.CreateContainer(ctx, containerName, nil)
 	var respErr *azcore.ResponseError
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake/directory"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake/file"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake/service"
+	"golang.org/x/net/context"
+	"strings"
+)
+
+// AzureDataLakeCloudStorageProxy targets storage accounts with a hierarchical namespace (ADLS Gen2).
+// All CloudStorageProxy methods go through the blob endpoint exactly as they do for AzureCloudStorageProxy;
+// the methods added here use the dfs endpoint, where directories are real and renames are atomic.
+type AzureDataLakeCloudStorageProxy struct {
+	*AzureCloudStorageProxy
+	dataLakeServiceClient *service.Client
+}
+
+type AccessControl struct {
+	Owner       string
+	Group       string
+	Permissions string
+	ACL         string
+}
+
+func newDataLakeProxy(blobClient *azblob.Client, dataLakeClient *service.Client) *AzureDataLakeCloudStorageProxy {
+	return &AzureDataLakeCloudStorageProxy{
+		AzureCloudStorageProxy: &AzureCloudStorageProxy{blobServiceClient: blobClient},
+		dataLakeServiceClient:  dataLakeClient,
+	}
+}
+
+func trimPath(pathName string) string {
+	return strings.Trim(pathName, "/")
+}
+
+func (dl *AzureDataLakeCloudStorageProxy) CreateDirectory(ctx context.Context, containerName string, directoryName string) error {
+	directoryClient := dl.dataLakeServiceClient.NewFileSystemClient(containerName).NewDirectoryClient(trimPath(directoryName))
+	if _, err := directoryClient.Create(ctx, nil); err != nil {
+		return wrapError("unable to create directory "+directoryName, err)
+	}
+	return nil
+}
+
+// RenameDirectory moves a directory and everything in it within the same container in a single operation
+func (dl *AzureDataLakeCloudStorageProxy) RenameDirectory(ctx context.Context, containerName string, directoryName string,
+	newDirectoryName string) error {
+	directoryClient := dl.dataLakeServiceClient.NewFileSystemClient(containerName).NewDirectoryClient(trimPath(directoryName))
+	if _, err := directoryClient.Rename(ctx, trimPath(newDirectoryName), nil); err != nil {
+		return wrapError("unable to rename directory "+directoryName, err)
+	}
+	return nil
+}
+
+// DeleteDirectory deletes a directory and everything in it
+func (dl *AzureDataLakeCloudStorageProxy) DeleteDirectory(ctx context.Context, containerName string, directoryName string) error {
+	directoryClient := dl.dataLakeServiceClient.NewFileSystemClient(containerName).NewDirectoryClient(trimPath(directoryName))
+	if _, err := directoryClient.Delete(ctx, nil); err != nil {
+		return wrapError("unable to delete directory "+directoryName, err)
+	}
+	return nil
+}
+
+// RenameFile atomically moves a file within the same container
+func (dl *AzureDataLakeCloudStorageProxy) RenameFile(ctx context.Context, containerName string, fileName string,
+	newFileName string) error {
+	if _, err := dl.fileClient(containerName, fileName).Rename(ctx, trimPath(newFileName), nil); err != nil {
+		return wrapError("unable to rename file "+fileName, err)
+	}
+	return nil
+}
+
+// fileClient is used for access control on both files and directories; the dfs path operations are the same for either
+func (dl *AzureDataLakeCloudStorageProxy) fileClient(containerName string, pathName string) *file.Client {
+	return dl.dataLakeServiceClient.NewFileSystemClient(containerName).NewFileClient(trimPath(pathName))
+}
+
+func (dl *AzureDataLakeCloudStorageProxy) GetAccessControl(ctx context.Context, containerName string,
+	pathName string) (AccessControl, error) {
+	resp, err := dl.fileClient(containerName, pathName).GetAccessControl(ctx, nil)
+	if err != nil {
+		return AccessControl{}, wrapError("unable to get access control for "+pathName, err)
+	}
+	return AccessControl{
+		Owner:       valueOrZero(resp.Owner),
+		Group:       valueOrZero(resp.Group),
+		Permissions: valueOrZero(resp.Permissions),
+		ACL:         valueOrZero(resp.ACL),
+	}, nil
+}
+
+// SetAccessControl replaces the access control of a file or directory. Empty fields are left unchanged, and
+// the service accepts either Permissions or ACL, but not both.
+func (dl *AzureDataLakeCloudStorageProxy) SetAccessControl(ctx context.Context, containerName string, pathName string,
+	accessControl AccessControl) error {
+	options := &file.SetAccessControlOptions{}
+	if accessControl.Owner != "" {
+		options.Owner = to.Ptr(accessControl.Owner)
+	}
+	if accessControl.Group != "" {
+		options.Group = to.Ptr(accessControl.Group)
+	}
+	if accessControl.Permissions != "" {
+		options.Permissions = to.Ptr(accessControl.Permissions)
+	}
+	if accessControl.ACL != "" {
+		options.ACL = to.Ptr(accessControl.ACL)
+	}
+	if _, err := dl.fileClient(containerName, pathName).SetAccessControl(ctx, options); err != nil {
+		return wrapError("unable to set access control for "+pathName, err)
+	}
+	return nil
+}
+
+// MoveFile renames the file within a container, and copies and deletes it between containers
+func (dl *AzureDataLakeCloudStorageProxy) MoveFile(ctx context.Context, sourceContainer string, sourceFile string,
+	destContainer string, destFile string) error {
+	if sourceContainer != destContainer || sourceFile == destFile {
+		return moveFile(ctx, dl, sourceContainer, sourceFile, destContainer, destFile)
+	}
+	if err := dl.RenameFile(ctx, sourceContainer, sourceFile, destFile); err != nil {
+		return wrapError("unable to move file "+sourceFile, err)
+	}
+	return nil
+}
+
+// MovePrefix renames the whole directory in one operation when both prefixes are directories in the same container
+// and the destination does not exist yet. Otherwise, or if the rename fails, the files are moved one by one.
+func (dl *AzureDataLakeCloudStorageProxy) MovePrefix(ctx context.Context, sourceContainer string, sourcePrefix string,
+	destContainer string, destPrefix string, concurrency int) ([]FileResult, error) {
+	if err := checkMovePrefixes(sourceContainer, sourcePrefix, destContainer, destPrefix); err != nil {
+		return make([]FileResult, 0), err
+	}
+	if sourceContainer != destContainer || !strings.HasSuffix(sourcePrefix, "/") || !strings.HasSuffix(destPrefix, "/") {
+		return movePrefix(ctx, dl, sourceContainer, sourcePrefix, destContainer, destPrefix, concurrency)
+	}
+	results := make([]FileResult, 0)
+	for object, err := range Objects(ctx, dl, sourceContainer, ListOptions{Prefix: sourcePrefix, Recursive: true, PageSize: 1000}) {
+		if err != nil {
+			return results, err
+		}
+		results = append(results, FileResult{Name: object.Name})
+	}
+	if len(results) == 0 {
+		return results, nil
+	}
+	directoryClient := dl.dataLakeServiceClient.NewFileSystemClient(sourceContainer).NewDirectoryClient(trimPath(sourcePrefix))
+	options := &directory.RenameOptions{AccessConditions: &directory.AccessConditions{
+		ModifiedAccessConditions: &directory.ModifiedAccessConditions{IfNoneMatch: to.Ptr(azcore.ETagAny)},
+	}}
+	if _, err := directoryClient.Rename(ctx, trimPath(destPrefix), options); err != nil {
+		return movePrefix(ctx, dl, sourceContainer, sourcePrefix, destContainer, destPrefix, concurrency)
+	}
+	return results, nil
+}
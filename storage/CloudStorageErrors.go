@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"cloud.google.com/go/storage"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/aws/smithy-go"
+	"google.golang.org/api/googleapi"
+	"io/fs"
+	"net"
+	"net/http"
+)
+
+// The errors returned by the proxies can be classified with errors.Is against these, whichever provider they came from
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrAlreadyExists      = errors.New("already exists")
+	ErrAccessDenied       = errors.New("access denied")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrThrottled          = errors.New("throttled")
+	ErrTimeout            = errors.New("timeout")
+	// ErrNotSupported is returned when a provider, or the way a container is configured, does not offer a feature
+	ErrNotSupported = errors.New("not supported")
+)
+
+// errContainerNotFound is wrapped by the proxies that find out themselves that a container does not exist
+var errContainerNotFound = fmt.Errorf("container does not exist: %w", fs.ErrNotExist)
+
+// classifyError maps an error from a provider SDK or the filesystem to one of the exported errors,
+// or returns nil if it is not one of them
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, storage.ErrObjectNotExist), errors.Is(err, storage.ErrBucketNotExist):
+		return ErrNotFound
+	case errors.Is(err, fs.ErrExist):
+		return ErrAlreadyExists
+	case errors.Is(err, fs.ErrPermission):
+		return ErrAccessDenied
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout
+	}
+	if kind := classifyAzureError(err); kind != nil {
+		return kind
+	}
+	var apiError smithy.APIError
+	if errors.As(err, &apiError) {
+		switch apiError.ErrorCode() {
+		case "NoSuchKey", "NoSuchBucket", "NoSuchUpload", "NotFound":
+			return ErrNotFound
+		case "BucketAlreadyExists", "BucketAlreadyOwnedByYou":
+			return ErrAlreadyExists
+		case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken":
+			return ErrAccessDenied
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return ErrPreconditionFailed
+		case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded":
+			return ErrThrottled
+		case "RequestTimeout":
+			return ErrTimeout
+		}
+	}
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return ErrTimeout
+	}
+	return classifyStatusCode(statusCode(err))
+}
+
+func classifyAzureError(err error) error {
+	switch {
+	case bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ContainerNotFound, bloberror.ResourceNotFound):
+		return ErrNotFound
+	case bloberror.HasCode(err, bloberror.BlobAlreadyExists, bloberror.ContainerAlreadyExists,
+		bloberror.ResourceAlreadyExists):
+		return ErrAlreadyExists
+	case bloberror.HasCode(err, bloberror.AuthenticationFailed, bloberror.AuthorizationFailure,
+		bloberror.AuthorizationPermissionMismatch, bloberror.AuthorizationSourceIPMismatch,
+		bloberror.InsufficientAccountPermissions):
+		return ErrAccessDenied
+	case bloberror.HasCode(err, bloberror.ConditionNotMet, bloberror.SourceConditionNotMet,
+		bloberror.TargetConditionNotMet):
+		return ErrPreconditionFailed
+	// the blob is leased by someone else, or the lease used has been lost
+	case bloberror.HasCode(err, bloberror.LeaseAlreadyPresent, bloberror.LeaseIDMismatchWithLeaseOperation,
+		bloberror.LeaseIDMismatchWithBlobOperation, bloberror.LeaseIDMissing, bloberror.LeaseIsBreakingAndCannotBeAcquired,
+		bloberror.LeaseIsBrokenAndCannotBeRenewed, bloberror.LeaseLost, bloberror.LeaseNotPresentWithLeaseOperation):
+		return ErrPreconditionFailed
+	case bloberror.HasCode(err, bloberror.ServerBusy):
+		return ErrThrottled
+	case bloberror.HasCode(err, bloberror.OperationTimedOut):
+		return ErrTimeout
+	}
+	return nil
+}
+
+// statusCode returns the HTTP status of a failed request, or 0 if the error did not come from a response
+func statusCode(err error) int {
+	var azureError *azcore.ResponseError
+	if errors.As(err, &azureError) {
+		return azureError.StatusCode
+	}
+	var gcpError *googleapi.Error
+	if errors.As(err, &gcpError) {
+		return gcpError.Code
+	}
+	var awsError interface{ HTTPStatusCode() int }
+	if errors.As(err, &awsError) {
+		return awsError.HTTPStatusCode()
+	}
+	return 0
+}
+
+func classifyStatusCode(code int) error {
+	switch code {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrAlreadyExists
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAccessDenied
+	case http.StatusPreconditionFailed:
+		return ErrPreconditionFailed
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return ErrThrottled
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return ErrTimeout
+	}
+	return nil
+}
+
+// existsResult turns the outcome of looking up a file into the result of Exists. A missing container is an error,
+// so that a wrong container name is not taken for a missing file.
+func existsResult(fileName string, err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	wrapped := wrapError("unable to check whether file "+fileName+" exists", err)
+	if errors.Is(wrapped, ErrNotFound) && !containerNotFound(err) {
+		return false, nil
+	}
+	return false, wrapped
+}
+
+// containerNotFound tells the errors of a missing container apart from those of a missing file
+func containerNotFound(err error) bool {
+	var apiError smithy.APIError
+	if errors.As(err, &apiError) && apiError.ErrorCode() == "NoSuchBucket" {
+		return true
+	}
+	return errors.Is(err, errContainerNotFound) || errors.Is(err, storage.ErrBucketNotExist) ||
+		bloberror.HasCode(err, bloberror.ContainerNotFound)
+}
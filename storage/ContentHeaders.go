@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"lib-cloud-proxy-go/util"
+	"strings"
+)
+
+// The standard HTTP content headers of a file are set on upload by including these keys in the metadata,
+// and GetMetadata and GetFile return them under the same keys. They are stored as properties of the object
+// rather than as user metadata, so they are served with the file, including through signed URLs.
+// Keys are matched after normalization, so "Content-Type" can be used as well.
+const (
+	MetadataContentType        = "content_type"
+	MetadataContentEncoding    = "content_encoding"
+	MetadataContentLanguage    = "content_language"
+	MetadataContentDisposition = "content_disposition"
+	MetadataCacheControl       = "cache_control"
+)
+
+type contentHeaders struct {
+	ContentType        string `json:"content_type,omitempty"`
+	ContentEncoding    string `json:"content_encoding,omitempty"`
+	ContentLanguage    string `json:"content_language,omitempty"`
+	ContentDisposition string `json:"content_disposition,omitempty"`
+	CacheControl       string `json:"cache_control,omitempty"`
+}
+
+// splitContentHeaders separates the content headers from the user metadata of an upload
+func splitContentHeaders(metadata map[string]string) (map[string]string, contentHeaders) {
+	var headers contentHeaders
+	userMetadata := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		switch strings.ReplaceAll(util.NormalizeString(key), "-", "_") {
+		case MetadataContentType:
+			headers.ContentType = value
+		case MetadataContentEncoding:
+			headers.ContentEncoding = value
+		case MetadataContentLanguage:
+			headers.ContentLanguage = value
+		case MetadataContentDisposition:
+			headers.ContentDisposition = value
+		case MetadataCacheControl:
+			headers.CacheControl = value
+		default:
+			userMetadata[key] = value
+		}
+	}
+	return userMetadata, headers
+}
+
+// addTo reports the headers that are set in the metadata returned by GetMetadata
+func (headers contentHeaders) addTo(metadata map[string]string) {
+	for key, value := range map[string]string{
+		MetadataContentType:        headers.ContentType,
+		MetadataContentEncoding:    headers.ContentEncoding,
+		MetadataContentLanguage:    headers.ContentLanguage,
+		MetadataContentDisposition: headers.ContentDisposition,
+		MetadataCacheControl:       headers.CacheControl,
+	} {
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+}
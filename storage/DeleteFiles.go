@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// deleteEach deletes files one at a time, for the proxies that have no batch delete. As with a batch delete,
+// a file that does not exist is reported as deleted, so that a delete can be retried.
+func deleteEach(ctx context.Context, fileNames []string, concurrency int,
+	deleteFile func(ctx context.Context, fileName string) error) []FileResult {
+	return eachFile(ctx, fileNames, concurrency, func(ctx context.Context, fileName string) error {
+		if err := deleteFile(ctx, fileName); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return nil
+	})
+}
+
+// deletePrefix lists every file under a prefix and deletes each page of the listing with the DeleteFiles of the
+// proxy, with up to concurrency pages being deleted at once. The error is only set if the listing fails.
+func deletePrefix(ctx context.Context, proxy CloudStorageProxy, containerName string, prefix string,
+	concurrency int) ([]FileResult, error) {
+	results := make([]FileResult, 0)
+	if prefix == "" {
+		return results, &CloudStorageError{message: "a prefix is required to delete files from container " + containerName}
+	}
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	semaphore := make(chan struct{}, max(concurrency, 1))
+	var listErr error
+	for page, err := range Pages(ctx, proxy, containerName, ListOptions{Prefix: prefix, Recursive: true, PageSize: 1000}) {
+		if err != nil {
+			listErr = err
+			break
+		}
+		fileNames := make([]string, len(page.Objects))
+		for i, object := range page.Objects {
+			fileNames[i] = object.Name
+		}
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			pageResults, err := proxy.DeleteFiles(ctx, containerName, fileNames)
+			if err != nil {
+				pageResults = make([]FileResult, len(fileNames))
+				for i, fileName := range fileNames {
+					pageResults[i] = FileResult{Name: fileName, Err: err}
+				}
+			}
+			mutex.Lock()
+			results = append(results, pageResults...)
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results, listErr
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+)
+
+// FileOption changes how a single file is read, uploaded or deleted, such as WithVersion or IfMatch.
+// Each method documents the options it accepts.
+type FileOption func(options *fileOptions)
+
+type fileOptions struct {
+	versionID   string
+	ifMatch     string
+	ifNoneMatch string
+}
+
+// WithVersion reads or deletes one version of a file rather than the current one. The version ID is one returned
+// by ListFileVersions. Deleting a version removes it permanently.
+func WithVersion(versionID string) FileOption {
+	return func(options *fileOptions) {
+		options.versionID = versionID
+	}
+}
+
+// IfMatch makes an upload or delete succeed only while the file still has the given ETag, as returned by an upload
+// or GetMetadata, so that changes made since the file was read are not lost. Otherwise the error matches
+// ErrPreconditionFailed, also when the file no longer exists.
+func IfMatch(etag string) FileOption {
+	return func(options *fileOptions) {
+		options.ifMatch = etag
+	}
+}
+
+// IfNoneMatch("*") makes an upload succeed only when the file does not exist yet. Otherwise the error matches
+// ErrPreconditionFailed. S3 accepts no other value.
+func IfNoneMatch(etag string) FileOption {
+	return func(options *fileOptions) {
+		options.ifNoneMatch = etag
+	}
+}
+
+func applyFileOptions(options []FileOption) fileOptions {
+	var applied fileOptions
+	for _, option := range options {
+		option(&applied)
+	}
+	return applied
+}
+
+func (options fileOptions) hasConditions() bool {
+	return options.ifMatch != "" || options.ifNoneMatch != ""
+}
+
+// checkConditions is used by the proxies that evaluate the conditions themselves, with the current ETag of the
+// file, or an empty ETag when it does not exist
+func checkConditions(fileName string, options fileOptions, etag string) error {
+	if options.ifMatch != "" && (etag == "" || (options.ifMatch != "*" && options.ifMatch != etag)) {
+		return &CloudStorageError{message: "file " + fileName + " does not match ETag " + options.ifMatch,
+			kind: ErrPreconditionFailed}
+	}
+	if options.ifNoneMatch != "" && etag != "" && (options.ifNoneMatch == "*" || options.ifNoneMatch == etag) {
+		return &CloudStorageError{message: "file " + fileName + " already exists", kind: ErrPreconditionFailed}
+	}
+	return nil
+}
+
+// wrapConditionalError is wrapError for a request with conditions, where a conflict with an existing file means
+// that a condition failed. So does a missing file with IfMatch, which S3 reports as not found, as checkConditions
+// does for the proxies that evaluate the conditions themselves.
+func wrapConditionalError(msg string, err error, options fileOptions) *CloudStorageError {
+	wrapped := wrapError(msg, err)
+	switch {
+	case options.hasConditions() && wrapped.kind == ErrAlreadyExists:
+		wrapped.kind = ErrPreconditionFailed
+	case options.ifMatch != "" && errors.Is(wrapped, ErrNotFound) && !containerNotFound(err):
+		wrapped.kind = ErrPreconditionFailed
+	}
+	return wrapped
+}
+
+// FileVersion is one version of a file in a container with versioning enabled. A delete marker is the version
+// that records that the file was deleted, and has no content.
+type FileVersion struct {
+	ObjectInfo
+	VersionID      string
+	IsCurrent      bool
+	IsDeleteMarker bool
+}
+
+// sortVersions orders versions from newest to oldest
+func sortVersions(versions []FileVersion) {
+	slices.SortStableFunc(versions, func(a, b FileVersion) int {
+		return b.LastModified.Compare(a.LastModified)
+	})
+}
+
+func versionsNotSupported(provider string) *CloudStorageError {
+	return &CloudStorageError{message: provider + " does not support file versions", kind: ErrNotSupported}
+}
+
+// checkNoVersion rejects WithVersion for the proxies that keep a single version of each file
+func checkNoVersion(provider string, options []FileOption) error {
+	if applyFileOptions(options).versionID != "" {
+		return versionsNotSupported(provider)
+	}
+	return nil
+}
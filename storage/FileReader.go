@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"fmt"
+	"golang.org/x/net/context"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+const size_READAHEAD = 1024 * 1024
+
+// checkRange rejects a range of GetFileRange that does not start in the file or is empty. A negative length
+// reads to the end of the file.
+func checkRange(fileName string, offset int64, length int64) error {
+	if offset < 0 || length == 0 {
+		return &CloudStorageError{
+			message: fmt.Sprintf("invalid range of %d bytes at offset %d of file %s", length, offset, fileName),
+		}
+	}
+	return nil
+}
+
+func rangePastEnd(fileName string, offset int64) *CloudStorageError {
+	return &CloudStorageError{message: fmt.Sprintf("offset %d is past the end of file %s", offset, fileName)}
+}
+
+type fileRange struct {
+	*io.SectionReader
+	io.Closer
+}
+
+// newFileRange returns a range of a file opened by the local filesystem or SFTP proxy, which closes the file
+func newFileRange(file interface {
+	io.ReaderAt
+	io.Closer
+}, fileName string, offset int64, length int64, size int64) (io.ReadCloser, error) {
+	if offset > 0 && offset >= size {
+		_ = file.Close()
+		return nil, rangePastEnd(fileName, offset)
+	}
+	if length < 0 || offset+length > size {
+		length = size - offset
+	}
+	return fileRange{SectionReader: io.NewSectionReader(file, offset, length), Closer: file}, nil
+}
+
+// FileReader reads a file with range requests, so that only the parts that are read are downloaded. Short reads are
+// served from a read-ahead buffer of 1 MiB, which suits parsers such as archive/zip that make many of them:
+//
+//	reader, err := proxy.OpenReader(ctx, "routeingress", "batch.zip")
+//	defer reader.Close()
+//	archive, err := zip.NewReader(reader, reader.Size())
+//
+// Every range is read from the version of the file that was opened, so a file that is overwritten while it is read
+// is never stitched together from two versions: the next read fails with an error matching ErrPreconditionFailed,
+// or ErrNotFound once an old version is deleted. FileReader implements io.ReadSeekCloser and io.ReaderAt, and ReadAt
+// can be called concurrently.
+type FileReader struct {
+	ctx           context.Context
+	proxy         CloudStorageProxy
+	containerName string
+	fileName      string
+	size          int64
+	// version pins the ranges to the version that was opened, with WithVersion or else IfMatch
+	version FileOption
+	// mutex serializes Read and Seek, which share the position
+	mutex    sync.Mutex
+	position int64
+	// bufferMutex is not held while a range is fetched, so that concurrent calls to ReadAt do not wait on each other
+	bufferMutex  sync.Mutex
+	buffer       []byte
+	bufferOffset int64
+	closed       bool
+}
+
+// openReader is OpenReader for every proxy. The size and version of the file are read once, and the reads use the
+// context of the call.
+func openReader(ctx context.Context, proxy CloudStorageProxy, containerName string, fileName string) (*FileReader, error) {
+	metadata, err := proxy.GetMetadata(ctx, containerName, fileName)
+	if err != nil {
+		return nil, wrapError("unable to open file "+fileName, err)
+	}
+	version := IfMatch(metadata["etag"])
+	if versionID := metadata["version_id"]; versionID != "" {
+		version = WithVersion(versionID)
+	}
+	return &FileReader{
+		ctx:           ctx,
+		proxy:         proxy,
+		containerName: containerName,
+		fileName:      fileName,
+		size:          getStringAsInt64(metadata["content_length"]),
+		version:       version,
+	}, nil
+}
+
+// Size is the size of the file when it was opened
+func (reader *FileReader) Size() int64 {
+	return reader.size
+}
+
+func (reader *FileReader) Read(p []byte) (int, error) {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+	n, err := reader.ReadAt(p, reader.position)
+	reader.position += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (reader *FileReader) ReadAt(p []byte, offset int64) (int, error) {
+	reader.bufferMutex.Lock()
+	closed := reader.closed
+	reader.bufferMutex.Unlock()
+	if closed {
+		return 0, reader.closedError()
+	}
+	if offset < 0 {
+		return 0, &CloudStorageError{message: fmt.Sprintf("invalid offset %d of file %s", offset, reader.fileName)}
+	}
+	n := 0
+	for n < len(p) && offset < reader.size {
+		copied, err := reader.readBuffer(p[n:], offset)
+		if err != nil {
+			return n, err
+		}
+		if copied > 0 {
+			n += copied
+			offset += int64(copied)
+			continue
+		}
+		remaining := min(int64(len(p)-n), reader.size-offset)
+		if remaining >= size_READAHEAD {
+			// long reads go straight to the caller
+			if err := reader.fetch(p[n:n+int(remaining)], offset); err != nil {
+				return n, err
+			}
+			n += int(remaining)
+			offset += remaining
+			continue
+		}
+		length := min(size_READAHEAD, reader.size-offset)
+		buffer := reader.takeBuffer()
+		if int64(cap(buffer)) < length {
+			buffer = make([]byte, 0, size_READAHEAD)
+		}
+		if err := reader.fetch(buffer[:length], offset); err != nil {
+			return n, err
+		}
+		reader.bufferMutex.Lock()
+		reader.buffer, reader.bufferOffset = buffer[:length], offset
+		reader.bufferMutex.Unlock()
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readBuffer copies what the read-ahead buffer holds of the file at offset
+func (reader *FileReader) readBuffer(p []byte, offset int64) (int, error) {
+	reader.bufferMutex.Lock()
+	defer reader.bufferMutex.Unlock()
+	if reader.closed {
+		return 0, reader.closedError()
+	}
+	if start := offset - reader.bufferOffset; start >= 0 && start < int64(len(reader.buffer)) {
+		return copy(p, reader.buffer[start:]), nil
+	}
+	return 0, nil
+}
+
+func (reader *FileReader) closedError() error {
+	return &CloudStorageError{message: "reader of file " + reader.fileName + " is closed", internalError: fs.ErrClosed}
+}
+
+// takeBuffer removes the read-ahead buffer so that it can be refilled
+func (reader *FileReader) takeBuffer() []byte {
+	reader.bufferMutex.Lock()
+	defer reader.bufferMutex.Unlock()
+	buffer := reader.buffer[:0]
+	reader.buffer = nil
+	return buffer
+}
+
+// fetch fills p with the range of the file that starts at offset
+func (reader *FileReader) fetch(p []byte, offset int64) error {
+	body, err := reader.proxy.GetFileRange(reader.ctx, reader.containerName, reader.fileName, offset, int64(len(p)),
+		reader.version)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if _, err = io.ReadFull(body, p); err != nil {
+		return wrapError(fmt.Sprintf("unable to read %d bytes at offset %d of file %s", len(p), offset, reader.fileName), err)
+	}
+	return nil
+}
+
+// Seek sets the offset of the next Read. Seeking past the end of the file is allowed, and the next Read returns io.EOF.
+func (reader *FileReader) Seek(offset int64, whence int) (int64, error) {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += reader.position
+	case io.SeekEnd:
+		offset += reader.size
+	default:
+		return 0, &CloudStorageError{message: fmt.Sprintf("invalid whence %d for file %s", whence, reader.fileName)}
+	}
+	if offset < 0 {
+		return 0, &CloudStorageError{message: fmt.Sprintf("invalid offset %d of file %s", offset, reader.fileName)}
+	}
+	reader.position = offset
+	return offset, nil
+}
+
+func (reader *FileReader) Close() error {
+	reader.bufferMutex.Lock()
+	defer reader.bufferMutex.Unlock()
+	reader.closed = true
+	reader.buffer = nil
+	return nil
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"context"
+	"sync"
+)
+
+// FileResult is the outcome for one file of an operation on many files; Err is nil if it succeeded
+type FileResult struct {
+	Name string
+	Err  error
+}
+
+// eachFile runs an operation on each file, with up to concurrency of them running at once.
+// The results are in the same order as the file names.
+func eachFile(ctx context.Context, fileNames []string, concurrency int,
+	operation func(ctx context.Context, fileName string) error) []FileResult {
+	results := make([]FileResult, len(fileNames))
+	wg := sync.WaitGroup{}
+	semaphore := make(chan struct{}, max(concurrency, 1))
+	for i, fileName := range fileNames {
+		results[i].Name = fileName
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(result *FileResult) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			result.Err = operation(ctx, result.Name)
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,354 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// WriterOptions configure OpenWriter. Metadata is set on the file as it is by the upload methods, including the
+// content headers. PartSize is the size of the first parts that are uploaded while writing, 5 MiB by default and at
+// least 5 MiB on S3. On S3 and Azure the parts grow by PartSize as the file grows, as slowly as still lets a file
+// reach the largest size the provider allows: the 5 TiB of S3, with parts of about 1 GiB at the end, and on Azure
+// blocks that grow after every block toward 4000 MiB, for about 189 TiB of the 190.7 TiB a block blob can have.
+// Concurrency is how many parts are uploaded at once while the parts are small, 5 by default. As the parts grow
+// fewer of them are uploaded at once, so that the parts in flight take at most 512 MiB, or Concurrency times
+// PartSize if that is more, and a single part when one part is larger than that. FileOptions accepts IfMatch and
+// IfNoneMatch, which are checked when the file is committed.
+type WriterOptions struct {
+	Metadata    map[string]string
+	PartSize    int64
+	Concurrency int
+	FileOptions []FileOption
+}
+
+// size_INFLIGHT is the memory that the parts in flight of a FileWriter may take before fewer are uploaded at once
+const size_INFLIGHT = 512 * 1024 * 1024
+
+// partLimits are the limits of a provider on the parts of an upload and on the file they make. A zero limit means
+// that there is none, and the parts of a FileWriter then keep their first size.
+type partLimits struct {
+	maxParts    int
+	maxPartSize int64
+	maxSize     int64
+}
+
+// growthInterval is the number of parts after which the parts of a FileWriter grow by their first size. It is the
+// largest interval with which the parts allowed still add up to the largest file allowed, so that the parts stay
+// as small as they can. When no interval gets there, as on Azure, the parts grow after every part.
+func (limits partLimits) growthInterval(firstSize int64) int {
+	if limits.maxParts == 0 {
+		return 0
+	}
+	// the total size only shrinks as the interval grows
+	interval := sort.Search(limits.maxParts, func(i int) bool {
+		return limits.totalSize(firstSize, i+1) < limits.maxSize
+	})
+	return max(interval, 1)
+}
+
+// totalSize is the size of a file made of all the parts allowed, growing by firstSize every interval parts
+func (limits partLimits) totalSize(firstSize int64, interval int) int64 {
+	var total int64
+	for first, size := 0, firstSize; first < limits.maxParts; first, size = first+interval, size+firstSize {
+		total += int64(min(interval, limits.maxParts-first)) * min(size, limits.maxPartSize)
+	}
+	return total
+}
+
+func (options WriterOptions) partSize() int64 {
+	if options.PartSize <= 0 {
+		return size_5MiB
+	}
+	return options.PartSize
+}
+
+func (options WriterOptions) concurrency() int {
+	if options.Concurrency <= 0 {
+		return 5
+	}
+	return options.Concurrency
+}
+
+// partUploader uploads the parts of a FileWriter in the way of a provider, such as S3 multipart uploads or
+// Azure staged blocks
+type partUploader interface {
+	// uploadPart uploads a part, numbered from 1. Parts are uploaded concurrently unless the writer has a
+	// concurrency of 1.
+	uploadPart(ctx context.Context, number int, data []byte) error
+	// commit makes the file from the parts uploaded and returns its ETag
+	commit(ctx context.Context, parts int) (string, error)
+	// abort discards the parts uploaded
+	abort(ctx context.Context)
+}
+
+// FileWriter uploads a file in parts while it is written, so that a file of any size can be written without
+// knowing its size or holding it in memory. Close commits the file, and ETag then returns its ETag. If a part cannot
+// be uploaded, the error is returned by the next Write or Close and Close aborts the upload. Cancelling the context
+// given to OpenWriter aborts the upload at once, and nothing of it is committed.
+//
+// A file is only committed by Close, so a writer should always be closed.
+type FileWriter struct {
+	ctx       context.Context
+	fileName  string
+	uploader  partUploader
+	firstSize int
+	partSize  int
+	limits    partLimits
+	interval  int
+	buffer    []byte
+	parts     int
+	closed    bool
+	stopAbort func() bool
+	// slots limits the parts in flight, each taking a slot for every slotSize bytes or part of it, up to all of
+	// them; once the upload is finished they are all taken
+	slots    chan struct{}
+	slotSize int64
+	finished sync.Once
+	mutex    sync.Mutex
+	err      error
+	etag     string
+}
+
+func newFileWriter(ctx context.Context, fileName string, uploader partUploader, partSize int64, concurrency int,
+	limits partLimits) *FileWriter {
+	if limits.maxPartSize > 0 {
+		partSize = min(partSize, limits.maxPartSize)
+	}
+	writer := &FileWriter{
+		ctx:       ctx,
+		fileName:  fileName,
+		uploader:  uploader,
+		firstSize: int(partSize),
+		partSize:  int(partSize),
+		limits:    limits,
+		interval:  limits.growthInterval(partSize),
+		slots:     make(chan struct{}, concurrency),
+		slotSize:  max(size_INFLIGHT/int64(concurrency), partSize),
+	}
+	writer.stopAbort = context.AfterFunc(ctx, func() {
+		writer.fail(ctx.Err())
+		writer.finish(false)
+	})
+	return writer
+}
+
+func (writer *FileWriter) Write(p []byte) (int, error) {
+	if writer.closed {
+		return 0, &CloudStorageError{message: "writer of file " + writer.fileName + " is closed"}
+	}
+	written := 0
+	for len(p) > 0 {
+		if err := writer.ctx.Err(); err != nil {
+			return written, writer.fail(err)
+		}
+		if err := writer.failed(); err != nil {
+			return written, err
+		}
+		if writer.buffer == nil {
+			writer.buffer = make([]byte, 0, writer.partSize)
+		}
+		n := min(len(p), writer.partSize-len(writer.buffer))
+		writer.buffer = append(writer.buffer, p[:n]...)
+		written += n
+		p = p[n:]
+		if len(writer.buffer) == writer.partSize {
+			if err := writer.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flush starts the upload of the buffered part, waiting while the parts in flight hold the slots it needs
+func (writer *FileWriter) flush() error {
+	if writer.limits.maxParts > 0 && writer.parts == writer.limits.maxParts {
+		return writer.fail(&CloudStorageError{message: fmt.Sprintf("file %s is larger than the %d parts allowed",
+			writer.fileName, writer.limits.maxParts)})
+	}
+	// select picks at random when a slot is free and the context is done as well
+	if err := writer.ctx.Err(); err != nil {
+		return writer.fail(err)
+	}
+	// larger parts take more slots, so that fewer of them are in flight
+	slots := int(min((int64(len(writer.buffer))+writer.slotSize-1)/writer.slotSize, int64(cap(writer.slots))))
+	for taken := range slots {
+		select {
+		case writer.slots <- struct{}{}:
+		case <-writer.ctx.Done():
+			writer.release(taken)
+			return writer.fail(writer.ctx.Err())
+		}
+	}
+	if err := writer.failed(); err != nil {
+		writer.release(slots)
+		return err
+	}
+	writer.parts++
+	number, data := writer.parts, writer.buffer
+	writer.buffer = nil
+	// the parts grow with the file, so that its size does not have to be known to fit in the parts allowed
+	if writer.interval > 0 && writer.parts%writer.interval == 0 {
+		writer.partSize = int(min(int64(writer.partSize+writer.firstSize), writer.limits.maxPartSize))
+	}
+	go func() {
+		defer writer.release(slots)
+		if err := writer.uploader.uploadPart(writer.ctx, number, data); err != nil {
+			writer.fail(err)
+		}
+	}()
+	return nil
+}
+
+func (writer *FileWriter) release(slots int) {
+	for range slots {
+		<-writer.slots
+	}
+}
+
+// Close uploads the last part and commits the file. When writing failed or the context was cancelled, the upload
+// is aborted instead and the error is returned.
+func (writer *FileWriter) Close() error {
+	if writer.closed {
+		return writer.failed()
+	}
+	writer.closed = true
+	defer writer.stopAbort()
+	// an empty file has no parts
+	if writer.failed() == nil && len(writer.buffer) > 0 {
+		_ = writer.flush()
+	}
+	writer.finish(true)
+	return writer.failed()
+}
+
+// finish waits for the parts in flight, then commits the file or aborts the upload. Only the first call does so,
+// from Close or when the context is cancelled.
+func (writer *FileWriter) finish(commit bool) {
+	writer.finished.Do(func() {
+		for range cap(writer.slots) {
+			writer.slots <- struct{}{}
+		}
+		// the context may have been cancelled while its abort is still on the way
+		if err := writer.ctx.Err(); err != nil {
+			writer.fail(err)
+		}
+		if commit && writer.failed() == nil {
+			etag, err := writer.uploader.commit(writer.ctx, writer.parts)
+			if err == nil {
+				writer.mutex.Lock()
+				defer writer.mutex.Unlock()
+				// the file is committed even if the context was cancelled in the meantime
+				writer.etag, writer.err = etag, nil
+				return
+			}
+			writer.fail(err)
+		}
+		writer.uploader.abort(context.WithoutCancel(writer.ctx))
+	})
+}
+
+// ETag is the ETag of the file once Close has committed it
+func (writer *FileWriter) ETag() string {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	return writer.etag
+}
+
+// fail records the first error of the upload, unless the file has been committed, and returns the error recorded
+func (writer *FileWriter) fail(err error) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	if writer.err == nil && writer.etag == "" {
+		if _, ok := err.(*CloudStorageError); !ok {
+			err = wrapError("unable to upload file "+writer.fileName, err)
+		}
+		writer.err = err
+	}
+	return writer.err
+}
+
+func (writer *FileWriter) failed() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	return writer.err
+}
+
+// uploadStream is UploadFileFromInputStream for a stream of unknown size on the proxies that need the size to
+// choose their part size. The stream is written to OpenWriter, whose parts grow as the stream goes on.
+func uploadStream(ctx context.Context, proxy CloudStorageProxy, containerName string, fileName string,
+	metadata map[string]string, inputStream io.Reader, concurrency int, options []FileOption) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	writer, err := proxy.OpenWriter(ctx, containerName, fileName, WriterOptions{
+		Metadata:    metadata,
+		Concurrency: concurrency,
+		FileOptions: options,
+	})
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(writer, inputStream); err != nil {
+		// cancelling the context before Close aborts the upload
+		cancel()
+		_ = writer.Close()
+		return "", wrapError("unable to upload file "+fileName, err)
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	return writer.ETag(), nil
+}
+
+// pipeUploader streams the parts of a FileWriter to UploadFileFromInputStream, for the proxies that upload a stream
+// without knowing its size. Its writer must have a concurrency of 1, so that the parts arrive in order.
+type pipeUploader struct {
+	pipe *io.PipeWriter
+	done chan struct{}
+	etag string
+	err  error
+}
+
+func newPipeUploader(ctx context.Context, proxy CloudStorageProxy, containerName string, fileName string,
+	options WriterOptions) *pipeUploader {
+	reader, writer := io.Pipe()
+	uploader := &pipeUploader{pipe: writer, done: make(chan struct{})}
+	go func() {
+		defer close(uploader.done)
+		uploader.etag, uploader.err = proxy.UploadFileFromInputStream(ctx, containerName, fileName, options.Metadata,
+			reader, -1, 1, options.FileOptions...)
+		// a failed upload fails the writes still waiting on the pipe
+		_ = reader.CloseWithError(uploader.err)
+	}()
+	return uploader
+}
+
+func (uploader *pipeUploader) uploadPart(ctx context.Context, number int, data []byte) error {
+	if _, err := uploader.pipe.Write(data); err != nil {
+		<-uploader.done
+		if uploader.err != nil {
+			return uploader.err
+		}
+		return err
+	}
+	return nil
+}
+
+func (uploader *pipeUploader) commit(ctx context.Context, parts int) (string, error) {
+	// closing the pipe ends the stream, which would upload the file, so a cancelled upload is aborted instead
+	if err := ctx.Err(); err != nil {
+		uploader.abort(ctx)
+		return "", err
+	}
+	_ = uploader.pipe.Close()
+	<-uploader.done
+	return uploader.etag, uploader.err
+}
+
+func (uploader *pipeUploader) abort(ctx context.Context) {
+	_ = uploader.pipe.CloseWithError(&CloudStorageError{message: "upload aborted"})
+	<-uploader.done
+}
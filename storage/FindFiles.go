@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+type SortField string
+
+const (
+	SortByName         SortField = "NAME"
+	SortByLastModified SortField = "LAST_MODIFIED"
+	SortBySize         SortField = "SIZE"
+)
+
+// FileFilter selects the files returned by FindFiles; every condition that is set must match.
+// Glob is matched against the whole file name: "*", "?" and "[...]" match within one level as in path.Match,
+// and a "**" level matches any number of levels. The literal parts of Prefix and Glob narrow the listings
+// made at the provider, and the other conditions are checked as the files are listed.
+type FileFilter struct {
+	Prefix         string
+	Glob           string
+	Suffix         string
+	Regex          *regexp.Regexp
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	MinSize        int64
+	// MaxSize of zero means there is no upper limit
+	MaxSize         int64
+	SortBy          SortField
+	Descending      bool
+	IncludeMetadata bool
+}
+
+// Walk calls fn for every file under a prefix, at all levels, in name order. Returning fs.SkipAll from fn
+// stops the walk without an error; any other error stops the walk and is returned.
+func Walk(ctx context.Context, proxy CloudStorageProxy, containerName string, prefix string,
+	fn func(object ObjectInfo) error) error {
+	for object, err := range Objects(ctx, proxy, containerName, ListOptions{Prefix: prefix, Recursive: true}) {
+		if err != nil {
+			return err
+		}
+		if err := fn(object); err != nil {
+			if errors.Is(err, fs.SkipAll) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// FindFiles returns every file that matches a filter, sorted by name unless another order is requested
+func FindFiles(ctx context.Context, proxy CloudStorageProxy, containerName string, filter FileFilter) ([]ObjectInfo, error) {
+	var segments []string
+	if filter.Glob != "" {
+		segments = strings.Split(filter.Glob, "/")
+		for _, segment := range segments {
+			if _, err := path.Match(segment, ""); err != nil {
+				return make([]ObjectInfo, 0), wrapError("invalid glob pattern "+filter.Glob, err)
+			}
+		}
+	}
+	f := &finder{
+		ctx:           ctx,
+		proxy:         proxy,
+		containerName: containerName,
+		filter:        filter,
+		globSegments:  segments,
+		matches:       make([]ObjectInfo, 0),
+	}
+	if err := f.find("", segments); err != nil {
+		return f.matches, err
+	}
+	sortObjects(f.matches, filter.SortBy, filter.Descending)
+	return f.matches, nil
+}
+
+type finder struct {
+	ctx           context.Context
+	proxy         CloudStorageProxy
+	containerName string
+	filter        FileFilter
+	globSegments  []string
+	matches       []ObjectInfo
+}
+
+// find lists the files under dir that may match the remaining glob segments. While the next segment is
+// a pattern for a single level it lists one level at a time and only descends into the folders that match,
+// and from a "**" segment on it lists everything under the folder it has reached.
+func (f *finder) find(dir string, segments []string) error {
+	for len(segments) > 1 && segments[0] != "**" && !hasGlobMeta(segments[0]) {
+		dir += segments[0] + "/"
+		segments = segments[1:]
+	}
+	recursive := len(segments) == 0 || segments[0] == "**"
+	literal := ""
+	if len(segments) > 0 && !recursive {
+		literal = segments[0]
+		if index := strings.IndexAny(literal, `*?[\`); index >= 0 {
+			literal = literal[:index]
+		}
+	}
+	prefix, ok := f.listPrefix(dir, dir+literal, recursive)
+	if !ok {
+		return nil
+	}
+	options := ListOptions{
+		Prefix:          prefix,
+		Recursive:       recursive,
+		IncludeMetadata: f.filter.IncludeMetadata && len(segments) <= 1,
+	}
+	for page, err := range Pages(f.ctx, f.proxy, f.containerName, options) {
+		if err != nil {
+			return err
+		}
+		for _, object := range page.Objects {
+			if f.match(object) {
+				f.matches = append(f.matches, object)
+			}
+		}
+		if len(segments) <= 1 {
+			continue
+		}
+		for _, folder := range page.Folders {
+			if matched, _ := path.Match(segments[0], strings.TrimSuffix(folder[len(dir):], "/")); matched {
+				if err := f.find(folder, segments[1:]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// listPrefix combines the prefix derived from the glob with the prefix of the filter, using whichever is
+// longer. It reports false when the two cannot both match, so the listing can be skipped.
+func (f *finder) listPrefix(dir string, globPrefix string, recursive bool) (string, bool) {
+	prefix := f.filter.Prefix
+	switch {
+	case strings.HasPrefix(globPrefix, prefix):
+		return globPrefix, true
+	case strings.HasPrefix(prefix, globPrefix):
+		// a listing of a single level cannot use a prefix that reaches into the levels below it
+		if recursive || !strings.Contains(prefix[len(dir):], "/") {
+			return prefix, true
+		}
+		return globPrefix, true
+	default:
+		return "", false
+	}
+}
+
+func (f *finder) match(object ObjectInfo) bool {
+	filter := f.filter
+	if !strings.HasPrefix(object.Name, filter.Prefix) || !strings.HasSuffix(object.Name, filter.Suffix) {
+		return false
+	}
+	if f.globSegments != nil && !matchGlob(f.globSegments, strings.Split(object.Name, "/")) {
+		return false
+	}
+	if filter.Regex != nil && !filter.Regex.MatchString(object.Name) {
+		return false
+	}
+	if !filter.ModifiedAfter.IsZero() && !object.LastModified.After(filter.ModifiedAfter) {
+		return false
+	}
+	if !filter.ModifiedBefore.IsZero() && !object.LastModified.Before(filter.ModifiedBefore) {
+		return false
+	}
+	return object.Size >= filter.MinSize && (filter.MaxSize <= 0 || object.Size <= filter.MaxSize)
+}
+
+func hasGlobMeta(segment string) bool {
+	return strings.ContainsAny(segment, `*?[\`)
+}
+
+func matchGlob(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlob(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], name[0]); !matched {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+func sortObjects(objects []ObjectInfo, sortBy SortField, descending bool) {
+	slices.SortStableFunc(objects, func(a, b ObjectInfo) int {
+		var result int
+		switch sortBy {
+		case SortByLastModified:
+			result = a.LastModified.Compare(b.LastModified)
+		case SortBySize:
+			result = cmp.Compare(a.Size, b.Size)
+		}
+		if result == 0 {
+			result = strings.Compare(a.Name, b.Name)
+		}
+		if descending {
+			return -result
+		}
+		return result
+	})
+}
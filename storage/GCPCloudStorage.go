@@ -0,0 +1,689 @@
+package storage
+
+import (
+	"bytes"
+	"cloud.google.com/go/storage"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"io"
+	"lib-cloud-proxy-go/util"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type GCPCloudStorageProxy struct {
+	storageClient *storage.Client
+	projectID     string
+}
+
+func (handler ProxyAuthHandlerGCPDefaultIdentity) createProxy() (CloudStorageProxy, error) {
+	return createProxyFromOptions(handler.ProjectID, handler.Endpoint)
+}
+
+func (handler ProxyAuthHandlerGCPServiceAccountJSON) createProxy() (CloudStorageProxy, error) {
+	projectID := handler.ProjectID
+	if projectID == "" {
+		// fall back to the project the service account belongs to
+		var serviceAccount struct {
+			ProjectID string `json:"project_id"`
+		}
+		if err := json.Unmarshal([]byte(handler.CredentialsJSON), &serviceAccount); err != nil {
+			return nil, wrapError("unable to parse service account credentials", err)
+		}
+		projectID = serviceAccount.ProjectID
+	}
+	return createProxyFromOptions(projectID, handler.Endpoint, option.WithCredentialsJSON([]byte(handler.CredentialsJSON)))
+}
+
+func createProxyFromOptions(projectID string, endpoint string, opts ...option.ClientOption) (CloudStorageProxy, error) {
+	if endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+	// the client also honors STORAGE_EMULATOR_HOST, which is how it is pointed at emulators such as fake-gcs-server
+	client, err := storage.NewClient(context.Background(), opts...)
+	if err != nil {
+		return nil, wrapError("unable to create Google Cloud Storage service client", err)
+	}
+	return &GCPCloudStorageProxy{storageClient: client, projectID: projectID}, nil
+}
+
+func (gc *GCPCloudStorageProxy) listFilesOrFolders(ctx context.Context, containerName string, maxNumber int,
+	prefix string, listType blobListType) ([]string, error) {
+	if maxNumber <= 0 {
+		maxNumber = max_RESULT
+	}
+	itemList := make([]string, 0)
+	query := &storage.Query{Prefix: prefix, Delimiter: "/"}
+	if err := query.SetAttrSelection([]string{"Name"}); err != nil {
+		return itemList, wrapError("unable to list contents of bucket "+containerName, err)
+	}
+	objects := gc.storageClient.Bucket(containerName).Objects(ctx, query)
+	for len(itemList) < maxNumber {
+		attrs, err := objects.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return itemList, wrapError("unable to list contents of bucket "+containerName, err)
+		}
+		// with a delimiter, folders come back as entries that only have a prefix
+		if listType == listTypeFile && attrs.Prefix == "" {
+			itemList = append(itemList, attrs.Name)
+		} else if listType == listTypeFolder && attrs.Prefix != "" {
+			itemList = append(itemList, attrs.Prefix)
+		}
+	}
+	return itemList, nil
+}
+
+func (gc *GCPCloudStorageProxy) ListFiles(ctx context.Context, containerName string, maxNumber int,
+	prefix string) ([]string, error) {
+	return gc.listFilesOrFolders(ctx, containerName, maxNumber, prefix, listTypeFile)
+}
+
+func (gc *GCPCloudStorageProxy) ListFolders(ctx context.Context, containerName string, maxNumber int,
+	prefix string) ([]string, error) {
+	return gc.listFilesOrFolders(ctx, containerName, maxNumber, prefix, listTypeFolder)
+}
+
+func (gc *GCPCloudStorageProxy) ListObjects(ctx context.Context, containerName string, maxNumber int,
+	prefix string, includeMetadata bool) ([]ObjectInfo, error) {
+	if maxNumber <= 0 {
+		maxNumber = max_RESULT
+	}
+	objectList := make([]ObjectInfo, 0)
+	query := &storage.Query{Prefix: prefix, Delimiter: "/"}
+	attrSelection := []string{"Name", "Size", "Updated", "Etag", "ContentType", "StorageClass"}
+	if includeMetadata {
+		attrSelection = append(attrSelection, "Metadata")
+	}
+	if err := query.SetAttrSelection(attrSelection); err != nil {
+		return objectList, wrapError("unable to list contents of bucket "+containerName, err)
+	}
+	objects := gc.storageClient.Bucket(containerName).Objects(ctx, query)
+	for len(objectList) < maxNumber {
+		attrs, err := objects.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return objectList, wrapError("unable to list contents of bucket "+containerName, err)
+		}
+		if attrs.Prefix != "" {
+			continue
+		}
+		objectList = append(objectList, readGCPObjectInfo(attrs, includeMetadata))
+	}
+	return objectList, nil
+}
+
+func (gc *GCPCloudStorageProxy) ListObjectsPage(ctx context.Context, containerName string,
+	options ListOptions) (ObjectPage, error) {
+	page := ObjectPage{Objects: make([]ObjectInfo, 0), Folders: make([]string, 0)}
+	query := &storage.Query{Prefix: options.Prefix, Delimiter: options.delimiter()}
+	attrSelection := []string{"Name", "Size", "Updated", "Etag", "ContentType", "StorageClass"}
+	if options.IncludeMetadata {
+		attrSelection = append(attrSelection, "Metadata")
+	}
+	if err := query.SetAttrSelection(attrSelection); err != nil {
+		return page, wrapError("unable to list contents of bucket "+containerName, err)
+	}
+	objects := gc.storageClient.Bucket(containerName).Objects(ctx, query)
+	var attrsList []*storage.ObjectAttrs
+	token, err := iterator.NewPager(objects, min(options.pageSize(), 1000), options.PageToken).NextPage(&attrsList)
+	if err != nil {
+		return page, wrapError("unable to list contents of bucket "+containerName, err)
+	}
+	for _, attrs := range attrsList {
+		if attrs.Prefix != "" {
+			page.Folders = append(page.Folders, attrs.Prefix)
+		} else {
+			page.Objects = append(page.Objects, readGCPObjectInfo(attrs, options.IncludeMetadata))
+		}
+	}
+	page.ContinuationToken = token
+	return page, nil
+}
+
+func readGCPObjectInfo(attrs *storage.ObjectAttrs, includeMetadata bool) ObjectInfo {
+	object := ObjectInfo{
+		Name:         attrs.Name,
+		Size:         attrs.Size,
+		LastModified: attrs.Updated,
+		ETag:         attrs.Etag,
+		ContentType:  attrs.ContentType,
+		StorageTier:  attrs.StorageClass,
+	}
+	if includeMetadata {
+		object.Metadata = make(map[string]string, len(attrs.Metadata))
+		for key, value := range attrs.Metadata {
+			object.Metadata[util.NormalizeString(key)] = value
+		}
+	}
+	return object
+}
+
+func readGCPMetadata(attrs *storage.ObjectAttrs) map[string]string {
+	metadata := make(map[string]string, len(attrs.Metadata)+3)
+	for key, value := range attrs.Metadata {
+		metadata[util.NormalizeString(key)] = value
+	}
+	metadata["last_modified"] = attrs.Updated.Format(time_FORMAT)
+	metadata["content_length"] = strconv.FormatInt(attrs.Size, 10)
+	metadata["etag"] = attrs.Etag
+	metadata["version_id"] = strconv.FormatInt(attrs.Generation, 10)
+	// composite objects have no MD5
+	if len(attrs.MD5) > 0 {
+		metadata["content_md5"] = base64.StdEncoding.EncodeToString(attrs.MD5)
+	}
+	contentHeaders{
+		ContentType:        attrs.ContentType,
+		ContentEncoding:    attrs.ContentEncoding,
+		ContentLanguage:    attrs.ContentLanguage,
+		ContentDisposition: attrs.ContentDisposition,
+		CacheControl:       attrs.CacheControl,
+	}.addTo(metadata)
+	return metadata
+}
+
+// object returns the handle of an object, or of one of its generations, which are the versions of the object
+func (gc *GCPCloudStorageProxy) object(containerName string, fileName string,
+	options fileOptions) (*storage.ObjectHandle, error) {
+	object := gc.storageClient.Bucket(containerName).Object(fileName)
+	if options.versionID == "" {
+		return object, nil
+	}
+	generation, err := strconv.ParseInt(options.versionID, 10, 64)
+	if err != nil {
+		return nil, &CloudStorageError{message: "invalid version " + options.versionID + " of file " + fileName,
+			kind: ErrNotFound}
+	}
+	return object.Generation(generation), nil
+}
+
+func (gc *GCPCloudStorageProxy) getFileContentAndMetadata(ctx context.Context, containerName string,
+	fileName string, options fileOptions) (string, map[string]string, error) {
+	object, err := gc.object(containerName, fileName, options)
+	if err != nil {
+		return "", nil, err
+	}
+	attrs, err := object.Attrs(ctx)
+	if err != nil {
+		return "", nil, wrapError("unable to get file "+fileName, err)
+	}
+	// pin the generation so that the content always matches the metadata
+	reader, err := object.Generation(attrs.Generation).NewReader(ctx)
+	if err != nil {
+		return "", nil, wrapError("unable to get file "+fileName, err)
+	}
+	defer reader.Close()
+	metadata := readGCPMetadata(attrs)
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return "", metadata, wrapError("unable to read content of file "+fileName, err)
+	}
+	return string(content), metadata, nil
+}
+
+func (gc *GCPCloudStorageProxy) GetFile(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) (CloudFile, error) {
+	content, metadata, err := gc.getFileContentAndMetadata(ctx, containerName, fileName, applyFileOptions(options))
+	cloudFile := CloudFile{
+		Container: containerName,
+		FileName:  fileName,
+		Metadata:  metadata,
+		Content:   content,
+	}
+	return cloudFile, err
+}
+
+func (gc *GCPCloudStorageProxy) GetFileContentAsString(ctx context.Context, containerName string, fileName string) (string, error) {
+	reader, err := gc.GetFileContentAsInputStream(ctx, containerName, fileName)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return "", wrapError("unable to read content of file "+fileName, err)
+	}
+	return string(content), nil
+}
+
+func (gc *GCPCloudStorageProxy) GetFileContentAsInputStream(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) (io.ReadCloser, error) {
+	object, err := gc.object(containerName, fileName, applyFileOptions(options))
+	if err != nil {
+		return nil, err
+	}
+	reader, err := object.NewReader(ctx)
+	if err != nil {
+		return nil, wrapError("unable to get stream reader for file "+fileName, err)
+	}
+	return reader, nil
+}
+
+// GetFileRange accepts WithVersion and IfMatch
+func (gc *GCPCloudStorageProxy) GetFileRange(ctx context.Context, containerName string, fileName string, offset int64,
+	length int64, options ...FileOption) (io.ReadCloser, error) {
+	if err := checkRange(fileName, offset, length); err != nil {
+		return nil, err
+	}
+	applied := applyFileOptions(options)
+	object, err := gc.object(containerName, fileName, applied)
+	if err != nil {
+		return nil, err
+	}
+	if object, err = gc.conditionalObject(ctx, object, fileName, applied); err != nil {
+		return nil, err
+	}
+	// a negative length reads to the end of the object
+	reader, err := object.NewRangeReader(ctx, offset, length)
+	if err != nil {
+		return nil, wrapConditionalError("unable to get range of file "+fileName, err, applied)
+	}
+	return reader, nil
+}
+
+func (gc *GCPCloudStorageProxy) OpenReader(ctx context.Context, containerName string, fileName string) (*FileReader, error) {
+	return openReader(ctx, gc, containerName, fileName)
+}
+
+func (gc *GCPCloudStorageProxy) GetLargeFileContentAsByteArray(ctx context.Context, containerName string, fileName string,
+	fileSize int64, concurrency int) ([]byte, error) {
+	if concurrency <= 0 {
+		concurrency = 5
+	}
+	object := gc.storageClient.Bucket(containerName).Object(fileName)
+	attrs, err := object.Attrs(ctx)
+	if err != nil {
+		return nil, wrapError("unable to get file "+fileName, err)
+	}
+	object = object.Generation(attrs.Generation)
+	fileSize = attrs.Size
+	var partSize int64 = size_5MiB
+	if fileSize > size_5MiB*max_PARTS {
+		// we need to increase the Part size
+		partSize = fileSize / max_PARTS
+	}
+	buffer := make([]byte, fileSize)
+	wg := sync.WaitGroup{}
+	errCh := make(chan error, 1)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	routines := 0
+	for start := int64(0); start < fileSize; start += partSize {
+		count := min(partSize, fileSize-start)
+		wg.Add(1)
+		routines++
+		go func(start int64, count int64) {
+			defer wg.Done()
+			reader, err := object.NewRangeReader(ctx, start, count)
+			if err == nil {
+				_, err = io.ReadFull(reader, buffer[start:start+count])
+				_ = reader.Close()
+			}
+			if err != nil {
+				select {
+				case errCh <- err:
+					// error was set
+				default:
+					// some other error is already set
+				}
+				cancel()
+			}
+		}(start, count)
+		if routines >= concurrency {
+			wg.Wait()
+			routines = 0
+		}
+	}
+	wg.Wait()
+	select {
+	case err = <-errCh:
+		return nil, wrapError("unable to download large file", err)
+	default:
+		// no error was encountered
+	}
+	return buffer, nil
+}
+
+func (gc *GCPCloudStorageProxy) GetMetadata(ctx context.Context, containerName string, fileName string) (map[string]string, error) {
+	attrs, err := gc.storageClient.Bucket(containerName).Object(fileName).Attrs(ctx)
+	if err != nil {
+		return nil, wrapError("unable to get metadata for object "+fileName, err)
+	}
+	return readGCPMetadata(attrs), nil
+}
+
+func (gc *GCPCloudStorageProxy) Exists(ctx context.Context, containerName string, fileName string) (bool, error) {
+	_, err := gc.storageClient.Bucket(containerName).Object(fileName).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		// an object of a missing bucket is reported as missing, so the bucket is checked as well
+		if _, bucketErr := gc.storageClient.Bucket(containerName).Attrs(ctx); errors.Is(bucketErr, storage.ErrBucketNotExist) {
+			return false, wrapError("bucket "+containerName+" does not exist", bucketErr)
+		}
+	}
+	return existsResult(fileName, err)
+}
+
+// conditionalObject expresses IfMatch and IfNoneMatch as generation preconditions, which are what Cloud Storage
+// checks atomically. An ETag is matched to the generation it belongs to before the request is made.
+func (gc *GCPCloudStorageProxy) conditionalObject(ctx context.Context, object *storage.ObjectHandle, fileName string,
+	options fileOptions) (*storage.ObjectHandle, error) {
+	if !options.hasConditions() {
+		return object, nil
+	}
+	if options.ifMatch == "" && options.ifNoneMatch == "*" {
+		return object.If(storage.Conditions{DoesNotExist: true}), nil
+	}
+	etag := ""
+	attrs, err := object.Attrs(ctx)
+	if err == nil {
+		etag = attrs.Etag
+	} else if !errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, wrapError("unable to check the conditions for file "+fileName, err)
+	}
+	if err := checkConditions(fileName, options, etag); err != nil {
+		return nil, err
+	}
+	if etag == "" {
+		return object.If(storage.Conditions{DoesNotExist: true}), nil
+	}
+	return object.If(storage.Conditions{GenerationMatch: attrs.Generation}), nil
+}
+
+// UploadFileFromString returns the ETag of the new object, and accepts IfMatch and IfNoneMatch
+func (gc *GCPCloudStorageProxy) UploadFileFromString(ctx context.Context, containerName string, fileName string,
+	metadata map[string]string, content string, options ...FileOption) (string, error) {
+	return gc.UploadFileFromInputStream(ctx, containerName, fileName, metadata, bytes.NewBufferString(content),
+		int64(len(content)), 1, options...)
+}
+
+// UploadFileFromInputStream returns the ETag of the new object, and accepts IfMatch and IfNoneMatch
+func (gc *GCPCloudStorageProxy) UploadFileFromInputStream(ctx context.Context, containerName string, fileName string,
+	metadata map[string]string, inputStream io.Reader, fileSizeBytes int64, concurrency int,
+	options ...FileOption) (string, error) {
+	// the GCS writer streams resumable upload chunks itself; uploads are not parallelized
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	object, err := gc.conditionalObject(ctx, gc.storageClient.Bucket(containerName).Object(fileName), fileName,
+		applyFileOptions(options))
+	if err != nil {
+		return "", err
+	}
+	writer := object.NewWriter(ctx)
+	metadata, headers := splitContentHeaders(metadata)
+	writer.Metadata = metadata
+	writer.ContentType = headers.ContentType
+	writer.ContentEncoding = headers.ContentEncoding
+	writer.ContentLanguage = headers.ContentLanguage
+	writer.ContentDisposition = headers.ContentDisposition
+	writer.CacheControl = headers.CacheControl
+	if fileSizeBytes > 0 && fileSizeBytes < int64(writer.ChunkSize) {
+		// small files are sent in a single request
+		writer.ChunkSize = 0
+	}
+	if _, err := io.Copy(writer, inputStream); err != nil {
+		// cancelling the context before Close abandons the upload
+		cancel()
+		_ = writer.Close()
+		return "", wrapError("unable to upload file "+fileName, err)
+	}
+	if err := writer.Close(); err != nil {
+		return "", wrapError("unable to upload file "+fileName, err)
+	}
+	return writer.Attrs().Etag, nil
+}
+
+func (gc *GCPCloudStorageProxy) OpenWriter(ctx context.Context, containerName string, fileName string,
+	options WriterOptions) (*FileWriter, error) {
+	return newFileWriter(ctx, fileName, newPipeUploader(ctx, gc, containerName, fileName, options),
+		options.partSize(), 1, partLimits{}), nil
+}
+
+// DeleteFile accepts WithVersion and IfMatch
+func (gc *GCPCloudStorageProxy) DeleteFile(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) error {
+	applied := applyFileOptions(options)
+	object, err := gc.object(containerName, fileName, applied)
+	if err != nil {
+		return err
+	}
+	if object, err = gc.conditionalObject(ctx, object, fileName, applied); err != nil {
+		return err
+	}
+	if err := object.Delete(ctx); err != nil {
+		return wrapError("unable to delete file "+fileName, err)
+	}
+	return nil
+}
+
+// DeleteFiles deletes files with up to 10 requests at once, since the client has no batch delete
+func (gc *GCPCloudStorageProxy) DeleteFiles(ctx context.Context, containerName string,
+	fileNames []string) ([]FileResult, error) {
+	return deleteEach(ctx, fileNames, 10, func(ctx context.Context, fileName string) error {
+		return gc.DeleteFile(ctx, containerName, fileName)
+	}), nil
+}
+
+func (gc *GCPCloudStorageProxy) DeletePrefix(ctx context.Context, containerName string, prefix string,
+	concurrency int) ([]FileResult, error) {
+	return deletePrefix(ctx, gc, containerName, prefix, concurrency)
+}
+
+func (gc *GCPCloudStorageProxy) GetSourceBlobSignedURL(ctx context.Context, containerName string, fileName string) (string, error) {
+	// the client signs with the service account key when it has one, and with the IAM signBlob API otherwise
+	signedURL, err := gc.storageClient.Bucket(containerName).SignedURL(fileName, &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  http.MethodGet,
+		Expires: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		return "", wrapError("could not obtain signed url", err)
+	}
+	return signedURL, nil
+}
+
+func (gc *GCPCloudStorageProxy) CopyFileFromRemoteStorage(ctx context.Context, sourceContainer string, sourceFile string,
+	destContainer string, destFile string, sourceProxy *CloudStorageProxy, concurrency int) error {
+	// s3 or azure to gcs, or different gcs account to gcs
+	s := *sourceProxy
+	metadata, err := s.GetMetadata(ctx, sourceContainer, sourceFile)
+	if err != nil {
+		return wrapError("unable to read source file metadata", err)
+	}
+	inputStream, err := s.GetFileContentAsInputStream(ctx, sourceContainer, sourceFile)
+	if err != nil {
+		return wrapError("unable to read source file as stream", err)
+	}
+	defer inputStream.Close()
+	_, err = gc.UploadFileFromInputStream(ctx, destContainer, destFile, userMetadata(metadata), inputStream,
+		getStringAsInt64(metadata["content_length"]), concurrency)
+	return err
+}
+
+func (gc *GCPCloudStorageProxy) CopyFileFromLocalStorage(ctx context.Context, sourceContainer string, sourceFile string,
+	destContainer string, destFile string, concurrency int) error {
+	source := gc.storageClient.Bucket(sourceContainer).Object(sourceFile)
+	dest := gc.storageClient.Bucket(destContainer).Object(destFile)
+	// the copier keeps issuing rewrite calls until large objects are fully copied
+	if _, err := dest.CopierFrom(source).Run(ctx); err != nil {
+		return wrapError("unable to copy object to GCS bucket", err)
+	}
+	return nil
+}
+
+func (gc *GCPCloudStorageProxy) MoveFile(ctx context.Context, sourceContainer string, sourceFile string,
+	destContainer string, destFile string) error {
+	return moveFile(ctx, gc, sourceContainer, sourceFile, destContainer, destFile)
+}
+
+func (gc *GCPCloudStorageProxy) MovePrefix(ctx context.Context, sourceContainer string, sourcePrefix string,
+	destContainer string, destPrefix string, concurrency int) ([]FileResult, error) {
+	return movePrefix(ctx, gc, sourceContainer, sourcePrefix, destContainer, destPrefix, concurrency)
+}
+
+// Cloud Storage has no object tags, and custom metadata is not used in their place since it can only be
+// changed along with the rest of the metadata
+
+func (gc *GCPCloudStorageProxy) GetTags(ctx context.Context, containerName string, fileName string) (map[string]string, error) {
+	return nil, &CloudStorageError{message: "Google Cloud Storage does not support object tags", kind: ErrNotSupported}
+}
+
+func (gc *GCPCloudStorageProxy) SetTags(ctx context.Context, containerName string, fileName string,
+	tags map[string]string) error {
+	return &CloudStorageError{message: "Google Cloud Storage does not support object tags", kind: ErrNotSupported}
+}
+
+func (gc *GCPCloudStorageProxy) FindFilesByTags(ctx context.Context, containerName string, prefix string,
+	tags map[string]string) ([]string, error) {
+	return make([]string, 0), &CloudStorageError{message: "Google Cloud Storage does not support object tags",
+		kind: ErrNotSupported}
+}
+
+// ListFileVersions lists the generations of an object in a bucket with object versioning enabled. The version IDs
+// are the generation numbers. Cloud Storage keeps no delete markers: a deleted object has no current generation.
+func (gc *GCPCloudStorageProxy) ListFileVersions(ctx context.Context, containerName string,
+	fileName string) ([]FileVersion, error) {
+	versions := make([]FileVersion, 0)
+	it := gc.storageClient.Bucket(containerName).Objects(ctx, &storage.Query{Prefix: fileName, Versions: true})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return versions, wrapError("unable to list versions of file "+fileName, err)
+		}
+		// the prefix also matches longer names
+		if attrs.Name != fileName {
+			continue
+		}
+		versions = append(versions, FileVersion{
+			ObjectInfo: readGCPObjectInfo(attrs, false),
+			VersionID:  strconv.FormatInt(attrs.Generation, 10),
+			IsCurrent:  attrs.Deleted.IsZero(),
+		})
+	}
+	if len(versions) == 0 {
+		return versions, &CloudStorageError{message: "no versions found for file " + fileName, kind: ErrNotFound}
+	}
+	sortVersions(versions)
+	return versions, nil
+}
+
+// RestoreFileVersion copies a generation over the object, so it becomes the current generation
+func (gc *GCPCloudStorageProxy) RestoreFileVersion(ctx context.Context, containerName string, fileName string,
+	versionID string) error {
+	source, err := gc.object(containerName, fileName, fileOptions{versionID: versionID})
+	if err != nil {
+		return err
+	}
+	dest := gc.storageClient.Bucket(containerName).Object(fileName)
+	if _, err := dest.CopierFrom(source).Run(ctx); err != nil {
+		return wrapError("unable to restore version "+versionID+" of file "+fileName, err)
+	}
+	return nil
+}
+
+// checkSoftDelete fails for a bucket without a soft delete policy, which is what keeps deleted objects
+func (gc *GCPCloudStorageProxy) checkSoftDelete(ctx context.Context, containerName string) error {
+	attrs, err := gc.storageClient.Bucket(containerName).Attrs(ctx)
+	if err != nil {
+		return wrapError("unable to get the soft delete policy of bucket "+containerName, err)
+	}
+	if attrs.SoftDeletePolicy == nil || attrs.SoftDeletePolicy.RetentionDuration <= 0 {
+		return recoveryNotEnabled(containerName, "soft delete")
+	}
+	return nil
+}
+
+// softDeletedObjects returns the newest soft-deleted generation of each object under a prefix
+func (gc *GCPCloudStorageProxy) softDeletedObjects(ctx context.Context, containerName string,
+	prefix string) (map[string]*storage.ObjectAttrs, error) {
+	newest := make(map[string]*storage.ObjectAttrs)
+	it := gc.storageClient.Bucket(containerName).Objects(ctx, &storage.Query{Prefix: prefix, SoftDeleted: true})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return newest, nil
+		}
+		if err != nil {
+			return newest, wrapError("unable to list deleted files in bucket "+containerName, err)
+		}
+		if previous, ok := newest[attrs.Name]; !ok || attrs.SoftDeleteTime.After(previous.SoftDeleteTime) {
+			newest[attrs.Name] = attrs
+		}
+	}
+}
+
+// ListDeletedFiles lists the soft-deleted objects under a prefix that have not been uploaded again since
+func (gc *GCPCloudStorageProxy) ListDeletedFiles(ctx context.Context, containerName string,
+	prefix string) ([]DeletedFile, error) {
+	deleted := make([]DeletedFile, 0)
+	if err := gc.checkSoftDelete(ctx, containerName); err != nil {
+		return deleted, err
+	}
+	newest, err := gc.softDeletedObjects(ctx, containerName, prefix)
+	if err != nil {
+		return deleted, err
+	}
+	it := gc.storageClient.Bucket(containerName).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return deleted, wrapError("unable to list contents of bucket "+containerName, err)
+		}
+		delete(newest, attrs.Name)
+	}
+	for _, attrs := range newest {
+		deleted = append(deleted, DeletedFile{ObjectInfo: readGCPObjectInfo(attrs, false), DeletedTime: attrs.SoftDeleteTime})
+	}
+	sortDeletedFiles(deleted)
+	return deleted, nil
+}
+
+// UndeleteFile restores the newest soft-deleted generation of an object. An object that is not deleted is left
+// as it is.
+func (gc *GCPCloudStorageProxy) UndeleteFile(ctx context.Context, containerName string, fileName string) error {
+	if err := gc.checkSoftDelete(ctx, containerName); err != nil {
+		return err
+	}
+	exists, err := gc.Exists(ctx, containerName, fileName)
+	if err != nil || exists {
+		return err
+	}
+	newest, err := gc.softDeletedObjects(ctx, containerName, fileName)
+	if err != nil {
+		return err
+	}
+	attrs, ok := newest[fileName]
+	if !ok {
+		return &CloudStorageError{message: "file " + fileName + " has no soft-deleted data to recover", kind: ErrNotFound}
+	}
+	object := gc.storageClient.Bucket(containerName).Object(fileName).Generation(attrs.Generation)
+	if _, err := object.Restore(ctx, &storage.RestoreOptions{}); err != nil {
+		return wrapError("unable to undelete file "+fileName, err)
+	}
+	return nil
+}
+
+func (gc *GCPCloudStorageProxy) CreateContainerIfNotExists(ctx context.Context, containerName string) error {
+	err := gc.storageClient.Bucket(containerName).Create(ctx, gc.projectID, nil)
+	var apiErr *googleapi.Error
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict) {
+		return wrapError("unable to create bucket "+containerName, err)
+	}
+	return nil
+}
@@ -0,0 +1,766 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"lib-cloud-proxy-go/util"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type InMemoryCloudStorageProxy struct {
+	mutex      sync.RWMutex
+	containers map[string]map[string]*memoryBlob
+	versioning bool
+	// versions holds the versions of each file from oldest to newest, when versioning is enabled
+	versions    map[string]map[string][]*memoryBlob
+	lastVersion int64
+}
+
+type memoryBlob struct {
+	content      []byte
+	metadata     map[string]string
+	headers      contentHeaders
+	tags         map[string]string
+	lastModified time.Time
+	etag         string
+	versionID    string
+	deleteMarker bool
+}
+
+func (handler ProxyAuthHandlerInMemory) createProxy() (CloudStorageProxy, error) {
+	proxy := NewInMemoryCloudStorageProxy()
+	proxy.versioning = handler.Versioning
+	for _, containerName := range handler.Containers {
+		if err := proxy.CreateContainerIfNotExists(context.Background(), containerName); err != nil {
+			return nil, err
+		}
+	}
+	return proxy, nil
+}
+
+func NewInMemoryCloudStorageProxy() *InMemoryCloudStorageProxy {
+	return &InMemoryCloudStorageProxy{
+		containers: make(map[string]map[string]*memoryBlob),
+		versions:   make(map[string]map[string][]*memoryBlob),
+	}
+}
+
+// container must be called with the mutex held
+func (mem *InMemoryCloudStorageProxy) container(containerName string) (map[string]*memoryBlob, error) {
+	blobs, ok := mem.containers[containerName]
+	if !ok {
+		return nil, wrapError("container "+containerName+" does not exist", errContainerNotFound)
+	}
+	return blobs, nil
+}
+
+// blob must be called with the mutex held
+func (mem *InMemoryCloudStorageProxy) blob(containerName string, fileName string) (*memoryBlob, error) {
+	blobs, err := mem.container(containerName)
+	if err != nil {
+		return nil, err
+	}
+	blob, ok := blobs[fileName]
+	if !ok {
+		return nil, wrapError("unable to get file "+fileName, fs.ErrNotExist)
+	}
+	return blob, nil
+}
+
+// version must be called with the mutex held. It finds a version of a file, or the current version when the
+// version ID is empty.
+func (mem *InMemoryCloudStorageProxy) version(containerName string, fileName string, versionID string) (*memoryBlob, error) {
+	if versionID == "" {
+		return mem.blob(containerName, fileName)
+	}
+	if !mem.versioning {
+		return nil, versionsNotSupported("in-memory storage without versioning")
+	}
+	if _, err := mem.container(containerName); err != nil {
+		return nil, err
+	}
+	for _, version := range mem.versions[containerName][fileName] {
+		if version.versionID == versionID {
+			return version, nil
+		}
+	}
+	return nil, wrapError("unable to get version "+versionID+" of file "+fileName, fs.ErrNotExist)
+}
+
+// addVersion must be called with the mutex held. It makes a blob or delete marker the newest version of a file.
+func (mem *InMemoryCloudStorageProxy) addVersion(containerName string, fileName string, blob *memoryBlob) {
+	if blob.deleteMarker {
+		delete(mem.containers[containerName], fileName)
+	} else {
+		mem.containers[containerName][fileName] = blob
+	}
+	if !mem.versioning {
+		return
+	}
+	mem.lastVersion++
+	blob.versionID = strconv.FormatInt(mem.lastVersion, 10)
+	mem.versions[containerName][fileName] = append(mem.versions[containerName][fileName], blob)
+}
+
+// removeVersion must be called with the mutex held. When the newest version is removed, the version before it
+// becomes the current version, unless it is a delete marker.
+func (mem *InMemoryCloudStorageProxy) removeVersion(containerName string, fileName string, blob *memoryBlob) {
+	versions := mem.versions[containerName][fileName]
+	index := slices.Index(versions, blob)
+	versions = slices.Delete(versions, index, index+1)
+	if len(versions) == 0 {
+		delete(mem.versions[containerName], fileName)
+	} else {
+		mem.versions[containerName][fileName] = versions
+	}
+	if index < len(versions) {
+		return
+	}
+	if len(versions) == 0 || versions[len(versions)-1].deleteMarker {
+		delete(mem.containers[containerName], fileName)
+	} else {
+		mem.containers[containerName][fileName] = versions[len(versions)-1]
+	}
+}
+
+// splitByDelimiter applies "/" delimiter semantics to a sorted list of keys: keys under the prefix that contain
+// no further delimiter are files, and everything else is rolled up into the folder that contains it
+func splitByDelimiter(sortedKeys []string, prefix string) ([]string, []string) {
+	files := make([]string, 0)
+	folders := make([]string, 0)
+	for _, key := range sortedKeys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		remainder := key[len(prefix):]
+		if index := strings.Index(remainder, "/"); index >= 0 {
+			folder := prefix + remainder[:index+1]
+			if len(folders) == 0 || folders[len(folders)-1] != folder {
+				folders = append(folders, folder)
+			}
+		} else {
+			files = append(files, key)
+		}
+	}
+	return files, folders
+}
+
+func (mem *InMemoryCloudStorageProxy) listFilesOrFolders(ctx context.Context, containerName string, maxNumber int,
+	prefix string, listType blobListType) ([]string, error) {
+	if maxNumber <= 0 {
+		maxNumber = max_RESULT
+	}
+	if err := ctx.Err(); err != nil {
+		return make([]string, 0), wrapError("unable to list contents of container "+containerName, err)
+	}
+	mem.mutex.RLock()
+	blobs, err := mem.container(containerName)
+	keys := make([]string, 0, len(blobs))
+	for key := range blobs {
+		keys = append(keys, key)
+	}
+	mem.mutex.RUnlock()
+	if err != nil {
+		return make([]string, 0), err
+	}
+	sort.Strings(keys)
+	itemList, folders := splitByDelimiter(keys, prefix)
+	if listType == listTypeFolder {
+		itemList = folders
+	}
+	if len(itemList) > maxNumber {
+		itemList = itemList[:maxNumber]
+	}
+	return itemList, nil
+}
+
+func (mem *InMemoryCloudStorageProxy) ListFiles(ctx context.Context, containerName string, maxNumber int,
+	prefix string) ([]string, error) {
+	return mem.listFilesOrFolders(ctx, containerName, maxNumber, prefix, listTypeFile)
+}
+
+func (mem *InMemoryCloudStorageProxy) ListFolders(ctx context.Context, containerName string, maxNumber int,
+	prefix string) ([]string, error) {
+	return mem.listFilesOrFolders(ctx, containerName, maxNumber, prefix, listTypeFolder)
+}
+
+func (mem *InMemoryCloudStorageProxy) ListObjects(ctx context.Context, containerName string, maxNumber int,
+	prefix string, includeMetadata bool) ([]ObjectInfo, error) {
+	if maxNumber <= 0 {
+		maxNumber = max_RESULT
+	}
+	if err := ctx.Err(); err != nil {
+		return make([]ObjectInfo, 0), wrapError("unable to list contents of container "+containerName, err)
+	}
+	mem.mutex.RLock()
+	defer mem.mutex.RUnlock()
+	blobs, err := mem.container(containerName)
+	if err != nil {
+		return make([]ObjectInfo, 0), err
+	}
+	keys := make([]string, 0, len(blobs))
+	for key := range blobs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	files, _ := splitByDelimiter(keys, prefix)
+	objects := make([]ObjectInfo, 0, min(len(files), maxNumber))
+	for _, file := range files[:min(len(files), maxNumber)] {
+		objects = append(objects, blobs[file].objectInfo(file, includeMetadata))
+	}
+	return objects, nil
+}
+
+func (mem *InMemoryCloudStorageProxy) ListObjectsPage(ctx context.Context, containerName string,
+	options ListOptions) (ObjectPage, error) {
+	if err := ctx.Err(); err != nil {
+		return ObjectPage{Objects: make([]ObjectInfo, 0), Folders: make([]string, 0)},
+			wrapError("unable to list contents of container "+containerName, err)
+	}
+	mem.mutex.RLock()
+	defer mem.mutex.RUnlock()
+	blobs, err := mem.container(containerName)
+	if err != nil {
+		return ObjectPage{Objects: make([]ObjectInfo, 0), Folders: make([]string, 0)}, err
+	}
+	keys := make([]string, 0, len(blobs))
+	for key := range blobs {
+		if strings.HasPrefix(key, options.Prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	files, folders := keys, make([]string, 0)
+	if !options.Recursive {
+		files, folders = splitByDelimiter(keys, options.Prefix)
+	}
+	objects := make([]ObjectInfo, len(files))
+	for i, file := range files {
+		objects[i] = blobs[file].objectInfo(file, false)
+	}
+	page, err := pageListing(objects, folders, options)
+	if err == nil && options.IncludeMetadata {
+		for i, object := range page.Objects {
+			page.Objects[i] = blobs[object.Name].objectInfo(object.Name, true)
+		}
+	}
+	return page, err
+}
+
+func (blob *memoryBlob) objectInfo(name string, includeMetadata bool) ObjectInfo {
+	object := ObjectInfo{
+		Name:         name,
+		Size:         int64(len(blob.content)),
+		LastModified: blob.lastModified,
+		ETag:         blob.etag,
+		ContentType:  blob.headers.ContentType,
+	}
+	if includeMetadata {
+		object.Metadata = make(map[string]string, len(blob.metadata))
+		for key, value := range blob.metadata {
+			object.Metadata[key] = value
+		}
+	}
+	return object
+}
+
+func (mem *InMemoryCloudStorageProxy) getFileContentAndMetadata(ctx context.Context, containerName string,
+	fileName string, options fileOptions) ([]byte, map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, wrapError("unable to get file "+fileName, err)
+	}
+	mem.mutex.RLock()
+	defer mem.mutex.RUnlock()
+	blob, err := mem.version(containerName, fileName, options.versionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if blob.deleteMarker {
+		return nil, nil, wrapError("version "+options.versionID+" of file "+fileName+" is a delete marker",
+			fs.ErrNotExist)
+	}
+	metadata := make(map[string]string, len(blob.metadata)+4)
+	for key, value := range blob.metadata {
+		metadata[key] = value
+	}
+	metadata["last_modified"] = blob.lastModified.Format(time_FORMAT)
+	metadata["content_length"] = strconv.Itoa(len(blob.content))
+	metadata["etag"] = blob.etag
+	contentMD5 := md5.Sum(blob.content)
+	metadata["content_md5"] = base64.StdEncoding.EncodeToString(contentMD5[:])
+	if blob.versionID != "" {
+		metadata["version_id"] = blob.versionID
+	}
+	blob.headers.addTo(metadata)
+	// stored content is never modified in place, so it can be shared with readers
+	return blob.content, metadata, nil
+}
+
+func (mem *InMemoryCloudStorageProxy) GetFile(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) (CloudFile, error) {
+	content, metadata, err := mem.getFileContentAndMetadata(ctx, containerName, fileName, applyFileOptions(options))
+	cloudFile := CloudFile{
+		Container: containerName,
+		FileName:  fileName,
+		Metadata:  metadata,
+		Content:   string(content),
+	}
+	return cloudFile, err
+}
+
+func (mem *InMemoryCloudStorageProxy) GetFileContentAsString(ctx context.Context, containerName string, fileName string) (string, error) {
+	content, _, err := mem.getFileContentAndMetadata(ctx, containerName, fileName, fileOptions{})
+	return string(content), err
+}
+
+func (mem *InMemoryCloudStorageProxy) GetFileContentAsInputStream(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) (io.ReadCloser, error) {
+	content, _, err := mem.getFileContentAndMetadata(ctx, containerName, fileName, applyFileOptions(options))
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// GetFileRange accepts WithVersion and IfMatch
+func (mem *InMemoryCloudStorageProxy) GetFileRange(ctx context.Context, containerName string, fileName string,
+	offset int64, length int64, options ...FileOption) (io.ReadCloser, error) {
+	if err := checkRange(fileName, offset, length); err != nil {
+		return nil, err
+	}
+	applied := applyFileOptions(options)
+	content, metadata, err := mem.getFileContentAndMetadata(ctx, containerName, fileName, applied)
+	if err != nil {
+		return nil, wrapConditionalError("unable to get range of file "+fileName, err, applied)
+	}
+	if err := checkConditions(fileName, applied, metadata["etag"]); err != nil {
+		return nil, err
+	}
+	size := int64(len(content))
+	if offset > 0 && offset >= size {
+		return nil, rangePastEnd(fileName, offset)
+	}
+	if length < 0 || offset+length > size {
+		length = size - offset
+	}
+	return io.NopCloser(bytes.NewReader(content[offset : offset+length])), nil
+}
+
+func (mem *InMemoryCloudStorageProxy) OpenReader(ctx context.Context, containerName string, fileName string) (*FileReader, error) {
+	return openReader(ctx, mem, containerName, fileName)
+}
+
+func (mem *InMemoryCloudStorageProxy) GetLargeFileContentAsByteArray(ctx context.Context, containerName string, fileName string,
+	fileSize int64, concurrency int) ([]byte, error) {
+	content, _, err := mem.getFileContentAndMetadata(ctx, containerName, fileName, fileOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(content), nil
+}
+
+func (mem *InMemoryCloudStorageProxy) GetMetadata(ctx context.Context, containerName string, fileName string) (map[string]string, error) {
+	_, metadata, err := mem.getFileContentAndMetadata(ctx, containerName, fileName, fileOptions{})
+	return metadata, err
+}
+
+func (mem *InMemoryCloudStorageProxy) Exists(ctx context.Context, containerName string, fileName string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, wrapError("unable to check whether file "+fileName+" exists", err)
+	}
+	mem.mutex.RLock()
+	defer mem.mutex.RUnlock()
+	_, err := mem.blob(containerName, fileName)
+	return existsResult(fileName, err)
+}
+
+func (mem *InMemoryCloudStorageProxy) putFile(ctx context.Context, containerName string, fileName string,
+	metadata map[string]string, content []byte, options fileOptions) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", wrapError("unable to upload file "+fileName, err)
+	}
+	if fileName == "" {
+		return "", &CloudStorageError{message: "invalid file name " + fileName}
+	}
+	metadata, headers := splitContentHeaders(metadata)
+	blob := &memoryBlob{
+		content:      content,
+		metadata:     make(map[string]string, len(metadata)),
+		headers:      headers,
+		lastModified: time.Now().UTC(),
+		etag:         fmt.Sprintf(`"%x"`, md5.Sum(content)),
+	}
+	for key, value := range metadata {
+		blob.metadata[util.NormalizeString(key)] = value
+	}
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	if _, err := mem.container(containerName); err != nil {
+		return "", err
+	}
+	if err := checkConditions(fileName, options, mem.currentETag(containerName, fileName)); err != nil {
+		return "", err
+	}
+	mem.addVersion(containerName, fileName, blob)
+	return blob.etag, nil
+}
+
+// currentETag must be called with the mutex held. It returns an empty ETag for a file that does not exist.
+func (mem *InMemoryCloudStorageProxy) currentETag(containerName string, fileName string) string {
+	if blob, ok := mem.containers[containerName][fileName]; ok {
+		return blob.etag
+	}
+	return ""
+}
+
+// UploadFileFromString returns the ETag of the new file, and accepts IfMatch and IfNoneMatch
+func (mem *InMemoryCloudStorageProxy) UploadFileFromString(ctx context.Context, containerName string, fileName string,
+	metadata map[string]string, content string, options ...FileOption) (string, error) {
+	return mem.putFile(ctx, containerName, fileName, metadata, []byte(content), applyFileOptions(options))
+}
+
+// UploadFileFromInputStream returns the ETag of the new file, and accepts IfMatch and IfNoneMatch
+func (mem *InMemoryCloudStorageProxy) UploadFileFromInputStream(ctx context.Context, containerName string, fileName string,
+	metadata map[string]string, inputStream io.Reader, fileSizeBytes int64, concurrency int,
+	options ...FileOption) (string, error) {
+	content, err := io.ReadAll(inputStream)
+	if err != nil {
+		return "", wrapError("unable to read input stream for file "+fileName, err)
+	}
+	return mem.putFile(ctx, containerName, fileName, metadata, content, applyFileOptions(options))
+}
+
+// OpenWriter keeps the parts of the file in memory until Close commits them
+func (mem *InMemoryCloudStorageProxy) OpenWriter(ctx context.Context, containerName string, fileName string,
+	options WriterOptions) (*FileWriter, error) {
+	mem.mutex.RLock()
+	_, err := mem.container(containerName)
+	mem.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	uploader := &memoryPartUploader{
+		mem:           mem,
+		containerName: containerName,
+		fileName:      fileName,
+		metadata:      options.Metadata,
+		options:       applyFileOptions(options.FileOptions),
+		parts:         make(map[int][]byte),
+	}
+	// the parts are limited as they are on S3
+	return newFileWriter(ctx, fileName, uploader, options.partSize(), options.concurrency(),
+		partLimits{maxParts: max_PARTS, maxPartSize: size_5GiB, maxSize: size_5TiB}), nil
+}
+
+type memoryPartUploader struct {
+	mem           *InMemoryCloudStorageProxy
+	containerName string
+	fileName      string
+	metadata      map[string]string
+	options       fileOptions
+	mutex         sync.Mutex
+	parts         map[int][]byte
+}
+
+func (uploader *memoryPartUploader) uploadPart(ctx context.Context, number int, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError(fmt.Sprintf("unable to upload part %d of file %s", number, uploader.fileName), err)
+	}
+	uploader.mutex.Lock()
+	defer uploader.mutex.Unlock()
+	uploader.parts[number] = data
+	return nil
+}
+
+func (uploader *memoryPartUploader) commit(ctx context.Context, parts int) (string, error) {
+	uploader.mutex.Lock()
+	defer uploader.mutex.Unlock()
+	content := make([]byte, 0)
+	for number := 1; number <= parts; number++ {
+		content = append(content, uploader.parts[number]...)
+	}
+	return uploader.mem.putFile(ctx, uploader.containerName, uploader.fileName, uploader.metadata, content,
+		uploader.options)
+}
+
+func (uploader *memoryPartUploader) abort(ctx context.Context) {
+	uploader.mutex.Lock()
+	defer uploader.mutex.Unlock()
+	uploader.parts = nil
+}
+
+// DeleteFile leaves a delete marker as the newest version when versioning is enabled. Deleting a version removes
+// it, and a delete marker can be removed the same way to bring back the version before it. IfMatch is also accepted.
+func (mem *InMemoryCloudStorageProxy) DeleteFile(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError("unable to delete file "+fileName, err)
+	}
+	applied := applyFileOptions(options)
+	versionID := applied.versionID
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	blob, err := mem.version(containerName, fileName, versionID)
+	if err != nil {
+		return wrapConditionalError("unable to delete file "+fileName, err, applied)
+	}
+	if err := checkConditions(fileName, applied, blob.etag); err != nil {
+		return err
+	}
+	switch {
+	case versionID != "":
+		mem.removeVersion(containerName, fileName, blob)
+	case mem.versioning:
+		mem.addVersion(containerName, fileName, &memoryBlob{deleteMarker: true, lastModified: time.Now().UTC()})
+	default:
+		delete(mem.containers[containerName], fileName)
+	}
+	return nil
+}
+
+func (mem *InMemoryCloudStorageProxy) DeleteFiles(ctx context.Context, containerName string,
+	fileNames []string) ([]FileResult, error) {
+	mem.mutex.RLock()
+	_, err := mem.container(containerName)
+	mem.mutex.RUnlock()
+	if err != nil {
+		return make([]FileResult, 0), err
+	}
+	return deleteEach(ctx, fileNames, 1, func(ctx context.Context, fileName string) error {
+		return mem.DeleteFile(ctx, containerName, fileName)
+	}), nil
+}
+
+func (mem *InMemoryCloudStorageProxy) DeletePrefix(ctx context.Context, containerName string, prefix string,
+	concurrency int) ([]FileResult, error) {
+	return deletePrefix(ctx, mem, containerName, prefix, concurrency)
+}
+
+func (mem *InMemoryCloudStorageProxy) GetSourceBlobSignedURL(ctx context.Context, containerName string, fileName string) (string, error) {
+	mem.mutex.RLock()
+	_, err := mem.blob(containerName, fileName)
+	mem.mutex.RUnlock()
+	if err != nil {
+		return "", wrapError("could not obtain url for file "+fileName, err)
+	}
+	blobURL := url.URL{Scheme: "memory", Host: containerName, Path: "/" + fileName}
+	return blobURL.String(), nil
+}
+
+func (mem *InMemoryCloudStorageProxy) CopyFileFromRemoteStorage(ctx context.Context, sourceContainer string, sourceFile string,
+	destContainer string, destFile string, sourceProxy *CloudStorageProxy, concurrency int) error {
+	s := *sourceProxy
+	metadata, err := s.GetMetadata(ctx, sourceContainer, sourceFile)
+	if err != nil {
+		return wrapError("unable to read source file metadata", err)
+	}
+	inputStream, err := s.GetFileContentAsInputStream(ctx, sourceContainer, sourceFile)
+	if err != nil {
+		return wrapError("unable to read source file as stream", err)
+	}
+	defer inputStream.Close()
+	_, err = mem.UploadFileFromInputStream(ctx, destContainer, destFile, userMetadata(metadata), inputStream,
+		getStringAsInt64(metadata["content_length"]), concurrency)
+	return err
+}
+
+func (mem *InMemoryCloudStorageProxy) CopyFileFromLocalStorage(ctx context.Context, sourceContainer string, sourceFile string,
+	destContainer string, destFile string, concurrency int) error {
+	var s CloudStorageProxy = mem
+	return mem.CopyFileFromRemoteStorage(ctx, sourceContainer, sourceFile, destContainer, destFile, &s, concurrency)
+}
+
+func (mem *InMemoryCloudStorageProxy) MoveFile(ctx context.Context, sourceContainer string, sourceFile string,
+	destContainer string, destFile string) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError("unable to move file "+sourceFile, err)
+	}
+	if destFile == "" {
+		return &CloudStorageError{message: "invalid file name " + destFile}
+	}
+	if mem.versioning {
+		// the versions of the source stay where they are, as with copying and deleting in a versioned bucket
+		return moveFile(ctx, mem, sourceContainer, sourceFile, destContainer, destFile)
+	}
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	destBlobs, err := mem.container(destContainer)
+	if err != nil {
+		return err
+	}
+	blob, err := mem.blob(sourceContainer, sourceFile)
+	if err != nil {
+		return wrapError("unable to move file "+sourceFile, err)
+	}
+	delete(mem.containers[sourceContainer], sourceFile)
+	destBlobs[destFile] = blob
+	return nil
+}
+
+func (mem *InMemoryCloudStorageProxy) MovePrefix(ctx context.Context, sourceContainer string, sourcePrefix string,
+	destContainer string, destPrefix string, concurrency int) ([]FileResult, error) {
+	return movePrefix(ctx, mem, sourceContainer, sourcePrefix, destContainer, destPrefix, concurrency)
+}
+
+func (mem *InMemoryCloudStorageProxy) GetTags(ctx context.Context, containerName string, fileName string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapError("unable to get tags for file "+fileName, err)
+	}
+	mem.mutex.RLock()
+	defer mem.mutex.RUnlock()
+	blob, err := mem.blob(containerName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(blob.tags))
+	for key, value := range blob.tags {
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+func (mem *InMemoryCloudStorageProxy) SetTags(ctx context.Context, containerName string, fileName string,
+	tags map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError("unable to set tags for file "+fileName, err)
+	}
+	newTags := make(map[string]string, len(tags))
+	for key, value := range tags {
+		newTags[key] = value
+	}
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	blob, err := mem.blob(containerName, fileName)
+	if err != nil {
+		return err
+	}
+	blob.tags = newTags
+	return nil
+}
+
+func (mem *InMemoryCloudStorageProxy) FindFilesByTags(ctx context.Context, containerName string, prefix string,
+	tags map[string]string) ([]string, error) {
+	return findFilesByTags(ctx, mem, containerName, prefix, tags)
+}
+
+func (mem *InMemoryCloudStorageProxy) ListFileVersions(ctx context.Context, containerName string,
+	fileName string) ([]FileVersion, error) {
+	if err := ctx.Err(); err != nil {
+		return make([]FileVersion, 0), wrapError("unable to list versions of file "+fileName, err)
+	}
+	if !mem.versioning {
+		return make([]FileVersion, 0), versionsNotSupported("in-memory storage without versioning")
+	}
+	mem.mutex.RLock()
+	defer mem.mutex.RUnlock()
+	if _, err := mem.container(containerName); err != nil {
+		return make([]FileVersion, 0), err
+	}
+	history := mem.versions[containerName][fileName]
+	if len(history) == 0 {
+		return make([]FileVersion, 0), wrapError("no versions found for file "+fileName, fs.ErrNotExist)
+	}
+	versions := make([]FileVersion, len(history))
+	for i, blob := range history {
+		// newest first
+		versions[len(history)-1-i] = FileVersion{
+			ObjectInfo:     blob.objectInfo(fileName, false),
+			VersionID:      blob.versionID,
+			IsCurrent:      i == len(history)-1,
+			IsDeleteMarker: blob.deleteMarker,
+		}
+	}
+	return versions, nil
+}
+
+// RestoreFileVersion adds a copy of a version as the newest version of the file
+func (mem *InMemoryCloudStorageProxy) RestoreFileVersion(ctx context.Context, containerName string, fileName string,
+	versionID string) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError("unable to restore version "+versionID+" of file "+fileName, err)
+	}
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	blob, err := mem.version(containerName, fileName, versionID)
+	if err != nil {
+		return wrapError("unable to restore version "+versionID+" of file "+fileName, err)
+	}
+	if blob.deleteMarker {
+		return &CloudStorageError{message: "version " + versionID + " of file " + fileName + " is a delete marker"}
+	}
+	restored := *blob
+	restored.lastModified = time.Now().UTC()
+	mem.addVersion(containerName, fileName, &restored)
+	return nil
+}
+
+// ListDeletedFiles lists the files under a prefix whose newest version is a delete marker, when versioning is enabled
+func (mem *InMemoryCloudStorageProxy) ListDeletedFiles(ctx context.Context, containerName string,
+	prefix string) ([]DeletedFile, error) {
+	deleted := make([]DeletedFile, 0)
+	if err := ctx.Err(); err != nil {
+		return deleted, wrapError("unable to list deleted files in container "+containerName, err)
+	}
+	mem.mutex.RLock()
+	defer mem.mutex.RUnlock()
+	if _, err := mem.container(containerName); err != nil {
+		return deleted, err
+	}
+	if !mem.versioning {
+		return deleted, recoveryNotEnabled(containerName, "versioning")
+	}
+	for fileName, history := range mem.versions[containerName] {
+		if !strings.HasPrefix(fileName, prefix) || !history[len(history)-1].deleteMarker {
+			continue
+		}
+		for i := len(history) - 2; i >= 0; i-- {
+			if !history[i].deleteMarker {
+				deleted = append(deleted, DeletedFile{
+					ObjectInfo:  history[i].objectInfo(fileName, false),
+					DeletedTime: history[len(history)-1].lastModified,
+				})
+				break
+			}
+		}
+	}
+	sortDeletedFiles(deleted)
+	return deleted, nil
+}
+
+// UndeleteFile removes the delete markers of a file, so its newest version is current again
+func (mem *InMemoryCloudStorageProxy) UndeleteFile(ctx context.Context, containerName string, fileName string) error {
+	mem.mutex.RLock()
+	_, err := mem.container(containerName)
+	mem.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+	if !mem.versioning {
+		return recoveryNotEnabled(containerName, "versioning")
+	}
+	return removeDeleteMarkers(ctx, mem, containerName, fileName)
+}
+
+func (mem *InMemoryCloudStorageProxy) CreateContainerIfNotExists(ctx context.Context, containerName string) error {
+	if containerName == "" {
+		return &CloudStorageError{message: "invalid container name " + containerName}
+	}
+	mem.mutex.Lock()
+	defer mem.mutex.Unlock()
+	if _, ok := mem.containers[containerName]; !ok {
+		mem.containers[containerName] = make(map[string]*memoryBlob)
+		mem.versions[containerName] = make(map[string][]*memoryBlob)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"golang.org/x/net/context"
+	"time"
+)
+
+// LeaseProxy is implemented by the proxies that can lease a file natively, so that only the holder of the lease can
+// change or delete it until the lease expires. The lock package uses leases when a proxy offers them, and conditional
+// writes otherwise. AzureCloudStorageProxy and AzureDataLakeCloudStorageProxy lease blobs for 15 to 60 seconds.
+type LeaseProxy interface {
+	// AcquireLease leases a file, creating it empty when it does not exist yet, and returns the lease ID.
+	// When the file is already leased the error matches ErrPreconditionFailed.
+	AcquireLease(ctx context.Context, containerName string, fileName string, duration time.Duration) (string, error)
+	// RenewLease restarts the duration of a lease. When the lease has been lost the error matches ErrPreconditionFailed.
+	RenewLease(ctx context.Context, containerName string, fileName string, leaseID string) error
+	ReleaseLease(ctx context.Context, containerName string, fileName string, leaseID string) error
+}
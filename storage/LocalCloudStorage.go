@@ -0,0 +1,810 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"lib-cloud-proxy-go/util"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metadata sidecars and in-flight uploads live in hidden directories directly under the root,
+// which can never collide with a container because container names may not start with "."
+const local_METADATA_DIR = ".metadata"
+const local_STAGING_DIR = ".staging"
+
+type LocalCloudStorageProxy struct {
+	rootDir string
+}
+
+type localSidecar struct {
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Headers  contentHeaders    `json:"headers"`
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+func (handler ProxyAuthHandlerLocalFilesystem) createProxy() (CloudStorageProxy, error) {
+	if handler.RootDir == "" {
+		return nil, &CloudStorageError{message: "a root directory is required for local filesystem storage"}
+	}
+	rootDir, err := filepath.Abs(handler.RootDir)
+	if err != nil {
+		return nil, wrapError("unable to resolve root directory "+handler.RootDir, err)
+	}
+	if err := os.MkdirAll(rootDir, 0o755); err != nil {
+		return nil, wrapError("unable to create root directory "+rootDir, err)
+	}
+	return &LocalCloudStorageProxy{rootDir: rootDir}, nil
+}
+
+func (lc *LocalCloudStorageProxy) containerPath(containerName string) (string, error) {
+	if containerName == "" || strings.ContainsAny(containerName, `/\`) || strings.HasPrefix(containerName, ".") {
+		return "", &CloudStorageError{message: "invalid container name " + containerName}
+	}
+	return filepath.Join(lc.rootDir, containerName), nil
+}
+
+func (lc *LocalCloudStorageProxy) existingContainerPath(containerName string) (string, error) {
+	containerPath, err := lc.containerPath(containerName)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(containerPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", wrapError("container "+containerName+" does not exist", errContainerNotFound)
+	}
+	if err != nil {
+		return "", wrapError("unable to open container "+containerName, err)
+	}
+	if !info.IsDir() {
+		return "", &CloudStorageError{message: "container " + containerName + " is not a directory"}
+	}
+	return containerPath, nil
+}
+
+func (lc *LocalCloudStorageProxy) filePath(containerName string, fileName string) (string, error) {
+	containerPath, err := lc.containerPath(containerName)
+	if err != nil {
+		return "", err
+	}
+	if !fs.ValidPath(fileName) || fileName == "." {
+		return "", &CloudStorageError{message: "invalid file name " + fileName}
+	}
+	return filepath.Join(containerPath, filepath.FromSlash(fileName)), nil
+}
+
+func (lc *LocalCloudStorageProxy) sidecarPath(containerName string, fileName string) string {
+	return filepath.Join(lc.rootDir, local_METADATA_DIR, containerName, filepath.FromSlash(fileName)+".json")
+}
+
+func (lc *LocalCloudStorageProxy) readSidecar(containerName string, fileName string) (localSidecar, error) {
+	var sidecar localSidecar
+	content, err := os.ReadFile(lc.sidecarPath(containerName, fileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return sidecar, nil
+	}
+	if err != nil {
+		return sidecar, wrapError("unable to read metadata for file "+fileName, err)
+	}
+	if err := json.Unmarshal(content, &sidecar); err != nil {
+		return sidecar, wrapError("unable to parse metadata for file "+fileName, err)
+	}
+	return sidecar, nil
+}
+
+func (lc *LocalCloudStorageProxy) writeSidecar(containerName string, fileName string, sidecar localSidecar) error {
+	sidecarPath := lc.sidecarPath(containerName, fileName)
+	if len(sidecar.Metadata) == 0 && sidecar.Headers == (contentHeaders{}) && len(sidecar.Tags) == 0 {
+		if err := os.Remove(sidecarPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return wrapError("unable to remove metadata for file "+fileName, err)
+		}
+		return nil
+	}
+	content, err := json.Marshal(sidecar)
+	if err != nil {
+		return wrapError("unable to serialize metadata for file "+fileName, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(sidecarPath), 0o755); err != nil {
+		return wrapError("unable to create metadata directory for file "+fileName, err)
+	}
+	if err := os.WriteFile(sidecarPath, content, 0o644); err != nil {
+		return wrapError("unable to write metadata for file "+fileName, err)
+	}
+	return nil
+}
+
+// localEntry is a file found by a listing, with the stat information it was listed with
+type localEntry struct {
+	name string
+	info fs.FileInfo
+}
+
+// listEntries emulates a "/" delimiter: everything up to the last "/" of the prefix is a directory,
+// and the remainder is matched against the names of the entries in that directory. Files and folders
+// are returned in the order the cloud providers list them, which differs from directory order once
+// the trailing "/" is appended to folder names.
+func (lc *LocalCloudStorageProxy) listEntries(ctx context.Context, containerName string,
+	prefix string) ([]localEntry, []string, error) {
+	files := make([]localEntry, 0)
+	folders := make([]string, 0)
+	if err := ctx.Err(); err != nil {
+		return files, folders, wrapError("unable to list contents of container "+containerName, err)
+	}
+	containerPath, err := lc.existingContainerPath(containerName)
+	if err != nil {
+		return files, folders, err
+	}
+	dirPrefix := prefix[:strings.LastIndex(prefix, "/")+1]
+	if dirPrefix != "" && !fs.ValidPath(strings.TrimSuffix(dirPrefix, "/")) {
+		return files, folders, nil
+	}
+	entries, err := os.ReadDir(filepath.Join(containerPath, filepath.FromSlash(dirPrefix)))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+			return files, folders, nil
+		}
+		return files, folders, wrapError("unable to list contents of container "+containerName, err)
+	}
+	for _, entry := range entries {
+		name := dirPrefix + entry.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		// Stat rather than entry.Info so that symlinks are followed
+		info, err := os.Stat(filepath.Join(containerPath, filepath.FromSlash(name)))
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			folders = append(folders, name+"/")
+		} else {
+			files = append(files, localEntry{name: name, info: info})
+		}
+	}
+	sort.Strings(folders)
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, folders, nil
+}
+
+func (lc *LocalCloudStorageProxy) listFilesOrFolders(ctx context.Context, containerName string, maxNumber int,
+	prefix string, listType blobListType) ([]string, error) {
+	if maxNumber <= 0 {
+		maxNumber = max_RESULT
+	}
+	files, itemList, err := lc.listEntries(ctx, containerName, prefix)
+	if err != nil {
+		return make([]string, 0), err
+	}
+	if listType == listTypeFile {
+		itemList = make([]string, len(files))
+		for i, file := range files {
+			itemList[i] = file.name
+		}
+	}
+	if len(itemList) > maxNumber {
+		itemList = itemList[:maxNumber]
+	}
+	return itemList, nil
+}
+
+func (lc *LocalCloudStorageProxy) ListFiles(ctx context.Context, containerName string, maxNumber int,
+	prefix string) ([]string, error) {
+	return lc.listFilesOrFolders(ctx, containerName, maxNumber, prefix, listTypeFile)
+}
+
+func (lc *LocalCloudStorageProxy) ListFolders(ctx context.Context, containerName string, maxNumber int,
+	prefix string) ([]string, error) {
+	return lc.listFilesOrFolders(ctx, containerName, maxNumber, prefix, listTypeFolder)
+}
+
+func (lc *LocalCloudStorageProxy) ListObjects(ctx context.Context, containerName string, maxNumber int,
+	prefix string, includeMetadata bool) ([]ObjectInfo, error) {
+	if maxNumber <= 0 {
+		maxNumber = max_RESULT
+	}
+	files, _, err := lc.listEntries(ctx, containerName, prefix)
+	if err != nil {
+		return make([]ObjectInfo, 0), err
+	}
+	objects := make([]ObjectInfo, 0, min(len(files), maxNumber))
+	for _, file := range files[:min(len(files), maxNumber)] {
+		object := fileObjectInfo(file.name, file.info)
+		if includeMetadata {
+			sidecar, err := lc.readSidecar(containerName, file.name)
+			if err != nil {
+				return objects, err
+			}
+			object.ContentType = sidecar.Headers.ContentType
+			object.Metadata = make(map[string]string, len(sidecar.Metadata))
+			for key, value := range sidecar.Metadata {
+				object.Metadata[util.NormalizeString(key)] = value
+			}
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+func (lc *LocalCloudStorageProxy) ListObjectsPage(ctx context.Context, containerName string,
+	options ListOptions) (ObjectPage, error) {
+	var files []localEntry
+	var folders []string
+	var err error
+	if options.Recursive {
+		files, err = lc.walkEntries(ctx, containerName, options.Prefix)
+	} else {
+		files, folders, err = lc.listEntries(ctx, containerName, options.Prefix)
+	}
+	if err != nil {
+		return ObjectPage{Objects: make([]ObjectInfo, 0), Folders: make([]string, 0)}, err
+	}
+	page, err := pageEntries(files, folders, options)
+	if err != nil || !options.IncludeMetadata {
+		return page, err
+	}
+	for i := range page.Objects {
+		sidecar, err := lc.readSidecar(containerName, page.Objects[i].Name)
+		if err != nil {
+			return page, err
+		}
+		page.Objects[i].ContentType = sidecar.Headers.ContentType
+		page.Objects[i].Metadata = make(map[string]string, len(sidecar.Metadata))
+		for key, value := range sidecar.Metadata {
+			page.Objects[i].Metadata[util.NormalizeString(key)] = value
+		}
+	}
+	return page, nil
+}
+
+// walkEntries lists every file under a prefix, at all levels, sorted by name
+func (lc *LocalCloudStorageProxy) walkEntries(ctx context.Context, containerName string, prefix string) ([]localEntry, error) {
+	files := make([]localEntry, 0)
+	containerPath, err := lc.existingContainerPath(containerName)
+	if err != nil {
+		return files, err
+	}
+	dirPrefix := prefix[:strings.LastIndex(prefix, "/")+1]
+	if dirPrefix != "" && !fs.ValidPath(strings.TrimSuffix(dirPrefix, "/")) {
+		return files, nil
+	}
+	root := filepath.Join(containerPath, filepath.FromSlash(dirPrefix))
+	err = filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if filePath == root && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if filePath == root {
+			return nil
+		}
+		relPath, err := filepath.Rel(containerPath, filePath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relPath)
+		if entry.IsDir() {
+			if !strings.HasPrefix(name+"/", prefix) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		// Stat rather than entry.Info so that symlinks are followed
+		info, err := os.Stat(filePath)
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		files = append(files, localEntry{name: name, info: info})
+		return nil
+	})
+	if err != nil {
+		return files, wrapError("unable to list contents of container "+containerName, err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, nil
+}
+
+// pageEntries cuts one page out of a complete directory listing
+func pageEntries(files []localEntry, folders []string, options ListOptions) (ObjectPage, error) {
+	objects := make([]ObjectInfo, len(files))
+	for i, file := range files {
+		objects[i] = fileObjectInfo(file.name, file.info)
+	}
+	return pageListing(objects, folders, options)
+}
+
+// fileObjectInfo describes a file from its stat information, which has no content type or storage tier.
+// Its ETag is derived from the modification time and size, which change whenever the file is rewritten.
+func fileObjectInfo(name string, info fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Name:         name,
+		Size:         info.Size(),
+		LastModified: info.ModTime().UTC(),
+		ETag:         fileETag(info),
+	}
+}
+
+func fileETag(info fs.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+func (lc *LocalCloudStorageProxy) openFile(ctx context.Context, containerName string, fileName string) (*os.File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, wrapError("unable to get file "+fileName, err)
+	}
+	filePath, err := lc.filePath(containerName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, wrapError("unable to get file "+fileName, err)
+	}
+	info, err := file.Stat()
+	if err == nil && info.IsDir() {
+		err = &fs.PathError{Op: "open", Path: filePath, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, wrapError("unable to get file "+fileName, err)
+	}
+	return file, nil
+}
+
+func (lc *LocalCloudStorageProxy) GetFile(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) (CloudFile, error) {
+	cloudFile := CloudFile{
+		Container: containerName,
+		FileName:  fileName,
+	}
+	if err := checkNoVersion("local storage", options); err != nil {
+		return cloudFile, err
+	}
+	metadata, err := lc.GetMetadata(ctx, containerName, fileName)
+	if err != nil {
+		return cloudFile, err
+	}
+	cloudFile.Metadata = metadata
+	cloudFile.Content, err = lc.GetFileContentAsString(ctx, containerName, fileName)
+	return cloudFile, err
+}
+
+func (lc *LocalCloudStorageProxy) GetFileContentAsString(ctx context.Context, containerName string, fileName string) (string, error) {
+	file, err := lc.openFile(ctx, containerName, fileName)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return "", wrapError("unable to read content of file "+fileName, err)
+	}
+	return string(content), nil
+}
+
+func (lc *LocalCloudStorageProxy) GetFileContentAsInputStream(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) (io.ReadCloser, error) {
+	if err := checkNoVersion("local storage", options); err != nil {
+		return nil, err
+	}
+	return lc.openFile(ctx, containerName, fileName)
+}
+
+// GetFileRange accepts IfMatch
+func (lc *LocalCloudStorageProxy) GetFileRange(ctx context.Context, containerName string, fileName string,
+	offset int64, length int64, options ...FileOption) (io.ReadCloser, error) {
+	if err := checkNoVersion("local storage", options); err != nil {
+		return nil, err
+	}
+	if err := checkRange(fileName, offset, length); err != nil {
+		return nil, err
+	}
+	file, err := lc.openFile(ctx, containerName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, wrapError("unable to get file "+fileName, err)
+	}
+	// the file that is open stays as it is when it is replaced, so the condition holds for the whole range
+	if err := checkConditions(fileName, applyFileOptions(options), fileETag(info)); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return newFileRange(file, fileName, offset, length, info.Size())
+}
+
+func (lc *LocalCloudStorageProxy) OpenReader(ctx context.Context, containerName string, fileName string) (*FileReader, error) {
+	return openReader(ctx, lc, containerName, fileName)
+}
+
+func (lc *LocalCloudStorageProxy) GetLargeFileContentAsByteArray(ctx context.Context, containerName string, fileName string,
+	fileSize int64, concurrency int) ([]byte, error) {
+	file, err := lc.openFile(ctx, containerName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, wrapError("unable to read content of file "+fileName, err)
+	}
+	return content, nil
+}
+
+func (lc *LocalCloudStorageProxy) GetMetadata(ctx context.Context, containerName string, fileName string) (map[string]string, error) {
+	file, err := lc.openFile(ctx, containerName, fileName)
+	if err != nil {
+		return nil, wrapError("unable to get metadata for file "+fileName, err)
+	}
+	info, err := file.Stat()
+	_ = file.Close()
+	if err != nil {
+		return nil, wrapError("unable to get metadata for file "+fileName, err)
+	}
+	sidecar, err := lc.readSidecar(containerName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]string, len(sidecar.Metadata)+3)
+	for key, value := range sidecar.Metadata {
+		metadata[util.NormalizeString(key)] = value
+	}
+	metadata["last_modified"] = info.ModTime().UTC().Format(time_FORMAT)
+	metadata["content_length"] = strconv.FormatInt(info.Size(), 10)
+	metadata["etag"] = fileETag(info)
+	sidecar.Headers.addTo(metadata)
+	return metadata, nil
+}
+
+func (lc *LocalCloudStorageProxy) Exists(ctx context.Context, containerName string, fileName string) (bool, error) {
+	if _, err := lc.existingContainerPath(containerName); err != nil {
+		return false, err
+	}
+	file, err := lc.openFile(ctx, containerName, fileName)
+	if err != nil {
+		return existsResult(fileName, err)
+	}
+	_ = file.Close()
+	return true, nil
+}
+
+func (lc *LocalCloudStorageProxy) writeFile(ctx context.Context, containerName string, fileName string,
+	metadata map[string]string, content io.Reader, options fileOptions) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", wrapError("unable to upload file "+fileName, err)
+	}
+	if _, err := lc.existingContainerPath(containerName); err != nil {
+		return "", err
+	}
+	filePath, err := lc.filePath(containerName, fileName)
+	if err != nil {
+		return "", err
+	}
+	stagingDir := filepath.Join(lc.rootDir, local_STAGING_DIR)
+	if err := os.MkdirAll(stagingDir, 0o755); err != nil {
+		return "", wrapError("unable to create staging directory", err)
+	}
+	// content is staged outside the container and renamed into place so that readers never see a partial file
+	staged, err := os.CreateTemp(stagingDir, "upload-*")
+	if err != nil {
+		return "", wrapError("unable to stage file "+fileName, err)
+	}
+	defer os.Remove(staged.Name())
+	_, err = io.Copy(staged, content)
+	if closeErr := staged.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", wrapError("unable to upload file "+fileName, err)
+	}
+	// a stream may end because its context was cancelled, and its content is then not placed
+	if err := ctx.Err(); err != nil {
+		return "", wrapError("unable to upload file "+fileName, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return "", wrapError("unable to create folder for file "+fileName, err)
+	}
+	if err := lc.placeFile(staged.Name(), filePath, fileName, options); err != nil {
+		return "", err
+	}
+	metadata, headers := splitContentHeaders(metadata)
+	if err := lc.writeSidecar(containerName, fileName, localSidecar{Metadata: metadata, Headers: headers}); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", wrapError("unable to upload file "+fileName, err)
+	}
+	return fileETag(info), nil
+}
+
+// placeFile moves a staged file into place. A create-only upload is linked into place, which fails if the file
+// exists, while IfMatch is checked just before the rename and so is not atomic.
+func (lc *LocalCloudStorageProxy) placeFile(stagedPath string, filePath string, fileName string, options fileOptions) error {
+	if options.ifMatch == "" && options.ifNoneMatch == "*" {
+		if err := os.Link(stagedPath, filePath); err != nil {
+			return wrapConditionalError("unable to upload file "+fileName, err, options)
+		}
+		return nil
+	}
+	if options.hasConditions() {
+		etag := ""
+		if info, err := os.Stat(filePath); err == nil && !info.IsDir() {
+			etag = fileETag(info)
+		}
+		if err := checkConditions(fileName, options, etag); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(stagedPath, filePath); err != nil {
+		return wrapError("unable to upload file "+fileName, err)
+	}
+	return nil
+}
+
+// UploadFileFromString returns the ETag of the new file, and accepts IfMatch and IfNoneMatch
+func (lc *LocalCloudStorageProxy) UploadFileFromString(ctx context.Context, containerName string, fileName string,
+	metadata map[string]string, content string, options ...FileOption) (string, error) {
+	return lc.writeFile(ctx, containerName, fileName, metadata, strings.NewReader(content), applyFileOptions(options))
+}
+
+// UploadFileFromInputStream returns the ETag of the new file, and accepts IfMatch and IfNoneMatch
+func (lc *LocalCloudStorageProxy) UploadFileFromInputStream(ctx context.Context, containerName string, fileName string,
+	metadata map[string]string, inputStream io.Reader, fileSizeBytes int64, concurrency int,
+	options ...FileOption) (string, error) {
+	return lc.writeFile(ctx, containerName, fileName, metadata, inputStream, applyFileOptions(options))
+}
+
+func (lc *LocalCloudStorageProxy) OpenWriter(ctx context.Context, containerName string, fileName string,
+	options WriterOptions) (*FileWriter, error) {
+	return newFileWriter(ctx, fileName, newPipeUploader(ctx, lc, containerName, fileName, options),
+		options.partSize(), 1, partLimits{}), nil
+}
+
+// DeleteFile accepts IfMatch, which is checked just before the file is removed
+func (lc *LocalCloudStorageProxy) DeleteFile(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError("unable to delete file "+fileName, err)
+	}
+	if err := checkNoVersion("local storage", options); err != nil {
+		return err
+	}
+	containerPath, err := lc.existingContainerPath(containerName)
+	if err != nil {
+		return err
+	}
+	filePath, err := lc.filePath(containerName, fileName)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(filePath)
+	if err == nil && info.IsDir() {
+		return wrapError("unable to delete file "+fileName, &fs.PathError{Op: "remove", Path: filePath, Err: fs.ErrNotExist})
+	}
+	if err == nil {
+		if err := checkConditions(fileName, applyFileOptions(options), fileETag(info)); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(filePath); err != nil {
+		return wrapConditionalError("unable to delete file "+fileName, err, applyFileOptions(options))
+	}
+	sidecarPath := lc.sidecarPath(containerName, fileName)
+	if err := os.Remove(sidecarPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return wrapError("unable to delete metadata for file "+fileName, err)
+	}
+	// folders only exist while they contain files, as they do in the cloud
+	removeEmptyParents(filepath.Dir(filePath), containerPath)
+	removeEmptyParents(filepath.Dir(sidecarPath), filepath.Join(lc.rootDir, local_METADATA_DIR, containerName))
+	return nil
+}
+
+func (lc *LocalCloudStorageProxy) DeleteFiles(ctx context.Context, containerName string,
+	fileNames []string) ([]FileResult, error) {
+	if _, err := lc.existingContainerPath(containerName); err != nil {
+		return make([]FileResult, 0), err
+	}
+	// files are deleted one at a time, since deleting a file can remove the directories above it
+	return deleteEach(ctx, fileNames, 1, func(ctx context.Context, fileName string) error {
+		return lc.DeleteFile(ctx, containerName, fileName)
+	}), nil
+}
+
+func (lc *LocalCloudStorageProxy) DeletePrefix(ctx context.Context, containerName string, prefix string,
+	concurrency int) ([]FileResult, error) {
+	return deletePrefix(ctx, lc, containerName, prefix, concurrency)
+}
+
+func removeEmptyParents(dir string, stopAt string) {
+	for dir != stopAt && strings.HasPrefix(dir, stopAt) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func (lc *LocalCloudStorageProxy) GetSourceBlobSignedURL(ctx context.Context, containerName string, fileName string) (string, error) {
+	file, err := lc.openFile(ctx, containerName, fileName)
+	if err != nil {
+		return "", wrapError("could not obtain url for file "+fileName, err)
+	}
+	_ = file.Close()
+	fileURL := url.URL{Scheme: "file", Path: path.Clean(filepath.ToSlash(file.Name()))}
+	if !strings.HasPrefix(fileURL.Path, "/") {
+		// windows drive letters
+		fileURL.Path = "/" + fileURL.Path
+	}
+	return fileURL.String(), nil
+}
+
+func (lc *LocalCloudStorageProxy) CopyFileFromRemoteStorage(ctx context.Context, sourceContainer string, sourceFile string,
+	destContainer string, destFile string, sourceProxy *CloudStorageProxy, concurrency int) error {
+	s := *sourceProxy
+	metadata, err := s.GetMetadata(ctx, sourceContainer, sourceFile)
+	if err != nil {
+		return wrapError("unable to read source file metadata", err)
+	}
+	inputStream, err := s.GetFileContentAsInputStream(ctx, sourceContainer, sourceFile)
+	if err != nil {
+		return wrapError("unable to read source file as stream", err)
+	}
+	defer inputStream.Close()
+	_, err = lc.writeFile(ctx, destContainer, destFile, userMetadata(metadata), inputStream, fileOptions{})
+	return err
+}
+
+func (lc *LocalCloudStorageProxy) CopyFileFromLocalStorage(ctx context.Context, sourceContainer string, sourceFile string,
+	destContainer string, destFile string, concurrency int) error {
+	var s CloudStorageProxy = lc
+	return lc.CopyFileFromRemoteStorage(ctx, sourceContainer, sourceFile, destContainer, destFile, &s, concurrency)
+}
+
+// MoveFile renames the file in place. The metadata is written to the destination before the rename and removed
+// from the source after it, so an interrupted move never leaves the destination without its metadata.
+func (lc *LocalCloudStorageProxy) MoveFile(ctx context.Context, sourceContainer string, sourceFile string,
+	destContainer string, destFile string) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError("unable to move file "+sourceFile, err)
+	}
+	sourceContainerPath, err := lc.existingContainerPath(sourceContainer)
+	if err != nil {
+		return err
+	}
+	if _, err := lc.existingContainerPath(destContainer); err != nil {
+		return err
+	}
+	sourcePath, err := lc.filePath(sourceContainer, sourceFile)
+	if err != nil {
+		return err
+	}
+	destPath, err := lc.filePath(destContainer, destFile)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(sourcePath)
+	if err == nil && info.IsDir() {
+		err = &fs.PathError{Op: "rename", Path: sourcePath, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		return wrapError("unable to move file "+sourceFile, err)
+	}
+	if sourcePath == destPath {
+		return nil
+	}
+	sidecar, err := lc.readSidecar(sourceContainer, sourceFile)
+	if err != nil {
+		return err
+	}
+	if err := lc.writeSidecar(destContainer, destFile, sidecar); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), 0o755); err != nil {
+		return wrapError("unable to create folder for file "+destFile, err)
+	}
+	if err := os.Rename(sourcePath, destPath); err != nil {
+		return wrapError("unable to move file "+sourceFile+" to "+destFile, err)
+	}
+	sourceSidecarPath := lc.sidecarPath(sourceContainer, sourceFile)
+	if err := os.Remove(sourceSidecarPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return wrapError("unable to delete metadata for file "+sourceFile, err)
+	}
+	removeEmptyParents(filepath.Dir(sourcePath), sourceContainerPath)
+	removeEmptyParents(filepath.Dir(sourceSidecarPath), filepath.Join(lc.rootDir, local_METADATA_DIR, sourceContainer))
+	return nil
+}
+
+func (lc *LocalCloudStorageProxy) MovePrefix(ctx context.Context, sourceContainer string, sourcePrefix string,
+	destContainer string, destPrefix string, concurrency int) ([]FileResult, error) {
+	// files are moved one at a time, since moving a file can remove the directories above it
+	return movePrefix(ctx, lc, sourceContainer, sourcePrefix, destContainer, destPrefix, 1)
+}
+
+func (lc *LocalCloudStorageProxy) GetTags(ctx context.Context, containerName string, fileName string) (map[string]string, error) {
+	file, err := lc.openFile(ctx, containerName, fileName)
+	if err != nil {
+		return nil, wrapError("unable to get tags for file "+fileName, err)
+	}
+	_ = file.Close()
+	sidecar, err := lc.readSidecar(containerName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(sidecar.Tags))
+	for key, value := range sidecar.Tags {
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// SetTags replaces the tags kept in the sidecar of a file, leaving the file itself untouched
+func (lc *LocalCloudStorageProxy) SetTags(ctx context.Context, containerName string, fileName string,
+	tags map[string]string) error {
+	file, err := lc.openFile(ctx, containerName, fileName)
+	if err != nil {
+		return wrapError("unable to set tags for file "+fileName, err)
+	}
+	_ = file.Close()
+	sidecar, err := lc.readSidecar(containerName, fileName)
+	if err != nil {
+		return err
+	}
+	sidecar.Tags = tags
+	return lc.writeSidecar(containerName, fileName, sidecar)
+}
+
+func (lc *LocalCloudStorageProxy) FindFilesByTags(ctx context.Context, containerName string, prefix string,
+	tags map[string]string) ([]string, error) {
+	return findFilesByTags(ctx, lc, containerName, prefix, tags)
+}
+
+// A local filesystem keeps a single version of each file
+
+func (lc *LocalCloudStorageProxy) ListFileVersions(ctx context.Context, containerName string,
+	fileName string) ([]FileVersion, error) {
+	return make([]FileVersion, 0), versionsNotSupported("local storage")
+}
+
+func (lc *LocalCloudStorageProxy) RestoreFileVersion(ctx context.Context, containerName string, fileName string,
+	versionID string) error {
+	return versionsNotSupported("local storage")
+}
+
+func (lc *LocalCloudStorageProxy) ListDeletedFiles(ctx context.Context, containerName string,
+	prefix string) ([]DeletedFile, error) {
+	return make([]DeletedFile, 0), undeleteNotSupported("local storage")
+}
+
+func (lc *LocalCloudStorageProxy) UndeleteFile(ctx context.Context, containerName string, fileName string) error {
+	return undeleteNotSupported("local storage")
+}
+
+func (lc *LocalCloudStorageProxy) CreateContainerIfNotExists(ctx context.Context, containerName string) error {
+	containerPath, err := lc.containerPath(containerName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(containerPath, 0o755); err != nil {
+		return wrapError("could not create container "+containerName, err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+const move_CONCURRENCY = 5
+
+// moveFile moves a file for the proxies that have no native rename, by copying it and deleting the source.
+// The copy has to have the size of the source, and its MD5 where the provider reports one. The source is then
+// deleted on condition that it still has the ETag it had before the copy, so a file that is overwritten during the
+// move is left in place. A move whose source is gone fails with ErrNotFound, even when its destination exists, since
+// that file may not be the one that was moved; a move that was interrupted before the delete is copied again.
+func moveFile(ctx context.Context, proxy CloudStorageProxy, sourceContainer string, sourceFile string,
+	destContainer string, destFile string) error {
+	before, err := proxy.GetMetadata(ctx, sourceContainer, sourceFile)
+	if err != nil {
+		return wrapError("unable to move file "+sourceFile, err)
+	}
+	if sourceContainer == destContainer && sourceFile == destFile {
+		return nil
+	}
+	if err := proxy.CopyFileFromLocalStorage(ctx, sourceContainer, sourceFile, destContainer, destFile,
+		move_CONCURRENCY); err != nil {
+		return wrapError("unable to move file "+sourceFile+" to "+destFile, err)
+	}
+	copied, err := proxy.GetMetadata(ctx, destContainer, destFile)
+	if err != nil {
+		return wrapError("unable to verify the copy of file "+sourceFile, err)
+	}
+	if copied["content_length"] != before["content_length"] {
+		return &CloudStorageError{message: "the copy of file " + sourceFile + " to " + destFile + " is incomplete"}
+	}
+	// S3 reports no MD5, and its ETags change with the way a copy is made
+	if before["content_md5"] != "" && copied["content_md5"] != "" && copied["content_md5"] != before["content_md5"] {
+		return &CloudStorageError{message: "the copy of file " + sourceFile + " to " + destFile + " differs from it"}
+	}
+	err = proxy.DeleteFile(ctx, sourceContainer, sourceFile, IfMatch(before["etag"]))
+	if errors.Is(err, ErrPreconditionFailed) {
+		return &CloudStorageError{message: "file " + sourceFile + " changed while it was being moved",
+			internalError: err, kind: ErrPreconditionFailed}
+	}
+	if err != nil {
+		return wrapError("unable to delete file "+sourceFile+" after moving it", err)
+	}
+	return nil
+}
+
+// movePrefix lists every file under a prefix and moves each one with the MoveFile of the proxy, replacing the
+// source prefix of its name with the destination prefix. The error is only set if the listing fails.
+func movePrefix(ctx context.Context, proxy CloudStorageProxy, sourceContainer string, sourcePrefix string,
+	destContainer string, destPrefix string, concurrency int) ([]FileResult, error) {
+	results := make([]FileResult, 0)
+	if err := checkMovePrefixes(sourceContainer, sourcePrefix, destContainer, destPrefix); err != nil {
+		return results, err
+	}
+	for page, err := range Pages(ctx, proxy, sourceContainer, ListOptions{Prefix: sourcePrefix, Recursive: true, PageSize: 1000}) {
+		if err != nil {
+			return results, err
+		}
+		fileNames := make([]string, len(page.Objects))
+		for i, object := range page.Objects {
+			fileNames[i] = object.Name
+		}
+		results = append(results, eachFile(ctx, fileNames, concurrency, func(ctx context.Context, fileName string) error {
+			return proxy.MoveFile(ctx, sourceContainer, fileName, destContainer, destPrefix+fileName[len(sourcePrefix):])
+		})...)
+	}
+	return results, nil
+}
+
+// checkMovePrefixes rejects moves that would list the files they have already moved, or move files onto each other
+func checkMovePrefixes(sourceContainer string, sourcePrefix string, destContainer string, destPrefix string) error {
+	if sourcePrefix == "" {
+		return &CloudStorageError{message: "a prefix is required to move files from container " + sourceContainer}
+	}
+	if sourceContainer == destContainer &&
+		(strings.HasPrefix(sourcePrefix, destPrefix) || strings.HasPrefix(destPrefix, sourcePrefix)) {
+		return &CloudStorageError{message: "cannot move files from " + sourcePrefix + " to " + destPrefix +
+			" within container " + sourceContainer}
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package storage
+
+import "time"
+
+// ObjectInfo describes a file as returned by a listing. ContentType and StorageTier are empty where the
+// provider has no such concept, and Metadata is only populated when it is requested. S3 listings do not include the
+// content type either, so on S3 ContentType is only filled in along with Metadata, and an empty ContentType does not
+// mean that the object has none; GetMetadata returns it under MetadataContentType.
+type ObjectInfo struct {
+	Name         string
+	Size         int64
+	LastModified time.Time
+	ETag         string
+	ContentType  string
+	StorageTier  string
+	Metadata     map[string]string
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"iter"
+)
+
+// ListOptions controls a paginated listing. Unless Recursive is set, "/" is used as a delimiter and the
+// folders directly under the prefix are returned alongside the files. PageToken is the ContinuationToken
+// of a previous page, and an empty PageToken starts from the beginning.
+type ListOptions struct {
+	Prefix          string
+	Recursive       bool
+	PageSize        int
+	PageToken       string
+	IncludeMetadata bool
+}
+
+// ObjectPage is one page of a listing. A page may hold fewer than PageSize entries even when more follow;
+// the listing is only complete when ContinuationToken is empty. The token is opaque, but it is safe to
+// persist it and resume the listing from it later, including from another process.
+type ObjectPage struct {
+	Objects           []ObjectInfo
+	Folders           []string
+	ContinuationToken string
+}
+
+// Pages iterates over the pages of a listing, starting at options.PageToken. Iteration stops after the
+// first error.
+func Pages(ctx context.Context, proxy CloudStorageProxy, containerName string, options ListOptions) iter.Seq2[ObjectPage, error] {
+	return func(yield func(ObjectPage, error) bool) {
+		for {
+			page, err := proxy.ListObjectsPage(ctx, containerName, options)
+			if err != nil {
+				yield(page, err)
+				return
+			}
+			if !yield(page, nil) || page.ContinuationToken == "" {
+				return
+			}
+			options.PageToken = page.ContinuationToken
+		}
+	}
+}
+
+// Objects iterates over every file of a listing, fetching pages as needed. Folders are skipped.
+func Objects(ctx context.Context, proxy CloudStorageProxy, containerName string, options ListOptions) iter.Seq2[ObjectInfo, error] {
+	return func(yield func(ObjectInfo, error) bool) {
+		for page, err := range Pages(ctx, proxy, containerName, options) {
+			if err != nil {
+				yield(ObjectInfo{}, err)
+				return
+			}
+			for _, object := range page.Objects {
+				if !yield(object, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (options ListOptions) delimiter() string {
+	if options.Recursive {
+		return ""
+	}
+	return "/"
+}
+
+func (options ListOptions) pageSize() int {
+	if options.PageSize <= 0 {
+		return max_RESULT
+	}
+	return options.PageSize
+}
+
+// The proxies that list everything at once page by name, so their tokens are the last name of the previous page.
+// Names are encoded only to keep callers from depending on the format.
+func encodePageToken(name string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(name))
+}
+
+func decodePageToken(token string) (string, error) {
+	name, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", wrapError("invalid continuation token "+token, err)
+	}
+	return string(name), nil
+}
+
+// pageListing cuts one page out of a complete listing, where objects are sorted by name and folders are sorted.
+// Starting after a name rather than at an offset keeps a saved token valid when files are added or removed.
+func pageListing(objects []ObjectInfo, folders []string, options ListOptions) (ObjectPage, error) {
+	page := ObjectPage{Objects: make([]ObjectInfo, 0), Folders: make([]string, 0)}
+	after, err := decodePageToken(options.PageToken)
+	if err != nil {
+		return page, err
+	}
+	pageSize := options.pageSize()
+	last := ""
+	for len(objects) > 0 || len(folders) > 0 {
+		var name string
+		isFolder := len(objects) == 0 || (len(folders) > 0 && folders[0] < objects[0].Name)
+		if isFolder {
+			name = folders[0]
+		} else {
+			name = objects[0].Name
+		}
+		if options.PageToken != "" && name <= after {
+			if isFolder {
+				folders = folders[1:]
+			} else {
+				objects = objects[1:]
+			}
+			continue
+		}
+		if len(page.Objects)+len(page.Folders) == pageSize {
+			page.ContinuationToken = encodePageToken(last)
+			break
+		}
+		if isFolder {
+			page.Folders = append(page.Folders, name)
+			folders = folders[1:]
+		} else {
+			page.Objects = append(page.Objects, objects[0])
+			objects = objects[1:]
+		}
+		last = name
+	}
+	return page, nil
+}
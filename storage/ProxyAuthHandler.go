@@ -4,25 +4,32 @@ type ProxyAuthHandler interface {
 	createProxy() (CloudStorageProxy, error)
 }
 
+// Setting HierarchicalNamespace on any of the Azure handlers returns an AzureDataLakeCloudStorageProxy,
+// which adds ADLS Gen2 directory and access control operations for accounts that have it enabled.
+
 type ProxyAuthHandlerAzureDefaultIdentity struct {
-	AccountURL string
+	AccountURL            string
+	HierarchicalNamespace bool
 }
 
 type ProxyAuthHandlerAzureClientSecretIdentity struct {
-	AccountURL   string
-	TenantID     string
-	ClientID     string
-	ClientSecret string
+	AccountURL            string
+	TenantID              string
+	ClientID              string
+	ClientSecret          string
+	HierarchicalNamespace bool
 }
 
 type ProxyAuthHandlerAzureConnectionString struct {
-	ConnectionString string
+	ConnectionString      string
+	HierarchicalNamespace bool
 }
 
 type ProxyAuthHandlerAzureSASToken struct {
-	AccountURL      string
-	AccountKey      string
-	ExpirationHours int
+	AccountURL            string
+	AccountKey            string
+	ExpirationHours       int
+	HierarchicalNamespace bool
 }
 
 type ProxyAuthHandlerAWSDefaultIdentity struct {
@@ -35,3 +42,47 @@ type ProxyAuthHandlerAWSConfiguredIdentity struct {
 	AccessKey  string
 	Region     string
 }
+
+type ProxyAuthHandlerLocalFilesystem struct {
+	RootDir string
+}
+
+type ProxyAuthHandlerInMemory struct {
+	Containers []string
+	// Versioning keeps every version of a file and leaves a delete marker when a file is deleted,
+	// as in an S3 bucket with versioning enabled
+	Versioning bool
+}
+
+type ProxyAuthHandlerGCPDefaultIdentity struct {
+	ProjectID string
+	Endpoint  string
+}
+
+type ProxyAuthHandlerGCPServiceAccountJSON struct {
+	ProjectID       string
+	CredentialsJSON string
+	Endpoint        string
+}
+
+// The SFTP handlers verify the server against HostKey, a public key in authorized_keys format
+// (e.g. "ssh-ed25519 AAAA..."). InsecureIgnoreHostKey skips verification and is meant for testing only.
+
+type ProxyAuthHandlerSFTPPassword struct {
+	Host                  string
+	Port                  int
+	Username              string
+	Password              string
+	HostKey               string
+	InsecureIgnoreHostKey bool
+}
+
+type ProxyAuthHandlerSFTPPrivateKey struct {
+	Host                  string
+	Port                  int
+	Username              string
+	PrivateKey            string
+	Passphrase            string
+	HostKey               string
+	InsecureIgnoreHostKey bool
+}
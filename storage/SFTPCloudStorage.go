@@ -0,0 +1,781 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// uploads are written to a hidden partial file next to their destination and renamed into place when complete,
+// so that the other side of the exchange never picks up a partial file
+const sftp_PARTIAL_SUFFIX = ".partial"
+
+// SFTPCloudStorageProxy treats each container as a base directory on the SFTP server; relative container names
+// are resolved against the login directory. SFTP has nowhere to keep metadata, so uploaded metadata is dropped and
+// GetMetadata only reports the file's size and modification time.
+type SFTPCloudStorageProxy struct {
+	mutex      sync.Mutex
+	address    string
+	username   string
+	config     *ssh.ClientConfig
+	sshClient  *ssh.Client
+	sftpClient *sftp.Client
+}
+
+func (handler ProxyAuthHandlerSFTPPassword) createProxy() (CloudStorageProxy, error) {
+	return createSFTPProxy(handler.Host, handler.Port, handler.Username, handler.HostKey, handler.InsecureIgnoreHostKey,
+		ssh.Password(handler.Password))
+}
+
+func (handler ProxyAuthHandlerSFTPPrivateKey) createProxy() (CloudStorageProxy, error) {
+	var signer ssh.Signer
+	var err error
+	if handler.Passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(handler.PrivateKey), []byte(handler.Passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey([]byte(handler.PrivateKey))
+	}
+	if err != nil {
+		return nil, wrapError("unable to parse SFTP private key", err)
+	}
+	return createSFTPProxy(handler.Host, handler.Port, handler.Username, handler.HostKey, handler.InsecureIgnoreHostKey,
+		ssh.PublicKeys(signer))
+}
+
+func createSFTPProxy(host string, port int, username string, hostKey string, insecureIgnoreHostKey bool,
+	auth ssh.AuthMethod) (CloudStorageProxy, error) {
+	if port == 0 {
+		port = 22
+	}
+	var hostKeyCallback ssh.HostKeyCallback
+	if hostKey != "" {
+		publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+		if err != nil {
+			return nil, wrapError("unable to parse SFTP host key", err)
+		}
+		hostKeyCallback = ssh.FixedHostKey(publicKey)
+	} else if insecureIgnoreHostKey {
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else {
+		return nil, &CloudStorageError{message: "a host key is required to verify the SFTP server"}
+	}
+	proxy := &SFTPCloudStorageProxy{
+		address:  net.JoinHostPort(host, strconv.Itoa(port)),
+		username: username,
+		config: &ssh.ClientConfig{
+			User:            username,
+			Auth:            []ssh.AuthMethod{auth},
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         30 * time.Second,
+		},
+	}
+	// connect up front so that bad credentials are reported by the factory
+	if _, err := proxy.client(); err != nil {
+		return nil, err
+	}
+	return proxy, nil
+}
+
+// client returns the current SFTP session, reconnecting if the previous connection was lost
+func (sp *SFTPCloudStorageProxy) client() (*sftp.Client, error) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	if sp.sftpClient != nil {
+		return sp.sftpClient, nil
+	}
+	sshClient, err := ssh.Dial("tcp", sp.address, sp.config)
+	if err != nil {
+		return nil, wrapError("unable to connect to SFTP server "+sp.address, err)
+	}
+	sftpClient, err := sftp.NewClient(sshClient, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		_ = sshClient.Close()
+		return nil, wrapError("unable to start SFTP session on "+sp.address, err)
+	}
+	sp.sshClient = sshClient
+	sp.sftpClient = sftpClient
+	go func() {
+		_ = sftpClient.Wait()
+		sp.mutex.Lock()
+		if sp.sftpClient == sftpClient {
+			sp.sftpClient = nil
+			sp.sshClient = nil
+		}
+		sp.mutex.Unlock()
+		_ = sshClient.Close()
+	}()
+	return sftpClient, nil
+}
+
+// Close ends the SFTP session. The proxy reconnects if it is used again.
+func (sp *SFTPCloudStorageProxy) Close() error {
+	sp.mutex.Lock()
+	sftpClient, sshClient := sp.sftpClient, sp.sshClient
+	sp.sftpClient, sp.sshClient = nil, nil
+	sp.mutex.Unlock()
+	if sftpClient == nil {
+		return nil
+	}
+	_ = sftpClient.Close()
+	return sshClient.Close()
+}
+
+func (sp *SFTPCloudStorageProxy) containerPath(containerName string) (string, error) {
+	if containerName == "" || path.Clean(containerName) != strings.TrimSuffix(containerName, "/") ||
+		strings.HasPrefix(containerName, "..") {
+		return "", &CloudStorageError{message: "invalid container name " + containerName}
+	}
+	return strings.TrimSuffix(containerName, "/"), nil
+}
+
+func (sp *SFTPCloudStorageProxy) filePath(containerName string, fileName string) (string, error) {
+	containerPath, err := sp.containerPath(containerName)
+	if err != nil {
+		return "", err
+	}
+	if !fs.ValidPath(fileName) || fileName == "." {
+		return "", &CloudStorageError{message: "invalid file name " + fileName}
+	}
+	return path.Join(containerPath, fileName), nil
+}
+
+func isPartialUpload(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, sftp_PARTIAL_SUFFIX)
+}
+
+// listEntries emulates a "/" delimiter the same way the local filesystem proxy does
+func (sp *SFTPCloudStorageProxy) listEntries(ctx context.Context, containerName string,
+	prefix string) ([]localEntry, []string, error) {
+	files := make([]localEntry, 0)
+	folders := make([]string, 0)
+	if err := ctx.Err(); err != nil {
+		return files, folders, wrapError("unable to list contents of container "+containerName, err)
+	}
+	containerPath, err := sp.containerPath(containerName)
+	if err != nil {
+		return files, folders, err
+	}
+	client, err := sp.client()
+	if err != nil {
+		return files, folders, err
+	}
+	if _, err := client.Stat(containerPath); err != nil {
+		return files, folders, wrapError("container "+containerName+" does not exist", err)
+	}
+	dirPrefix := prefix[:strings.LastIndex(prefix, "/")+1]
+	if dirPrefix != "" && !fs.ValidPath(strings.TrimSuffix(dirPrefix, "/")) {
+		return files, folders, nil
+	}
+	entries, err := client.ReadDirContext(ctx, path.Join(containerPath, dirPrefix))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return files, folders, nil
+		}
+		return files, folders, wrapError("unable to list contents of container "+containerName, err)
+	}
+	for _, entry := range entries {
+		name := dirPrefix + entry.Name()
+		if !strings.HasPrefix(name, prefix) || isPartialUpload(entry.Name()) {
+			continue
+		}
+		info := entry
+		if entry.Mode()&fs.ModeSymlink != 0 {
+			info, err = client.Stat(path.Join(containerPath, name))
+			if err != nil {
+				continue
+			}
+		}
+		if info.IsDir() {
+			folders = append(folders, name+"/")
+		} else {
+			files = append(files, localEntry{name: name, info: info})
+		}
+	}
+	sort.Strings(folders)
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, folders, nil
+}
+
+func (sp *SFTPCloudStorageProxy) listFilesOrFolders(ctx context.Context, containerName string, maxNumber int,
+	prefix string, listType blobListType) ([]string, error) {
+	if maxNumber <= 0 {
+		maxNumber = max_RESULT
+	}
+	files, itemList, err := sp.listEntries(ctx, containerName, prefix)
+	if err != nil {
+		return make([]string, 0), err
+	}
+	if listType == listTypeFile {
+		itemList = make([]string, len(files))
+		for i, file := range files {
+			itemList[i] = file.name
+		}
+	}
+	if len(itemList) > maxNumber {
+		itemList = itemList[:maxNumber]
+	}
+	return itemList, nil
+}
+
+func (sp *SFTPCloudStorageProxy) ListFiles(ctx context.Context, containerName string, maxNumber int,
+	prefix string) ([]string, error) {
+	return sp.listFilesOrFolders(ctx, containerName, maxNumber, prefix, listTypeFile)
+}
+
+func (sp *SFTPCloudStorageProxy) ListFolders(ctx context.Context, containerName string, maxNumber int,
+	prefix string) ([]string, error) {
+	return sp.listFilesOrFolders(ctx, containerName, maxNumber, prefix, listTypeFolder)
+}
+
+// ListObjects lists files with the information the server returns in a directory listing.
+// Metadata is not persisted on SFTP servers, so it is always empty when requested.
+func (sp *SFTPCloudStorageProxy) ListObjects(ctx context.Context, containerName string, maxNumber int,
+	prefix string, includeMetadata bool) ([]ObjectInfo, error) {
+	if maxNumber <= 0 {
+		maxNumber = max_RESULT
+	}
+	files, _, err := sp.listEntries(ctx, containerName, prefix)
+	if err != nil {
+		return make([]ObjectInfo, 0), err
+	}
+	objects := make([]ObjectInfo, 0, min(len(files), maxNumber))
+	for _, file := range files[:min(len(files), maxNumber)] {
+		object := fileObjectInfo(file.name, file.info)
+		if includeMetadata {
+			object.Metadata = make(map[string]string)
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+func (sp *SFTPCloudStorageProxy) ListObjectsPage(ctx context.Context, containerName string,
+	options ListOptions) (ObjectPage, error) {
+	var files []localEntry
+	var folders []string
+	var err error
+	if options.Recursive {
+		files, err = sp.walkEntries(ctx, containerName, options.Prefix)
+	} else {
+		files, folders, err = sp.listEntries(ctx, containerName, options.Prefix)
+	}
+	if err != nil {
+		return ObjectPage{Objects: make([]ObjectInfo, 0), Folders: make([]string, 0)}, err
+	}
+	page, err := pageEntries(files, folders, options)
+	if err == nil && options.IncludeMetadata {
+		for i := range page.Objects {
+			page.Objects[i].Metadata = make(map[string]string)
+		}
+	}
+	return page, err
+}
+
+// walkEntries lists every file under a prefix, at all levels, sorted by name
+func (sp *SFTPCloudStorageProxy) walkEntries(ctx context.Context, containerName string, prefix string) ([]localEntry, error) {
+	files := make([]localEntry, 0)
+	containerPath, err := sp.containerPath(containerName)
+	if err != nil {
+		return files, err
+	}
+	client, err := sp.client()
+	if err != nil {
+		return files, err
+	}
+	if _, err := client.Stat(containerPath); err != nil {
+		return files, wrapError("container "+containerName+" does not exist", err)
+	}
+	dirPrefix := prefix[:strings.LastIndex(prefix, "/")+1]
+	if dirPrefix != "" && !fs.ValidPath(strings.TrimSuffix(dirPrefix, "/")) {
+		return files, nil
+	}
+	root := path.Join(containerPath, dirPrefix)
+	walker := client.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if walker.Path() == root && errors.Is(err, fs.ErrNotExist) {
+				return files, nil
+			}
+			return files, wrapError("unable to list contents of container "+containerName, err)
+		}
+		if err := ctx.Err(); err != nil {
+			return files, wrapError("unable to list contents of container "+containerName, err)
+		}
+		if walker.Path() == root {
+			continue
+		}
+		name := strings.TrimPrefix(walker.Path(), containerPath+"/")
+		info := walker.Stat()
+		if info.IsDir() {
+			if !strings.HasPrefix(name+"/", prefix) {
+				walker.SkipDir()
+			}
+			continue
+		}
+		if !strings.HasPrefix(name, prefix) || isPartialUpload(info.Name()) {
+			continue
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			info, err = client.Stat(walker.Path())
+			if err != nil || info.IsDir() {
+				continue
+			}
+		}
+		files = append(files, localEntry{name: name, info: info})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, nil
+}
+
+func (sp *SFTPCloudStorageProxy) openFile(ctx context.Context, containerName string, fileName string) (*sftp.File, fs.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, wrapError("unable to get file "+fileName, err)
+	}
+	filePath, err := sp.filePath(containerName, fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := sp.client()
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := client.Open(filePath)
+	if err != nil {
+		return nil, nil, wrapError("unable to get file "+fileName, err)
+	}
+	info, err := file.Stat()
+	if err == nil && info.IsDir() {
+		err = &fs.PathError{Op: "open", Path: filePath, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, wrapError("unable to get file "+fileName, err)
+	}
+	return file, info, nil
+}
+
+func sftpMetadata(info fs.FileInfo) map[string]string {
+	return map[string]string{
+		"last_modified":  info.ModTime().UTC().Format(time_FORMAT),
+		"content_length": strconv.FormatInt(info.Size(), 10),
+		"etag":           fileETag(info),
+	}
+}
+
+func (sp *SFTPCloudStorageProxy) GetFile(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) (CloudFile, error) {
+	cloudFile := CloudFile{
+		Container: containerName,
+		FileName:  fileName,
+	}
+	if err := checkNoVersion("SFTP", options); err != nil {
+		return cloudFile, err
+	}
+	file, info, err := sp.openFile(ctx, containerName, fileName)
+	if err != nil {
+		return cloudFile, err
+	}
+	defer file.Close()
+	cloudFile.Metadata = sftpMetadata(info)
+	var content bytes.Buffer
+	if _, err := file.WriteTo(&content); err != nil {
+		return cloudFile, wrapError("unable to read content of file "+fileName, err)
+	}
+	cloudFile.Content = content.String()
+	return cloudFile, nil
+}
+
+func (sp *SFTPCloudStorageProxy) GetFileContentAsString(ctx context.Context, containerName string, fileName string) (string, error) {
+	cloudFile, err := sp.GetFile(ctx, containerName, fileName)
+	return cloudFile.Content, err
+}
+
+func (sp *SFTPCloudStorageProxy) GetFileContentAsInputStream(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) (io.ReadCloser, error) {
+	if err := checkNoVersion("SFTP", options); err != nil {
+		return nil, err
+	}
+	file, _, err := sp.openFile(ctx, containerName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// GetFileRange accepts IfMatch
+func (sp *SFTPCloudStorageProxy) GetFileRange(ctx context.Context, containerName string, fileName string,
+	offset int64, length int64, options ...FileOption) (io.ReadCloser, error) {
+	if err := checkNoVersion("SFTP", options); err != nil {
+		return nil, err
+	}
+	if err := checkRange(fileName, offset, length); err != nil {
+		return nil, err
+	}
+	file, info, err := sp.openFile(ctx, containerName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkConditions(fileName, applyFileOptions(options), fileETag(info)); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return newFileRange(file, fileName, offset, length, info.Size())
+}
+
+func (sp *SFTPCloudStorageProxy) OpenReader(ctx context.Context, containerName string, fileName string) (*FileReader, error) {
+	return openReader(ctx, sp, containerName, fileName)
+}
+
+func (sp *SFTPCloudStorageProxy) GetLargeFileContentAsByteArray(ctx context.Context, containerName string, fileName string,
+	fileSize int64, concurrency int) ([]byte, error) {
+	file, info, err := sp.openFile(ctx, containerName, fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	// the SFTP client already keeps several read requests in flight for a single ReadAt
+	buffer := make([]byte, info.Size())
+	n, err := file.ReadAt(buffer, 0)
+	if err != nil && !(errors.Is(err, io.EOF) && n == len(buffer)) {
+		return nil, wrapError("unable to read content of file "+fileName, err)
+	}
+	return buffer, nil
+}
+
+func (sp *SFTPCloudStorageProxy) GetMetadata(ctx context.Context, containerName string, fileName string) (map[string]string, error) {
+	file, info, err := sp.openFile(ctx, containerName, fileName)
+	if err != nil {
+		return nil, wrapError("unable to get metadata for file "+fileName, err)
+	}
+	_ = file.Close()
+	return sftpMetadata(info), nil
+}
+
+func (sp *SFTPCloudStorageProxy) Exists(ctx context.Context, containerName string, fileName string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, wrapError("unable to check whether file "+fileName+" exists", err)
+	}
+	filePath, err := sp.filePath(containerName, fileName)
+	if err != nil {
+		return false, err
+	}
+	client, err := sp.client()
+	if err != nil {
+		return false, err
+	}
+	info, err := client.Stat(filePath)
+	if err == nil && info.IsDir() {
+		return false, nil
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		containerPath, _ := sp.containerPath(containerName)
+		if _, containerErr := client.Stat(containerPath); errors.Is(containerErr, fs.ErrNotExist) {
+			return false, wrapError("container "+containerName+" does not exist", errContainerNotFound)
+		}
+	}
+	return existsResult(fileName, err)
+}
+
+func (sp *SFTPCloudStorageProxy) writeFile(ctx context.Context, containerName string, fileName string,
+	content io.Reader, concurrency int, options fileOptions) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", wrapError("unable to upload file "+fileName, err)
+	}
+	filePath, err := sp.filePath(containerName, fileName)
+	if err != nil {
+		return "", err
+	}
+	client, err := sp.client()
+	if err != nil {
+		return "", err
+	}
+	containerPath, _ := sp.containerPath(containerName)
+	if _, err := client.Stat(containerPath); err != nil {
+		return "", wrapError("container "+containerName+" does not exist", err)
+	}
+	if err := client.MkdirAll(path.Dir(filePath)); err != nil {
+		return "", wrapError("unable to create folder for file "+fileName, err)
+	}
+	partialPath := path.Join(path.Dir(filePath), "."+path.Base(filePath)+"."+uuid.NewString()+sftp_PARTIAL_SUFFIX)
+	file, err := client.Create(partialPath)
+	if err != nil {
+		return "", wrapError("unable to upload file "+fileName, err)
+	}
+	if concurrency <= 0 {
+		concurrency = 5
+	}
+	_, err = file.ReadFromWithConcurrency(content, concurrency)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// a stream may end because its context was cancelled, and its content is then not placed
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = sp.placeFile(client, partialPath, filePath, fileName, options)
+	}
+	if err != nil {
+		_ = client.Remove(partialPath)
+		return "", wrapConditionalError("unable to upload file "+fileName, err, options)
+	}
+	info, err := client.Stat(filePath)
+	if err != nil {
+		return "", wrapError("unable to upload file "+fileName, err)
+	}
+	return fileETag(info), nil
+}
+
+// placeFile moves an uploaded file into place. A create-only upload uses a plain SFTP rename, which refuses to
+// replace a file, while IfMatch is checked just before the rename and so is not atomic.
+func (sp *SFTPCloudStorageProxy) placeFile(client *sftp.Client, partialPath string, filePath string, fileName string,
+	options fileOptions) error {
+	if options.ifMatch == "" && options.ifNoneMatch == "*" {
+		if err := client.Rename(partialPath, filePath); err != nil {
+			if _, statErr := client.Stat(filePath); statErr == nil {
+				return &CloudStorageError{message: "file " + fileName + " already exists", internalError: err,
+					kind: ErrPreconditionFailed}
+			}
+			return err
+		}
+		return nil
+	}
+	if options.hasConditions() {
+		etag := ""
+		if info, err := client.Stat(filePath); err == nil && !info.IsDir() {
+			etag = fileETag(info)
+		}
+		if err := checkConditions(fileName, options, etag); err != nil {
+			return err
+		}
+	}
+	return sp.replace(client, partialPath, filePath)
+}
+
+// replace renames over an existing file, which plain SFTP renames refuse to do
+func (sp *SFTPCloudStorageProxy) replace(client *sftp.Client, oldPath string, newPath string) error {
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		return client.PosixRename(oldPath, newPath)
+	}
+	if err := client.Remove(newPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return client.Rename(oldPath, newPath)
+}
+
+// UploadFileFromString returns the ETag of the new file, and accepts IfMatch and IfNoneMatch
+func (sp *SFTPCloudStorageProxy) UploadFileFromString(ctx context.Context, containerName string, fileName string,
+	metadata map[string]string, content string, options ...FileOption) (string, error) {
+	return sp.writeFile(ctx, containerName, fileName, strings.NewReader(content), 1, applyFileOptions(options))
+}
+
+// UploadFileFromInputStream returns the ETag of the new file, and accepts IfMatch and IfNoneMatch
+func (sp *SFTPCloudStorageProxy) UploadFileFromInputStream(ctx context.Context, containerName string, fileName string,
+	metadata map[string]string, inputStream io.Reader, fileSizeBytes int64, concurrency int,
+	options ...FileOption) (string, error) {
+	return sp.writeFile(ctx, containerName, fileName, inputStream, concurrency, applyFileOptions(options))
+}
+
+func (sp *SFTPCloudStorageProxy) OpenWriter(ctx context.Context, containerName string, fileName string,
+	options WriterOptions) (*FileWriter, error) {
+	return newFileWriter(ctx, fileName, newPipeUploader(ctx, sp, containerName, fileName, options),
+		options.partSize(), 1, partLimits{}), nil
+}
+
+// DeleteFile accepts IfMatch, which is checked just before the file is removed
+func (sp *SFTPCloudStorageProxy) DeleteFile(ctx context.Context, containerName string, fileName string,
+	options ...FileOption) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError("unable to delete file "+fileName, err)
+	}
+	if err := checkNoVersion("SFTP", options); err != nil {
+		return err
+	}
+	applied := applyFileOptions(options)
+	file, info, err := sp.openFile(ctx, containerName, fileName)
+	if err != nil {
+		return wrapConditionalError("unable to delete file "+fileName, err, applied)
+	}
+	_ = file.Close()
+	if err := checkConditions(fileName, applied, fileETag(info)); err != nil {
+		return err
+	}
+	client, err := sp.client()
+	if err != nil {
+		return err
+	}
+	// unlike the local filesystem proxy, empty folders are left in place since the directory
+	// layout on an SFTP server usually belongs to the other side of the exchange
+	if err := client.Remove(file.Name()); err != nil {
+		return wrapError("unable to delete file "+fileName, err)
+	}
+	return nil
+}
+
+func (sp *SFTPCloudStorageProxy) DeleteFiles(ctx context.Context, containerName string,
+	fileNames []string) ([]FileResult, error) {
+	containerPath, err := sp.containerPath(containerName)
+	if err != nil {
+		return make([]FileResult, 0), err
+	}
+	client, err := sp.client()
+	if err != nil {
+		return make([]FileResult, 0), err
+	}
+	if _, err := client.Stat(containerPath); err != nil {
+		return make([]FileResult, 0), wrapError("container "+containerName+" does not exist", err)
+	}
+	return deleteEach(ctx, fileNames, 1, func(ctx context.Context, fileName string) error {
+		return sp.DeleteFile(ctx, containerName, fileName)
+	}), nil
+}
+
+func (sp *SFTPCloudStorageProxy) DeletePrefix(ctx context.Context, containerName string, prefix string,
+	concurrency int) ([]FileResult, error) {
+	return deletePrefix(ctx, sp, containerName, prefix, concurrency)
+}
+
+// GetSourceBlobSignedURL returns an sftp:// URL for the file. It carries no credentials, so the cloud proxies
+// copy SFTP files by streaming them rather than by handing the URL to the cloud provider.
+func (sp *SFTPCloudStorageProxy) GetSourceBlobSignedURL(ctx context.Context, containerName string, fileName string) (string, error) {
+	file, _, err := sp.openFile(ctx, containerName, fileName)
+	if err != nil {
+		return "", wrapError("could not obtain url for file "+fileName, err)
+	}
+	_ = file.Close()
+	fileURL := url.URL{Scheme: "sftp", User: url.User(sp.username), Host: sp.address, Path: file.Name()}
+	if !strings.HasPrefix(fileURL.Path, "/") {
+		// relative to the login directory
+		fileURL.Path = "/~/" + fileURL.Path
+	}
+	return fileURL.String(), nil
+}
+
+func (sp *SFTPCloudStorageProxy) CopyFileFromRemoteStorage(ctx context.Context, sourceContainer string, sourceFile string,
+	destContainer string, destFile string, sourceProxy *CloudStorageProxy, concurrency int) error {
+	s := *sourceProxy
+	inputStream, err := s.GetFileContentAsInputStream(ctx, sourceContainer, sourceFile)
+	if err != nil {
+		return wrapError("unable to read source file as stream", err)
+	}
+	defer inputStream.Close()
+	_, err = sp.writeFile(ctx, destContainer, destFile, inputStream, concurrency, fileOptions{})
+	return err
+}
+
+func (sp *SFTPCloudStorageProxy) CopyFileFromLocalStorage(ctx context.Context, sourceContainer string, sourceFile string,
+	destContainer string, destFile string, concurrency int) error {
+	var s CloudStorageProxy = sp
+	return sp.CopyFileFromRemoteStorage(ctx, sourceContainer, sourceFile, destContainer, destFile, &s, concurrency)
+}
+
+// MoveFile renames the file on the server, replacing any file already at the destination
+func (sp *SFTPCloudStorageProxy) MoveFile(ctx context.Context, sourceContainer string, sourceFile string,
+	destContainer string, destFile string) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError("unable to move file "+sourceFile, err)
+	}
+	sourcePath, err := sp.filePath(sourceContainer, sourceFile)
+	if err != nil {
+		return err
+	}
+	destPath, err := sp.filePath(destContainer, destFile)
+	if err != nil {
+		return err
+	}
+	client, err := sp.client()
+	if err != nil {
+		return err
+	}
+	destContainerPath, _ := sp.containerPath(destContainer)
+	if _, err := client.Stat(destContainerPath); err != nil {
+		return wrapError("container "+destContainer+" does not exist", err)
+	}
+	info, err := client.Stat(sourcePath)
+	if err == nil && info.IsDir() {
+		err = &fs.PathError{Op: "rename", Path: sourcePath, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		return wrapError("unable to move file "+sourceFile, err)
+	}
+	if sourcePath == destPath {
+		return nil
+	}
+	if err := client.MkdirAll(path.Dir(destPath)); err != nil {
+		return wrapError("unable to create folder for file "+destFile, err)
+	}
+	if err := sp.replace(client, sourcePath, destPath); err != nil {
+		return wrapError("unable to move file "+sourceFile+" to "+destFile, err)
+	}
+	return nil
+}
+
+func (sp *SFTPCloudStorageProxy) MovePrefix(ctx context.Context, sourceContainer string, sourcePrefix string,
+	destContainer string, destPrefix string, concurrency int) ([]FileResult, error) {
+	return movePrefix(ctx, sp, sourceContainer, sourcePrefix, destContainer, destPrefix, concurrency)
+}
+
+// SFTP servers have nowhere to keep tags, as with metadata
+
+func (sp *SFTPCloudStorageProxy) GetTags(ctx context.Context, containerName string, fileName string) (map[string]string, error) {
+	return nil, &CloudStorageError{message: "SFTP does not support file tags", kind: ErrNotSupported}
+}
+
+func (sp *SFTPCloudStorageProxy) SetTags(ctx context.Context, containerName string, fileName string,
+	tags map[string]string) error {
+	return &CloudStorageError{message: "SFTP does not support file tags", kind: ErrNotSupported}
+}
+
+func (sp *SFTPCloudStorageProxy) FindFilesByTags(ctx context.Context, containerName string, prefix string,
+	tags map[string]string) ([]string, error) {
+	return make([]string, 0), &CloudStorageError{message: "SFTP does not support file tags", kind: ErrNotSupported}
+}
+
+// SFTP servers keep a single version of each file
+
+func (sp *SFTPCloudStorageProxy) ListFileVersions(ctx context.Context, containerName string,
+	fileName string) ([]FileVersion, error) {
+	return make([]FileVersion, 0), versionsNotSupported("SFTP")
+}
+
+func (sp *SFTPCloudStorageProxy) RestoreFileVersion(ctx context.Context, containerName string, fileName string,
+	versionID string) error {
+	return versionsNotSupported("SFTP")
+}
+
+func (sp *SFTPCloudStorageProxy) ListDeletedFiles(ctx context.Context, containerName string,
+	prefix string) ([]DeletedFile, error) {
+	return make([]DeletedFile, 0), undeleteNotSupported("SFTP")
+}
+
+func (sp *SFTPCloudStorageProxy) UndeleteFile(ctx context.Context, containerName string, fileName string) error {
+	return undeleteNotSupported("SFTP")
+}
+
+func (sp *SFTPCloudStorageProxy) CreateContainerIfNotExists(ctx context.Context, containerName string) error {
+	containerPath, err := sp.containerPath(containerName)
+	if err != nil {
+		return err
+	}
+	client, err := sp.client()
+	if err != nil {
+		return err
+	}
+	if err := client.MkdirAll(containerPath); err != nil {
+		return wrapError("could not create container "+containerName, err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+const tags_CONCURRENCY = 10
+
+// checkTagQuery rejects a query without tags, which would match every file
+func checkTagQuery(containerName string, tags map[string]string) error {
+	if len(tags) == 0 {
+		return &CloudStorageError{message: "at least one tag is required to find files in container " + containerName}
+	}
+	return nil
+}
+
+// tagsMatch reports whether a file has every tag of a query, with the same value
+func tagsMatch(fileTags map[string]string, query map[string]string) bool {
+	for key, value := range query {
+		if fileValue, ok := fileTags[key]; !ok || fileValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// findFilesByTags is used by the proxies that cannot query tags on the server. It lists every file under a prefix
+// and reads the tags of each one with the GetTags of the proxy. The file names are returned in name order.
+func findFilesByTags(ctx context.Context, proxy CloudStorageProxy, containerName string, prefix string,
+	tags map[string]string) ([]string, error) {
+	matches := make([]string, 0)
+	if err := checkTagQuery(containerName, tags); err != nil {
+		return matches, err
+	}
+	for page, err := range Pages(ctx, proxy, containerName, ListOptions{Prefix: prefix, Recursive: true, PageSize: 1000}) {
+		if err != nil {
+			return matches, err
+		}
+		fileNames := make([]string, len(page.Objects))
+		for i, object := range page.Objects {
+			fileNames[i] = object.Name
+		}
+		mutex := sync.Mutex{}
+		matched := make(map[string]bool)
+		results := eachFile(ctx, fileNames, tags_CONCURRENCY, func(ctx context.Context, fileName string) error {
+			fileTags, err := proxy.GetTags(ctx, containerName, fileName)
+			if err != nil {
+				return err
+			}
+			mutex.Lock()
+			matched[fileName] = tagsMatch(fileTags, tags)
+			mutex.Unlock()
+			return nil
+		})
+		for _, result := range results {
+			// a file deleted since it was listed no longer matches
+			if result.Err != nil && !errors.Is(result.Err, ErrNotFound) {
+				return matches, result.Err
+			}
+			if matched[result.Name] {
+				matches = append(matches, result.Name)
+			}
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DeletedFile is a file that has been deleted but can still be recovered with UndeleteFile. The ObjectInfo
+// describes the content that UndeleteFile brings back.
+type DeletedFile struct {
+	ObjectInfo
+	DeletedTime time.Time
+}
+
+// recoveryNotEnabled is returned by the proxies that can recover deleted files, for a container without the
+// feature that keeps them
+func recoveryNotEnabled(containerName string, feature string) *CloudStorageError {
+	return &CloudStorageError{
+		message: "deleted files cannot be recovered from container " + containerName + " because " + feature + " is not enabled",
+		kind:    ErrNotSupported,
+	}
+}
+
+func undeleteNotSupported(provider string) *CloudStorageError {
+	return &CloudStorageError{message: provider + " does not support recovering deleted files", kind: ErrNotSupported}
+}
+
+func sortDeletedFiles(files []DeletedFile) {
+	slices.SortFunc(files, func(a, b DeletedFile) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+}
+
+// removeDeleteMarkers undeletes a file in a versioned container by deleting the delete markers that hide its
+// newest version, as S3 recommends. A file that is not deleted is left as it is.
+func removeDeleteMarkers(ctx context.Context, proxy CloudStorageProxy, containerName string, fileName string) error {
+	versions, err := proxy.ListFileVersions(ctx, containerName, fileName)
+	if err != nil {
+		return wrapError("unable to undelete file "+fileName, err)
+	}
+	if !slices.ContainsFunc(versions, func(version FileVersion) bool { return !version.IsDeleteMarker }) {
+		return &CloudStorageError{message: "file " + fileName + " has no version to recover", kind: ErrNotFound}
+	}
+	// a file deleted more than once has a delete marker for each time, but not more than were listed first
+	markers := 0
+	for _, version := range versions {
+		if version.IsDeleteMarker {
+			markers++
+		}
+	}
+	removed := ""
+	for pass := 0; ; pass++ {
+		current := slices.IndexFunc(versions, func(version FileVersion) bool { return version.IsCurrent })
+		if current < 0 || !versions[current].IsDeleteMarker {
+			return nil
+		}
+		// a marker that is still current once deleted, or more markers than there were, would never end
+		if pass == markers || versions[current].VersionID == removed {
+			return &CloudStorageError{message: "unable to undelete file " + fileName + ": its delete marker " +
+				versions[current].VersionID + " is still current"}
+		}
+		if err := ctx.Err(); err != nil {
+			return wrapError("unable to undelete file "+fileName, err)
+		}
+		removed = versions[current].VersionID
+		err := proxy.DeleteFile(ctx, containerName, fileName, WithVersion(removed))
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return wrapError("unable to undelete file "+fileName, err)
+		}
+		if versions, err = proxy.ListFileVersions(ctx, containerName, fileName); err != nil {
+			return wrapError("unable to undelete file "+fileName, err)
+		}
+	}
+}
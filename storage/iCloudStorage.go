@@ -11,28 +11,50 @@ import (
 const max_RESULT int = 500
 const time_FORMAT string = time.RFC3339Nano
 const size_5MiB = 5 * 1024 * 1024
+const size_5GiB = 5 * 1024 * 1024 * 1024
+const size_5TiB = 5 * 1024 * 1024 * 1024 * 1024
 const max_PARTS = 10000
 const size_LARGEOBJECT = 50 * 1024 * 1024
 
 type CloudStorageProxy interface {
 	ListFiles(ctx context.Context, containerName string, maxNumber int, prefix string) ([]string, error)
 	ListFolders(ctx context.Context, containerName string, maxNumber int, prefix string) ([]string, error)
-	GetFile(ctx context.Context, containerName string, fileName string) (CloudFile, error)
+	ListObjects(ctx context.Context, containerName string, maxNumber int, prefix string, includeMetadata bool) ([]ObjectInfo, error)
+	ListObjectsPage(ctx context.Context, containerName string, options ListOptions) (ObjectPage, error)
+	GetFile(ctx context.Context, containerName string, fileName string, options ...FileOption) (CloudFile, error)
 	GetFileContentAsString(ctx context.Context, containerName string, fileName string) (string, error)
-	GetFileContentAsInputStream(ctx context.Context, containerName string, fileName string) (io.ReadCloser, error)
+	GetFileContentAsInputStream(ctx context.Context, containerName string, fileName string,
+		options ...FileOption) (io.ReadCloser, error)
+	GetFileRange(ctx context.Context, containerName string, fileName string, offset int64, length int64,
+		options ...FileOption) (io.ReadCloser, error)
+	OpenReader(ctx context.Context, containerName string, fileName string) (*FileReader, error)
 	GetLargeFileContentAsByteArray(ctx context.Context, containerName string, fileName string, fileSize int64, concurrency int) ([]byte, error)
 	GetMetadata(ctx context.Context, containerName string, fileName string) (map[string]string, error)
 	UploadFileFromString(ctx context.Context, containerName string, fileName string, metadata map[string]string,
-		content string) error
+		content string, options ...FileOption) (string, error)
 	UploadFileFromInputStream(ctx context.Context, containerName string, fileName string, metadata map[string]string,
-		inputStream io.Reader, fileSizeBytes int64, concurrency int) error
-	DeleteFile(ctx context.Context, containerName string, fileName string) error
+		inputStream io.Reader, fileSizeBytes int64, concurrency int, options ...FileOption) (string, error)
+	OpenWriter(ctx context.Context, containerName string, fileName string, options WriterOptions) (*FileWriter, error)
+	DeleteFile(ctx context.Context, containerName string, fileName string, options ...FileOption) error
+	DeleteFiles(ctx context.Context, containerName string, fileNames []string) ([]FileResult, error)
+	DeletePrefix(ctx context.Context, containerName string, prefix string, concurrency int) ([]FileResult, error)
 	GetSourceBlobSignedURL(ctx context.Context, containerName string, fileName string) (string, error)
 	CopyFileFromRemoteStorage(ctx context.Context, sourceContainer string, sourceFile string,
 		destContainer string, destFile string, sourceProxy *CloudStorageProxy, concurrency int) error
 	CopyFileFromLocalStorage(ctx context.Context, sourceContainer string, sourceFile string,
 		destContainer string, destFile string, concurrency int) error
+	MoveFile(ctx context.Context, sourceContainer string, sourceFile string, destContainer string, destFile string) error
+	MovePrefix(ctx context.Context, sourceContainer string, sourcePrefix string, destContainer string, destPrefix string,
+		concurrency int) ([]FileResult, error)
+	GetTags(ctx context.Context, containerName string, fileName string) (map[string]string, error)
+	SetTags(ctx context.Context, containerName string, fileName string, tags map[string]string) error
+	FindFilesByTags(ctx context.Context, containerName string, prefix string, tags map[string]string) ([]string, error)
+	ListFileVersions(ctx context.Context, containerName string, fileName string) ([]FileVersion, error)
+	RestoreFileVersion(ctx context.Context, containerName string, fileName string, versionID string) error
+	ListDeletedFiles(ctx context.Context, containerName string, prefix string) ([]DeletedFile, error)
+	UndeleteFile(ctx context.Context, containerName string, fileName string) error
 	CreateContainerIfNotExists(ctx context.Context, containerName string) error
+	Exists(ctx context.Context, containerName string, fileName string) (bool, error)
 }
 
 type blobListType string
@@ -45,6 +67,8 @@ const (
 type CloudStorageError struct {
 	message       string
 	internalError error
+	// kind is one of the exported errors, or nil when the error could not be classified
+	kind error
 }
 
 func (err *CloudStorageError) Error() string {
@@ -55,14 +79,32 @@ func (err *CloudStorageError) Unwrap() error {
 	return err.internalError
 }
 
+// Is lets errors.Is match a classified error against the exported errors, such as ErrNotFound
+func (err *CloudStorageError) Is(target error) bool {
+	return err.kind != nil && err.kind == target
+}
+
 func wrapError(msg string, err error) *CloudStorageError {
-	return &CloudStorageError{message: msg, internalError: err}
+	return &CloudStorageError{message: msg, internalError: err, kind: classifyError(err)}
 }
 
 func CloudStorageProxyFactory(handler ProxyAuthHandler) (CloudStorageProxy, error) {
 	return handler.createProxy()
 }
 
+// userMetadata strips the keys that GetMetadata adds to describe the file itself,
+// leaving only the metadata that was set by the uploader
+func userMetadata(metadata map[string]string) map[string]string {
+	props := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		if key != "last_modified" && key != "content_length" && key != "etag" && key != "version_id" &&
+			key != "content_md5" {
+			props[key] = value
+		}
+	}
+	return props
+}
+
 func getStringAsInt64(number string) int64 {
 	length, _ := strconv.ParseInt(number, 10, 64)
 	return length
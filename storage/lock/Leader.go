@@ -0,0 +1,84 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RunAsLeader waits until the lock is acquired, retrying every third of its TTL while another owner holds it, then
+// runs the callback while renewing the lock at the same interval, and releases the lock when the callback returns.
+// The context passed to the callback is cancelled when leadership is lost, because another owner took the lock or
+// it could not be renewed before it expired, and the callback should stop then.
+//
+// The error is the one returned by the callback, or one matching ErrLost if leadership was lost, or the error of
+// Acquire if it failed for a reason other than ErrHeld. RunAsLeader returns ctx.Err() if ctx is done before the lock
+// is acquired.
+func RunAsLeader(ctx context.Context, lock *Lock, callback func(ctx context.Context) error) error {
+	interval := lock.ttl / 3
+	for {
+		err := lock.Acquire(ctx)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrHeld) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var lost error
+	renewing := make(chan struct{})
+	go func() {
+		defer close(renewing)
+		lost = lock.keepRenewed(leaderCtx, interval)
+		cancel()
+	}()
+	err := callback(leaderCtx)
+	cancel()
+	<-renewing
+
+	// released even when ctx is done, so that the next leader does not have to wait for the lock to expire
+	released := lock.Release(context.WithoutCancel(ctx))
+	switch {
+	case err != nil:
+		return err
+	case lost != nil:
+		return lost
+	}
+	return released
+}
+
+// keepRenewed renews the lock every interval until ctx is done. It returns an error matching ErrLost once the lock
+// has been taken by another owner, or could not be renewed before it expired.
+func (lock *Lock) keepRenewed(ctx context.Context, interval time.Duration) error {
+	renewed := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		err := lock.Renew(ctx)
+		switch {
+		case err == nil:
+			renewed = time.Now()
+		case errors.Is(err, ErrLost):
+			return err
+		case ctx.Err() != nil:
+			return nil
+		case time.Since(renewed)+interval >= lock.ttl:
+			// the next attempt would be too late
+			return fmt.Errorf("lock %s could not be renewed before it expired: %w: %w", lock.name, ErrLost, err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package lock provides named locks held in a file of a container, so that processes sharing a storage account can
+// coordinate their work, and leader election on top of them.
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"lib-cloud-proxy-go/storage"
+	"sync"
+	"time"
+)
+
+const default_TTL = 30 * time.Second
+
+var (
+	// ErrHeld is returned by Acquire while another owner holds the lock
+	ErrHeld = errors.New("lock is held by another owner")
+	// ErrLost is returned by Renew and Release when the lock is no longer held, because it expired and another
+	// owner took it
+	ErrLost = errors.New("lock was lost")
+)
+
+// Options configure a Lock. TTL is how long the lock is held without being renewed, 30 seconds by default, and must
+// be between 15 and 60 seconds on Azure. Owner is recorded in the lock file to show who holds the lock, except on
+// Azure, and is a random ID by default.
+type Options struct {
+	TTL   time.Duration
+	Owner string
+}
+
+// Lock is a named lock held in a file of a container. When the proxy implements storage.LeaseProxy, as the Azure
+// proxies do, the lock is a lease on that blob. Otherwise the file records the owner and the time the lock expires,
+// and is written with IfNoneMatch and IfMatch so that only one owner at a time can take it; an expired lock is taken
+// over by the next owner that tries. The expiry time is compared with the local clock, so the clocks of the owners
+// must agree to within a small part of the TTL.
+//
+// A Lock is safe for concurrent use, but holds the lock for a single owner.
+type Lock struct {
+	proxy         storage.CloudStorageProxy
+	containerName string
+	name          string
+	ttl           time.Duration
+	owner         string
+	mutex         sync.Mutex
+	// token is the lease ID, or the ETag of the lock file that was last written, while the lock is held
+	token string
+}
+
+type lockFile struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+// New returns the lock held in file name of a container. The lock is not acquired.
+func New(proxy storage.CloudStorageProxy, containerName string, name string, options Options) *Lock {
+	if options.TTL <= 0 {
+		options.TTL = default_TTL
+	}
+	if options.Owner == "" {
+		options.Owner = uuid.NewString()
+	}
+	return &Lock{proxy: proxy, containerName: containerName, name: name, ttl: options.TTL, owner: options.Owner}
+}
+
+// Acquire takes the lock when it is free or has expired, and returns an error matching ErrHeld otherwise. It does not
+// wait for the lock. Acquiring a lock that is already held renews it.
+func (lock *Lock) Acquire(ctx context.Context) error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	if lock.token != "" {
+		return lock.renew(ctx)
+	}
+	if leases, ok := lock.proxy.(storage.LeaseProxy); ok {
+		leaseID, err := leases.AcquireLease(ctx, lock.containerName, lock.name, lock.ttl)
+		if err != nil {
+			return lock.held(err)
+		}
+		lock.token = leaseID
+		return nil
+	}
+	etag, err := lock.write(ctx, storage.IfNoneMatch("*"))
+	if errors.Is(err, storage.ErrPreconditionFailed) {
+		etag, err = lock.takeExpired(ctx)
+	}
+	if err != nil {
+		return lock.held(err)
+	}
+	lock.token = etag
+	return nil
+}
+
+// takeExpired takes over a lock file that its owner did not renew in time
+func (lock *Lock) takeExpired(ctx context.Context) (string, error) {
+	file, err := lock.proxy.GetFile(ctx, lock.containerName, lock.name)
+	if errors.Is(err, storage.ErrNotFound) {
+		// released since the lock file was found
+		return lock.write(ctx, storage.IfNoneMatch("*"))
+	}
+	if err != nil {
+		return "", err
+	}
+	var holder lockFile
+	if err := json.Unmarshal([]byte(file.Content), &holder); err != nil {
+		return "", fmt.Errorf("invalid lock file %s: %w", lock.name, err)
+	}
+	if holder.Owner != lock.owner && time.Now().Before(holder.Expires) {
+		return "", fmt.Errorf("lock %s is held by %s until %s: %w", lock.name, holder.Owner,
+			holder.Expires.Format(time.RFC3339), ErrHeld)
+	}
+	return lock.write(ctx, storage.IfMatch(file.Metadata["etag"]))
+}
+
+// write saves the lock file with a new expiry time, and returns its ETag
+func (lock *Lock) write(ctx context.Context, condition storage.FileOption) (string, error) {
+	content, err := json.Marshal(lockFile{Owner: lock.owner, Expires: time.Now().Add(lock.ttl).UTC()})
+	if err != nil {
+		return "", err
+	}
+	return lock.proxy.UploadFileFromString(ctx, lock.containerName, lock.name,
+		map[string]string{storage.MetadataContentType: "application/json"}, string(content), condition)
+}
+
+// held reports a failed precondition on Acquire as ErrHeld
+func (lock *Lock) held(err error) error {
+	if errors.Is(err, storage.ErrPreconditionFailed) {
+		return fmt.Errorf("lock %s is held by another owner: %w: %w", lock.name, ErrHeld, err)
+	}
+	return err
+}
+
+// Renew extends a held lock by its TTL. When the lock is not held, or has been taken by another owner, the error
+// matches ErrLost and the lock has to be acquired again.
+func (lock *Lock) Renew(ctx context.Context) error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	return lock.renew(ctx)
+}
+
+func (lock *Lock) renew(ctx context.Context) error {
+	if lock.token == "" {
+		return fmt.Errorf("lock %s is not held: %w", lock.name, ErrLost)
+	}
+	if leases, ok := lock.proxy.(storage.LeaseProxy); ok {
+		return lock.lost(leases.RenewLease(ctx, lock.containerName, lock.name, lock.token))
+	}
+	etag, err := lock.write(ctx, storage.IfMatch(lock.token))
+	if err != nil {
+		return lock.lost(err)
+	}
+	lock.token = etag
+	return nil
+}
+
+// Release frees a held lock so that another owner can acquire it at once. Releasing a lock that is not held does
+// nothing, and when it has been taken by another owner the error matches ErrLost.
+func (lock *Lock) Release(ctx context.Context) error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	if lock.token == "" {
+		return nil
+	}
+	var err error
+	if leases, ok := lock.proxy.(storage.LeaseProxy); ok {
+		err = leases.ReleaseLease(ctx, lock.containerName, lock.name, lock.token)
+	} else {
+		err = lock.proxy.DeleteFile(ctx, lock.containerName, lock.name, storage.IfMatch(lock.token))
+	}
+	if err = lock.lost(err); err != nil && !errors.Is(err, ErrLost) {
+		return err
+	}
+	lock.token = ""
+	return err
+}
+
+// lost forgets the lock when a request failed because another owner has taken it, and reports it as ErrLost
+func (lock *Lock) lost(err error) error {
+	if errors.Is(err, storage.ErrPreconditionFailed) || errors.Is(err, storage.ErrNotFound) {
+		lock.token = ""
+		return fmt.Errorf("lock %s was taken by another owner: %w: %w", lock.name, ErrLost, err)
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"lib-cloud-proxy-go/storage"
+	"os"
+	"testing"
+)
+
+// These tests need a storage account with hierarchical namespace enabled: set
+// ADLSConnectionString and ADLSContainerName in .env
+
+func getADLSProxy(t *testing.T) *storage.AzureDataLakeCloudStorageProxy {
+	proxy, err := storage.CloudStorageProxyFactory(storage.ProxyAuthHandlerAzureConnectionString{
+		ConnectionString:      os.Getenv("ADLSConnectionString"),
+		HierarchicalNamespace: true,
+	})
+	if err != nil {
+		printCloudError(err)
+		t.FailNow()
+	}
+	adlsProxy, ok := proxy.(*storage.AzureDataLakeCloudStorageProxy)
+	assert.True(t, ok)
+	return adlsProxy
+}
+
+func TestADLSDirectories(t *testing.T) {
+	adlsProxy := getADLSProxy(t)
+	container := os.Getenv("ADLSContainerName")
+	ctx := context.Background()
+	err := adlsProxy.CreateContainerIfNotExists(ctx, container)
+	printCloudError(err)
+	assert.True(t, err == nil)
+
+	err = adlsProxy.CreateDirectory(ctx, container, "adlsFolder/empty")
+	printCloudError(err)
+	assert.True(t, err == nil)
+	_, err = adlsProxy.UploadFileFromString(ctx, container, "adlsFolder/test.txt", nil, "hello")
+	printCloudError(err)
+	assert.True(t, err == nil)
+
+	// the empty directory is listed as a folder, and its marker blob is not listed as a file
+	folders, err := adlsProxy.ListFolders(ctx, container, 10, "adlsFolder/")
+	printCloudError(err)
+	assert.Contains(t, folders, "adlsFolder/empty/")
+	files, err := adlsProxy.ListFiles(ctx, container, 10, "adlsFolder/")
+	printCloudError(err)
+	assert.Equal(t, []string{"adlsFolder/test.txt"}, files)
+
+	err = adlsProxy.RenameFile(ctx, container, "adlsFolder/test.txt", "adlsFolder/renamed.txt")
+	printCloudError(err)
+	assert.True(t, err == nil)
+	err = adlsProxy.RenameDirectory(ctx, container, "adlsFolder", "adlsRenamed")
+	printCloudError(err)
+	assert.True(t, err == nil)
+	content, err := adlsProxy.GetFileContentAsString(ctx, container, "adlsRenamed/renamed.txt")
+	printCloudError(err)
+	assert.Equal(t, "hello", content)
+
+	err = adlsProxy.SetAccessControl(ctx, container, "adlsRenamed/renamed.txt", storage.AccessControl{Permissions: "rw-r-----"})
+	printCloudError(err)
+	assert.True(t, err == nil)
+	accessControl, err := adlsProxy.GetAccessControl(ctx, container, "adlsRenamed/renamed.txt")
+	printCloudError(err)
+	assert.Equal(t, "rw-r-----", accessControl.Permissions)
+
+	err = adlsProxy.DeleteDirectory(ctx, container, "adlsRenamed")
+	printCloudError(err)
+	assert.True(t, err == nil)
+	files, err = adlsProxy.ListFiles(ctx, container, 10, "adlsRenamed/")
+	printCloudError(err)
+	assert.Empty(t, files)
+}
@@ -0,0 +1,263 @@
+package test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"io"
+	"lib-cloud-proxy-go/storage"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeBlock struct {
+	id   string
+	data []byte
+}
+
+type fakeBlob struct {
+	blocks      []fakeBlock
+	etag        int
+	contentType string
+	metadata    map[string]string
+}
+
+// fakeBlobService serves the block blob requests of OpenWriter for a single account, keeping the staged blocks
+// of each blob until a commit or a delete discards them as Azure does
+type fakeBlobService struct {
+	mutex  sync.Mutex
+	blobs  map[string]*fakeBlob
+	staged map[string]map[string][]byte
+	etags  int
+	calls  []string
+}
+
+func newFakeBlobService() *fakeBlobService {
+	return &fakeBlobService{blobs: map[string]*fakeBlob{}, staged: map[string]map[string][]byte{}}
+}
+
+func (fake *fakeBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	query := r.URL.Query()
+	fake.calls = append(fake.calls, strings.TrimSpace(r.Method+" "+query.Get("comp")))
+	path := r.URL.Path
+	existing, exists := fake.blobs[path]
+	failCode := func(status int, code string) {
+		w.Header().Set("x-ms-error-code", code)
+		w.WriteHeader(status)
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && (!exists || ifMatch != fake.etag(existing)) {
+		failCode(http.StatusPreconditionFailed, "ConditionNotMet")
+		return
+	}
+	if r.Header.Get("If-None-Match") == "*" && exists {
+		failCode(http.StatusConflict, "BlobAlreadyExists")
+		return
+	}
+	switch {
+	case r.Method == http.MethodPut && query.Get("comp") == "block":
+		data, _ := io.ReadAll(r.Body)
+		if fake.staged[path] == nil {
+			fake.staged[path] = map[string][]byte{}
+		}
+		fake.staged[path][query.Get("blockid")] = data
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && query.Get("comp") == "blocklist":
+		var list struct {
+			Latest    []string `xml:"Latest"`
+			Committed []string `xml:"Committed"`
+		}
+		_ = xml.NewDecoder(r.Body).Decode(&list)
+		committed := map[string][]byte{}
+		if exists {
+			for _, block := range existing.blocks {
+				committed[block.id] = block.data
+			}
+		}
+		blob := newFakeBlob(r)
+		for _, id := range list.Latest {
+			data, ok := fake.staged[path][id]
+			if !ok {
+				data, ok = committed[id]
+			}
+			if !ok {
+				failCode(http.StatusBadRequest, "InvalidBlockList")
+				return
+			}
+			blob.blocks = append(blob.blocks, fakeBlock{id: id, data: data})
+		}
+		for _, id := range list.Committed {
+			blob.blocks = append(blob.blocks, fakeBlock{id: id, data: committed[id]})
+		}
+		fake.put(w, path, blob)
+	case r.Method == http.MethodPut:
+		// a blob uploaded whole has no blocks to commit again
+		blob := newFakeBlob(r)
+		data, _ := io.ReadAll(r.Body)
+		blob.blocks = []fakeBlock{{data: data}}
+		fake.put(w, path, blob)
+	case !exists:
+		failCode(http.StatusNotFound, "BlobNotFound")
+	case r.Method == http.MethodGet && query.Get("comp") == "blocklist":
+		response := `<?xml version="1.0" encoding="utf-8"?><BlockList><CommittedBlocks>`
+		for _, block := range existing.blocks {
+			if block.id == "" {
+				continue
+			}
+			response += fmt.Sprintf("<Block><Name>%s</Name><Size>%d</Size></Block>", block.id, len(block.data))
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Header().Set("ETag", fake.etag(existing))
+		_, _ = w.Write([]byte(response + "</CommittedBlocks><UncommittedBlocks /></BlockList>"))
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		content := existing.content()
+		w.Header().Set("ETag", fake.etag(existing))
+		w.Header().Set("Content-Type", existing.contentType)
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		w.Header().Set("x-ms-blob-type", "BlockBlob")
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		for name, value := range existing.metadata {
+			w.Header().Set("x-ms-meta-"+name, value)
+		}
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(content)
+		}
+	case r.Method == http.MethodDelete:
+		delete(fake.blobs, path)
+		delete(fake.staged, path)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func newFakeBlob(r *http.Request) *fakeBlob {
+	blob := &fakeBlob{contentType: r.Header.Get("x-ms-blob-content-type"), metadata: map[string]string{}}
+	for key, values := range r.Header {
+		if name, ok := strings.CutPrefix(strings.ToLower(key), "x-ms-meta-"); ok {
+			blob.metadata[name] = values[0]
+		}
+	}
+	return blob
+}
+
+func (fake *fakeBlobService) put(w http.ResponseWriter, path string, blob *fakeBlob) {
+	fake.etags++
+	blob.etag = fake.etags
+	fake.blobs[path] = blob
+	delete(fake.staged, path)
+	w.Header().Set("ETag", fake.etag(blob))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (fake *fakeBlobService) etag(blob *fakeBlob) string {
+	return fmt.Sprintf(`"0x%d"`, blob.etag)
+}
+
+func (blob *fakeBlob) content() []byte {
+	content := make([]byte, 0)
+	for _, block := range blob.blocks {
+		content = append(content, block.data...)
+	}
+	return content
+}
+
+func getFakeAzureProxy(t *testing.T, fake *fakeBlobService) storage.CloudStorageProxy {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	// the well-known key of the Azure Storage emulator
+	proxy, err := storage.CloudStorageProxyFactory(storage.ProxyAuthHandlerAzureConnectionString{
+		ConnectionString: "DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;" +
+			"AccountKey=Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw==;" +
+			"BlobEndpoint=" + server.URL + "/devstoreaccount1;",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proxy
+}
+
+// abortWrite stages two blocks of a blob, then cancels the writer so that it aborts
+func abortWrite(t *testing.T, fake *fakeBlobService, proxy storage.CloudStorageProxy, fileName string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	writer, err := proxy.OpenWriter(ctx, "container", fileName, storage.WriterOptions{PartSize: 4, Concurrency: 1})
+	assert.Nil(t, err)
+	// the second block is twice the size of the first
+	_, err = writer.Write([]byte("0123456789ab"))
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		fake.mutex.Lock()
+		defer fake.mutex.Unlock()
+		return len(fake.staged["/devstoreaccount1/container/"+fileName]) == 2
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, writer.Close(), context.Canceled)
+}
+
+func TestAzureOpenWriterAbort(t *testing.T) {
+	fake := newFakeBlobService()
+	proxy := getFakeAzureProxy(t, fake)
+	ctx := context.Background()
+
+	// the staged blocks of a new blob are committed empty, then the blob is deleted
+	abortWrite(t, fake, proxy, "new.txt")
+	assert.Empty(t, fake.staged)
+	assert.Empty(t, fake.blobs)
+	assert.Equal(t, []string{"PUT block", "PUT block", "HEAD", "PUT blocklist", "DELETE"}, fake.calls)
+
+	// the staged blocks of an existing blob are discarded by committing the blocks it has
+	writer, err := proxy.OpenWriter(ctx, "container", "existing.txt", storage.WriterOptions{
+		Metadata: map[string]string{storage.MetadataContentType: "text/plain", "owner": "reports"},
+		PartSize: 4,
+	})
+	assert.Nil(t, err)
+	_, err = writer.Write([]byte("old content"))
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+	fake.calls = nil
+	abortWrite(t, fake, proxy, "existing.txt")
+	assert.Empty(t, fake.staged)
+	assert.Equal(t, []string{"PUT block", "PUT block", "HEAD", "GET blocklist", "PUT blocklist"}, fake.calls)
+	content, err := proxy.GetFileContentAsString(ctx, "container", "existing.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "old content", content)
+	blob := fake.blobs["/devstoreaccount1/container/existing.txt"]
+	assert.Equal(t, "text/plain", blob.contentType)
+	assert.Equal(t, map[string]string{"owner": "reports"}, blob.metadata)
+
+	// a blob uploaded whole is left as it is, with the staged blocks
+	_, err = proxy.UploadFileFromString(ctx, "container", "whole.txt", nil, "whole content")
+	assert.Nil(t, err)
+	fake.calls = nil
+	abortWrite(t, fake, proxy, "whole.txt")
+	assert.Len(t, fake.staged["/devstoreaccount1/container/whole.txt"], 2)
+	assert.Equal(t, []string{"PUT block", "PUT block", "HEAD", "GET blocklist"}, fake.calls)
+	content, err = proxy.GetFileContentAsString(ctx, "container", "whole.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "whole content", content)
+}
+
+func TestAzureFindFilesByTagsInvalid(t *testing.T) {
+	fake := newFakeBlobService()
+	proxy := getFakeAzureProxy(t, fake)
+	ctx := context.Background()
+
+	// keys and values outside the characters Azure allows are rejected before the query is built
+	for _, tags := range []map[string]string{
+		{"status": "validated' OR 'a' = 'a"},
+		{`status" = 'x' OR "a`: "validated"},
+		{"": "validated"},
+		{strings.Repeat("k", 129): "validated"},
+		{"status": strings.Repeat("v", 257)},
+	} {
+		_, err := proxy.FindFilesByTags(ctx, "container", "", tags)
+		assert.NotNil(t, err)
+	}
+	assert.Empty(t, fake.calls)
+}
@@ -0,0 +1,78 @@
+package test
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"lib-cloud-proxy-go/secrets"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// unavailableSecretsProxy fails every request the way an unreachable secret store would
+type unavailableSecretsProxy struct{}
+
+var errUnavailable = errors.New("connection refused")
+
+func (unavailableSecretsProxy) GetSecret(ctx context.Context, name string) (string, error) {
+	return "", errUnavailable
+}
+
+func (unavailableSecretsProxy) GetBinarySecret(ctx context.Context, name string) ([]byte, error) {
+	return nil, errUnavailable
+}
+
+func TestChainedGetSecret(t *testing.T) {
+	secretsDir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(secretsDir, "db-password"), []byte("local"), 0o600))
+	cacheOptions := &secrets.CloudSecretsCacheOptions{MaxEntries: 10, TTL: time.Minute * 10}
+	local, err := secrets.CloudSecretsProxyFactory(secrets.ProxyAuthHandlerLocal{SecretsDir: secretsDir}, cacheOptions)
+	printCloudSecretsError(err)
+	gcp := getGCPSecretsProxy(t, &fakeSecretManager{payloads: map[string][]byte{
+		"projects/cdc-test/secrets/db-password/versions/latest": []byte("gcp"),
+		"projects/cdc-test/secrets/api-key/versions/latest":     []byte("gcp-api-key"),
+	}})
+
+	proxy, err := secrets.CloudSecretsProxyFactory(secrets.ProxyAuthHandlerChain{Sources: []secrets.ChainedSource{
+		{Name: "local", Proxy: local},
+		{Name: "gcp", Proxy: gcp},
+		{Name: "unavailable", Proxy: unavailableSecretsProxy{}},
+	}}, cacheOptions)
+	printCloudSecretsError(err)
+	if !assert.Nil(t, err) {
+		return
+	}
+	chain := proxy.(*secrets.ChainedCloudSecretsProxy)
+	ctx := context.Background()
+
+	value, source, err := chain.GetSecretWithSource(ctx, "db-password")
+	printCloudSecretsError(err)
+	assert.Equal(t, "local", value)
+	assert.Equal(t, "local", source)
+
+	binary, source, err := chain.GetBinarySecretWithSource(ctx, "api-key")
+	printCloudSecretsError(err)
+	assert.Equal(t, []byte("gcp-api-key"), binary)
+	assert.Equal(t, "gcp", source)
+
+	// not found falls through to the next source, but any other error stops the chain
+	_, source, err = chain.GetSecretWithSource(ctx, "signing-key")
+	assert.ErrorIs(t, err, errUnavailable)
+	assert.Equal(t, "unavailable", source)
+
+	nested, err := secrets.CloudSecretsProxyFactory(secrets.ProxyAuthHandlerChain{Sources: []secrets.ChainedSource{
+		{Name: "local", Proxy: local},
+		{Name: "gcp", Proxy: gcp},
+	}}, cacheOptions)
+	assert.Nil(t, err)
+	proxy, err = secrets.CloudSecretsProxyFactory(secrets.ProxyAuthHandlerChain{Sources: []secrets.ChainedSource{
+		{Name: "nested", Proxy: nested},
+		{Name: "fallback", Proxy: local},
+	}}, cacheOptions)
+	assert.Nil(t, err)
+	_, err = proxy.GetSecret(ctx, "signing-key")
+	assert.ErrorIs(t, err, secrets.ErrNotFound)
+	assert.NotErrorIs(t, err, errUnavailable)
+}
@@ -0,0 +1,88 @@
+package test
+
+import (
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"lib-cloud-proxy-go/secrets"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSecretManager serves AccessSecretVersion from a map of version names to payloads
+type fakeSecretManager struct {
+	secretmanagerpb.UnimplementedSecretManagerServiceServer
+	mutex    sync.Mutex
+	payloads map[string][]byte
+	calls    int
+}
+
+func (fake *fakeSecretManager) AccessSecretVersion(ctx context.Context,
+	req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.calls++
+	data, ok := fake.payloads[req.Name]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "secret "+req.Name+" not found")
+	}
+	return &secretmanagerpb.AccessSecretVersionResponse{
+		Name:    req.Name,
+		Payload: &secretmanagerpb.SecretPayload{Data: data},
+	}, nil
+}
+
+func getGCPSecretsProxy(t *testing.T, fake *fakeSecretManager) secrets.CloudSecretsProxy {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := grpc.NewServer()
+	secretmanagerpb.RegisterSecretManagerServiceServer(server, fake)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	t.Setenv("SECRET_MANAGER_EMULATOR_HOST", listener.Addr().String())
+	proxy, err := secrets.CloudSecretsProxyFactory(secrets.ProxyAuthHandlerGCPDefaultIdentity{ProjectID: "cdc-test"},
+		&secrets.CloudSecretsCacheOptions{
+			MaxEntries: 10,
+			TTL:        time.Minute * 10,
+		})
+	if err != nil {
+		printCloudSecretsError(err)
+		t.FailNow()
+	}
+	t.Cleanup(func() { assert.Nil(t, proxy.(*secrets.GCPCloudSecretsProxy).Close()) })
+	return proxy
+}
+
+func TestGCPGetSecret(t *testing.T) {
+	fake := &fakeSecretManager{payloads: map[string][]byte{
+		"projects/cdc-test/secrets/db-password/versions/latest": []byte("s3cr3t"),
+		"projects/other/secrets/signing-key/versions/2":         {0x00, 0xff, 0x10},
+	}}
+	gc := getGCPSecretsProxy(t, fake)
+	ctx := context.Background()
+
+	value, err := gc.GetSecret(ctx, "db-password")
+	printCloudSecretsError(err)
+	assert.Equal(t, "s3cr3t", value)
+	// the second read is served from the cache
+	value, err = gc.GetSecret(ctx, "db-password")
+	assert.Equal(t, "s3cr3t", value)
+	assert.Equal(t, 1, fake.calls)
+
+	binary, err := gc.GetBinarySecret(ctx, "projects/other/secrets/signing-key/versions/2")
+	printCloudSecretsError(err)
+	assert.Equal(t, []byte{0x00, 0xff, 0x10}, binary)
+
+	_, err = gc.GetSecret(ctx, "missing")
+	assert.NotNil(t, err)
+	var cloudError *secrets.CloudSecretsError
+	assert.ErrorAs(t, err, &cloudError)
+	assert.Equal(t, codes.NotFound, status.Code(cloudError.Unwrap()))
+	assert.ErrorIs(t, err, secrets.ErrNotFound)
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"lib-cloud-proxy-go/storage"
+	"os"
+	"testing"
+)
+
+// These tests run against GCS, or against an emulator such as fake-gcs-server when
+// STORAGE_EMULATOR_HOST is set in .env (e.g. STORAGE_EMULATOR_HOST=localhost:4443)
+
+func getGCPProxy(t *testing.T) storage.CloudStorageProxy {
+	gcpProxy, err := storage.CloudStorageProxyFactory(storage.ProxyAuthHandlerGCPDefaultIdentity{
+		ProjectID: os.Getenv("GCPProjectID"),
+	})
+	if err != nil {
+		printCloudError(err)
+		t.FailNow()
+	}
+	return gcpProxy
+}
+
+func TestGCPUploadAndGetFile(t *testing.T) {
+	gcpProxy := getGCPProxy(t)
+	container := os.Getenv("GCSContainerName")
+	ctx := context.Background()
+	err := gcpProxy.CreateContainerIfNotExists(ctx, container)
+	printCloudError(err)
+	assert.True(t, err == nil)
+
+	content, err := os.ReadFile("test.HL7")
+	assert.True(t, err == nil)
+	metadata := map[string]string{
+		"upload_id":      "1234567890",
+		"data_stream_id": "DAART",
+	}
+	_, err = gcpProxy.UploadFileFromString(ctx, container, "testFolder/test-fldr-upload.HL7", metadata, string(content))
+	printCloudError(err)
+	assert.True(t, err == nil)
+
+	cloudFile, err := gcpProxy.GetFile(ctx, container, "testFolder/test-fldr-upload.HL7")
+	printCloudError(err)
+	assert.True(t, err == nil)
+	assert.Equal(t, string(content), cloudFile.Content)
+	assert.Equal(t, "DAART", cloudFile.Metadata["data_stream_id"])
+
+	folders, err := gcpProxy.ListFolders(ctx, container, 10, "test")
+	printCloudError(err)
+	assert.Contains(t, folders, "testFolder/")
+	files, err := gcpProxy.ListFiles(ctx, container, 10, "testFolder/")
+	printCloudError(err)
+	assert.Contains(t, files, "testFolder/test-fldr-upload.HL7")
+
+	err = gcpProxy.CopyFileFromLocalStorage(ctx, container, "testFolder/test-fldr-upload.HL7",
+		container, "testFolder/test-copy.HL7", 1)
+	printCloudError(err)
+	assert.True(t, err == nil)
+	err = gcpProxy.DeleteFile(ctx, container, "testFolder/test-copy.HL7")
+	printCloudError(err)
+	assert.True(t, err == nil)
+}
+
+func TestGetGCPSignedURL(t *testing.T) {
+	gcpProxy, err := storage.CloudStorageProxyFactory(storage.ProxyAuthHandlerGCPServiceAccountJSON{
+		CredentialsJSON: os.Getenv("GCPServiceAccountJSON"),
+	})
+	if err != nil {
+		printCloudError(err)
+		assert.Fail(t, "failed getting gcp proxy")
+		return
+	}
+	url, err := gcpProxy.GetSourceBlobSignedURL(context.Background(), os.Getenv("GCSContainerName"),
+		"testFolder/test-fldr-upload.HL7")
+	printCloudError(err)
+	fmt.Println(url)
+	assert.True(t, err == nil)
+}
+
+func TestCopyGCPToS3(t *testing.T) {
+	gcpProxy := getGCPProxy(t)
+	awsProxy, err := storage.CloudStorageProxyFactory(storage.ProxyAuthHandlerAWSDefaultIdentity{
+		AccountURL: os.Getenv("S3AccountURL"),
+	})
+	if err != nil {
+		printCloudError(err)
+		assert.Fail(t, "failed getting aws proxy")
+		return
+	}
+	err = awsProxy.CopyFileFromRemoteStorage(context.Background(), os.Getenv("GCSContainerName"),
+		"testFolder/test-fldr-upload.HL7", s3container, "test-from-gcs.HL7", &gcpProxy, 10)
+	printCloudError(err)
+	assert.True(t, err == nil)
+}
+
+func TestCopyAzureToGCP(t *testing.T) {
+	gcpProxy := getGCPProxy(t)
+	azureProxy, err := storage.CloudStorageProxyFactory(storage.ProxyAuthHandlerAzureConnectionString{
+		ConnectionString: os.Getenv("ConnectionString"),
+	})
+	if err != nil {
+		printCloudError(err)
+		assert.Fail(t, "failure getting azure proxy")
+		return
+	}
+	err = gcpProxy.CopyFileFromRemoteStorage(context.Background(), azureContainer, "test.HL7",
+		os.Getenv("GCSContainerName"), "test-from-azure.HL7", &azureProxy, 10)
+	printCloudError(err)
+	assert.True(t, err == nil)
+}
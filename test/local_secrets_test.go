@@ -0,0 +1,71 @@
+package test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"lib-cloud-proxy-go/secrets"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLocalGetSecret(t *testing.T) {
+	secretsDir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(secretsDir, "db-password"), []byte("from-file"), 0o600))
+	dotEnvFile := filepath.Join(t.TempDir(), ".env")
+	assert.Nil(t, os.WriteFile(dotEnvFile, []byte("HL7_API_KEY=from-dotenv\nHL7_DB_PASSWORD=unused\n"), 0o600))
+	t.Setenv("HL7_SIGNING_KEY", "from-environment")
+	t.Setenv("HL7_API_KEY", "from-environment")
+
+	proxy, err := secrets.CloudSecretsProxyFactory(secrets.ProxyAuthHandlerLocal{
+		SecretsDir:  secretsDir,
+		DotEnvFiles: []string{dotEnvFile},
+		EnvPrefix:   "HL7_",
+	}, &secrets.CloudSecretsCacheOptions{
+		MaxEntries: 10,
+		TTL:        time.Minute * 10,
+	})
+	printCloudSecretsError(err)
+	if !assert.Nil(t, err) {
+		return
+	}
+	ctx := context.Background()
+
+	// files take precedence over dotenv files, and the environment is only used when enabled
+	value, err := proxy.GetSecret(ctx, "db-password")
+	printCloudSecretsError(err)
+	assert.Equal(t, "from-file", value)
+	value, err = proxy.GetSecret(ctx, "api-key")
+	printCloudSecretsError(err)
+	assert.Equal(t, "from-dotenv", value)
+	_, err = proxy.GetSecret(ctx, "signing-key")
+	assert.ErrorIs(t, err, secrets.ErrNotFound)
+
+	// changing a file invalidates the cached value, even within the TTL
+	assert.Nil(t, os.WriteFile(filepath.Join(secretsDir, "db-password"), []byte("rotated-value"), 0o600))
+	binary, err := proxy.GetBinarySecret(ctx, "db-password")
+	printCloudSecretsError(err)
+	assert.Equal(t, []byte("rotated-value"), binary)
+	assert.Nil(t, os.WriteFile(dotEnvFile, []byte("HL7_API_KEY=rotated-dotenv\n"), 0o600))
+	value, err = proxy.GetSecret(ctx, "api-key")
+	assert.Equal(t, "rotated-dotenv", value)
+
+	envProxy, err := secrets.CloudSecretsProxyFactory(secrets.ProxyAuthHandlerLocal{
+		DotEnvFiles:    []string{dotEnvFile},
+		UseEnvironment: true,
+		EnvPrefix:      "HL7_",
+	}, &secrets.CloudSecretsCacheOptions{
+		MaxEntries: 10,
+		TTL:        time.Minute * 10,
+	})
+	printCloudSecretsError(err)
+	if !assert.Nil(t, err) {
+		return
+	}
+	// the environment takes precedence over dotenv files
+	value, err = envProxy.GetSecret(ctx, "signing-key")
+	assert.Equal(t, "from-environment", value)
+	value, err = envProxy.GetSecret(ctx, "api-key")
+	assert.Equal(t, "from-environment", value)
+}
@@ -0,0 +1,365 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"lib-cloud-proxy-go/storage"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func getLocalProxy(t *testing.T) storage.CloudStorageProxy {
+	proxy, err := storage.CloudStorageProxyFactory(storage.ProxyAuthHandlerLocalFilesystem{
+		RootDir: t.TempDir(),
+	})
+	if err != nil {
+		printCloudError(err)
+		t.FailNow()
+	}
+	assert.Nil(t, proxy.CreateContainerIfNotExists(context.Background(), "local-container"))
+	return proxy
+}
+
+func TestLocalUploadAndGetFile(t *testing.T) {
+	proxy := getLocalProxy(t)
+	ctx := context.Background()
+	content, err := os.ReadFile("test.HL7")
+	assert.Nil(t, err)
+	metadata := map[string]string{
+		"upload_id":      "1234567890",
+		"data_stream_id": "DAART",
+	}
+	_, err = proxy.UploadFileFromString(ctx, "local-container", "testFolder/test-fldr-upload.HL7", metadata, string(content))
+	printCloudError(err)
+	assert.Nil(t, err)
+
+	cloudFile, err := proxy.GetFile(ctx, "local-container", "testFolder/test-fldr-upload.HL7")
+	assert.Nil(t, err)
+	assert.Equal(t, string(content), cloudFile.Content)
+	assert.Equal(t, "DAART", cloudFile.Metadata["data_stream_id"])
+	assert.Equal(t, "1234567890", cloudFile.Metadata["upload_id"])
+	assert.Equal(t, strconv.Itoa(len(content)), cloudFile.Metadata["content_length"])
+	assert.NotEmpty(t, cloudFile.Metadata["last_modified"])
+
+	reader, err := proxy.GetFileContentAsInputStream(ctx, "local-container", "testFolder/test-fldr-upload.HL7")
+	assert.Nil(t, err)
+	streamed, err := io.ReadAll(reader)
+	_ = reader.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, content, streamed)
+
+	_, err = proxy.GetFile(ctx, "local-container", "testFolder/missing.HL7")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	exists, err := proxy.Exists(ctx, "local-container", "testFolder/test-fldr-upload.HL7")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	exists, err = proxy.Exists(ctx, "local-container", "testFolder")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	// a missing container is not taken for a missing file
+	_, err = proxy.Exists(ctx, "missing-container", "test.HL7")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = proxy.UploadFileFromString(ctx, "missing-container", "test.HL7", nil, "content")
+	assert.NotNil(t, err)
+	_, err = proxy.UploadFileFromString(ctx, "local-container", "../escape.HL7", nil, "content")
+	assert.NotNil(t, err)
+}
+
+func TestLocalListFilesAndFolders(t *testing.T) {
+	proxy := getLocalProxy(t)
+	ctx := context.Background()
+	for _, name := range []string{"hl7_a/1.HL7", "hl7_a/2.HL7", "hl7_b/1.HL7", "hl7_top.HL7", "other/1.HL7", "top.HL7"} {
+		_, err := proxy.UploadFileFromString(ctx, "local-container", name, nil, name)
+		assert.Nil(t, err)
+	}
+
+	folders, err := proxy.ListFolders(ctx, "local-container", 10, "hl7_")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hl7_a/", "hl7_b/"}, folders)
+
+	files, err := proxy.ListFiles(ctx, "local-container", 10, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hl7_top.HL7", "top.HL7"}, files)
+
+	files, err = proxy.ListFiles(ctx, "local-container", 1, "hl7_a/")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hl7_a/1.HL7"}, files)
+
+	files, err = proxy.ListFiles(ctx, "local-container", 10, "nothing/")
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+
+	_, err = proxy.ListFiles(ctx, "missing-container", 10, "")
+	assert.NotNil(t, err)
+
+	// deleting the last file in a folder removes the folder
+	assert.Nil(t, proxy.DeleteFile(ctx, "local-container", "hl7_b/1.HL7"))
+	folders, err = proxy.ListFolders(ctx, "local-container", 10, "hl7_")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hl7_a/"}, folders)
+	assert.NotNil(t, proxy.DeleteFile(ctx, "local-container", "hl7_b/1.HL7"))
+}
+
+func TestLocalListObjects(t *testing.T) {
+	proxy := getLocalProxy(t)
+	ctx := context.Background()
+	_, err := proxy.UploadFileFromString(ctx, "local-container", "hl7/1.HL7", map[string]string{"Upload_ID": "1"}, "first")
+	assert.Nil(t, err)
+	_, err = proxy.UploadFileFromString(ctx, "local-container", "hl7/2.HL7", nil, "second file")
+	assert.Nil(t, err)
+	_, err = proxy.UploadFileFromString(ctx, "local-container", "hl7/nested/3.HL7", nil, "third")
+	assert.Nil(t, err)
+
+	objects, err := proxy.ListObjects(ctx, "local-container", 10, "hl7/", true)
+	printCloudError(err)
+	if !assert.Len(t, objects, 2) {
+		return
+	}
+	assert.Equal(t, "hl7/1.HL7", objects[0].Name)
+	assert.Equal(t, int64(5), objects[0].Size)
+	assert.Equal(t, map[string]string{"upload_id": "1"}, objects[0].Metadata)
+	assert.NotEmpty(t, objects[0].ETag)
+	assert.False(t, objects[0].LastModified.IsZero())
+	assert.Equal(t, int64(11), objects[1].Size)
+	assert.Empty(t, objects[1].Metadata)
+	assert.NotEqual(t, objects[0].ETag, objects[1].ETag)
+
+	objects, err = proxy.ListObjects(ctx, "local-container", 1, "hl7/", false)
+	assert.Nil(t, err)
+	assert.Len(t, objects, 1)
+	assert.Nil(t, objects[0].Metadata)
+}
+
+func TestLocalListObjectsPage(t *testing.T) {
+	proxy := getLocalProxy(t)
+	ctx := context.Background()
+	for _, name := range []string{"hl7/a.HL7", "hl7/b/1.HL7", "hl7/b/2.HL7", "hl7/c.HL7", "hl7/d/e/3.HL7", "other.HL7"} {
+		_, err := proxy.UploadFileFromString(ctx, "local-container", name, nil, name)
+		assert.Nil(t, err)
+	}
+
+	// files and folders share a page, in name order
+	page, err := proxy.ListObjectsPage(ctx, "local-container", storage.ListOptions{Prefix: "hl7/", PageSize: 2})
+	printCloudError(err)
+	assert.Equal(t, []string{"hl7/b/"}, page.Folders)
+	assert.Equal(t, "hl7/a.HL7", page.Objects[0].Name)
+	assert.NotEmpty(t, page.ContinuationToken)
+	page, err = proxy.ListObjectsPage(ctx, "local-container", storage.ListOptions{
+		Prefix: "hl7/", PageSize: 2, PageToken: page.ContinuationToken})
+	assert.Nil(t, err)
+	assert.Equal(t, "hl7/c.HL7", page.Objects[0].Name)
+	assert.Equal(t, []string{"hl7/d/"}, page.Folders)
+	assert.Empty(t, page.ContinuationToken)
+
+	names := make([]string, 0)
+	for object, err := range storage.Objects(ctx, proxy, "local-container", storage.ListOptions{
+		Prefix: "hl7/", Recursive: true, PageSize: 2}) {
+		assert.Nil(t, err)
+		names = append(names, object.Name)
+	}
+	assert.Equal(t, []string{"hl7/a.HL7", "hl7/b/1.HL7", "hl7/b/2.HL7", "hl7/c.HL7", "hl7/d/e/3.HL7"}, names)
+
+	_, err = proxy.ListObjectsPage(ctx, "local-container", storage.ListOptions{PageToken: "not a token"})
+	assert.NotNil(t, err)
+}
+
+func TestLocalDeletePrefix(t *testing.T) {
+	proxy := getLocalProxy(t)
+	ctx := context.Background()
+	names := make([]string, 0)
+	for i := 0; i < 1500; i++ {
+		names = append(names, fmt.Sprintf("processed/%d/%04d.HL7", i%3, i))
+	}
+	for _, name := range append(names, "processing/1.HL7") {
+		_, err := proxy.UploadFileFromString(ctx, "local-container", name, nil, name)
+		assert.Nil(t, err)
+	}
+
+	results, err := proxy.DeletePrefix(ctx, "local-container", "processed/", 4)
+	assert.Nil(t, err)
+	assert.Len(t, results, len(names))
+	for _, result := range results {
+		assert.Nil(t, result.Err)
+	}
+	folders, err := proxy.ListFolders(ctx, "local-container", 10, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"processing/"}, folders)
+
+	_, err = proxy.DeletePrefix(ctx, "local-container", "", 4)
+	assert.NotNil(t, err)
+}
+
+func TestLocalMoveFile(t *testing.T) {
+	proxy := getLocalProxy(t)
+	ctx := context.Background()
+	assert.Nil(t, proxy.CreateContainerIfNotExists(ctx, "local-dest"))
+	metadata := map[string]string{"data_stream_id": "DAART"}
+	_, err := proxy.UploadFileFromString(ctx, "local-container", "incoming/test.HL7", metadata, "MSH|^~\\&|")
+	assert.Nil(t, err)
+
+	err = proxy.MoveFile(ctx, "local-container", "incoming/test.HL7", "local-dest", "processed/test.HL7")
+	printCloudError(err)
+	assert.Nil(t, err)
+	moved, err := proxy.GetFile(ctx, "local-dest", "processed/test.HL7")
+	assert.Nil(t, err)
+	assert.Equal(t, "MSH|^~\\&|", moved.Content)
+	assert.Equal(t, "DAART", moved.Metadata["data_stream_id"])
+	exists, err := proxy.Exists(ctx, "local-container", "incoming/test.HL7")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	folders, err := proxy.ListFolders(ctx, "local-container", 10, "")
+	assert.Nil(t, err)
+	assert.Empty(t, folders)
+
+	// a move that already completed does not know the file at its destination, and fails as a missing file does
+	err = proxy.MoveFile(ctx, "local-container", "incoming/test.HL7", "local-dest", "processed/test.HL7")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	err = proxy.MoveFile(ctx, "local-container", "incoming/missing.HL7", "local-dest", "processed/missing.HL7")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	for i := 0; i < 5; i++ {
+		_, err = proxy.UploadFileFromString(ctx, "local-container", fmt.Sprintf("incoming/%d/%d.HL7", i%2, i), nil, "MSH")
+		assert.Nil(t, err)
+	}
+	results, err := proxy.MovePrefix(ctx, "local-container", "incoming/", "local-container", "processed/", 4)
+	assert.Nil(t, err)
+	assert.Len(t, results, 5)
+	for _, result := range results {
+		assert.Nil(t, result.Err)
+	}
+	files, err := proxy.ListFiles(ctx, "local-container", 10, "processed/1/")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"processed/1/1.HL7", "processed/1/3.HL7"}, files)
+
+	_, err = proxy.MovePrefix(ctx, "local-container", "processed/", "local-container", "processed/old/", 4)
+	assert.NotNil(t, err)
+}
+
+func TestLocalTags(t *testing.T) {
+	proxy := getLocalProxy(t)
+	ctx := context.Background()
+	metadata := map[string]string{"data_stream_id": "DAART"}
+	_, err := proxy.UploadFileFromString(ctx, "local-container", "hl7/1.HL7", metadata, "MSH")
+	assert.Nil(t, err)
+	_, err = proxy.UploadFileFromString(ctx, "local-container", "hl7/2.HL7", nil, "MSH")
+	assert.Nil(t, err)
+	assert.Nil(t, proxy.SetTags(ctx, "local-container", "hl7/1.HL7", map[string]string{"status": "validated"}))
+
+	tags, err := proxy.GetTags(ctx, "local-container", "hl7/1.HL7")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"status": "validated"}, tags)
+	fileMetadata, err := proxy.GetMetadata(ctx, "local-container", "hl7/1.HL7")
+	assert.Nil(t, err)
+	assert.Equal(t, "DAART", fileMetadata["data_stream_id"])
+	found, err := proxy.FindFilesByTags(ctx, "local-container", "hl7/", map[string]string{"status": "validated"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hl7/1.HL7"}, found)
+
+	// moving a file keeps its tags
+	assert.Nil(t, proxy.MoveFile(ctx, "local-container", "hl7/1.HL7", "local-container", "done/1.HL7"))
+	tags, err = proxy.GetTags(ctx, "local-container", "done/1.HL7")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"status": "validated"}, tags)
+
+	err = proxy.SetTags(ctx, "local-container", "hl7/1.HL7", map[string]string{"status": "validated"})
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestLocalFileRange(t *testing.T) {
+	proxy := getLocalProxy(t)
+	ctx := context.Background()
+	_, err := proxy.UploadFileFromString(ctx, "local-container", "test.HL7", nil, "MSH|^~\\&|DAART")
+	assert.Nil(t, err)
+
+	body, err := proxy.GetFileRange(ctx, "local-container", "test.HL7", 4, 4)
+	assert.Nil(t, err)
+	content, err := io.ReadAll(body)
+	assert.Nil(t, err)
+	assert.Nil(t, body.Close())
+	assert.Equal(t, "^~\\&", string(content))
+	_, err = proxy.GetFileRange(ctx, "local-container", "test.HL7", 14, -1)
+	assert.NotNil(t, err)
+
+	reader, err := proxy.OpenReader(ctx, "local-container", "test.HL7")
+	assert.Nil(t, err)
+	defer reader.Close()
+	_, err = reader.Seek(9, io.SeekStart)
+	assert.Nil(t, err)
+	content, err = io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "DAART", string(content))
+}
+
+func TestLocalOpenWriter(t *testing.T) {
+	proxy := getLocalProxy(t)
+	ctx := context.Background()
+	writer, err := proxy.OpenWriter(ctx, "local-container", "hl7/batch.HL7", storage.WriterOptions{
+		Metadata: map[string]string{"data_stream_id": "DAART"},
+		PartSize: 16,
+	})
+	assert.Nil(t, err)
+	content := strings.Repeat("MSH|^~\\&|DAART\r", 10)
+	_, err = io.Copy(writer, strings.NewReader(content))
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+
+	file, err := proxy.GetFile(ctx, "local-container", "hl7/batch.HL7")
+	assert.Nil(t, err)
+	assert.Equal(t, content, file.Content)
+	assert.Equal(t, writer.ETag(), file.Metadata["etag"])
+	assert.Equal(t, "DAART", file.Metadata["data_stream_id"])
+
+	// a stream of unknown size
+	_, err = proxy.UploadFileFromInputStream(ctx, "local-container", "hl7/stream.HL7", nil, strings.NewReader(content), -1, 0)
+	assert.Nil(t, err)
+	streamed, err := proxy.GetFileContentAsString(ctx, "local-container", "hl7/stream.HL7")
+	assert.Nil(t, err)
+	assert.Equal(t, content, streamed)
+
+	// a cancelled upload leaves the file as it was
+	cancelled, cancel := context.WithCancel(ctx)
+	writer, err = proxy.OpenWriter(cancelled, "local-container", "hl7/batch.HL7", storage.WriterOptions{PartSize: 16})
+	assert.Nil(t, err)
+	_, err = writer.Write([]byte(strings.Repeat("replaced", 10)))
+	assert.Nil(t, err)
+	cancel()
+	assert.ErrorIs(t, writer.Close(), context.Canceled)
+	content, err = proxy.GetFileContentAsString(ctx, "local-container", "hl7/batch.HL7")
+	assert.Nil(t, err)
+	assert.Equal(t, file.Content, content)
+}
+
+func TestLocalCopyFile(t *testing.T) {
+	proxy := getLocalProxy(t)
+	ctx := context.Background()
+	assert.Nil(t, proxy.CreateContainerIfNotExists(ctx, "local-dest"))
+	metadata := map[string]string{"data_stream_id": "DAART", storage.MetadataContentType: "text/plain"}
+	_, err := proxy.UploadFileFromInputStream(ctx, "local-container", "source.txt", metadata,
+		strings.NewReader("copy me"), 7, 1)
+	assert.Nil(t, err)
+
+	err = proxy.CopyFileFromLocalStorage(ctx, "local-container", "source.txt", "local-dest", "copied/dest.txt", 1)
+	printCloudError(err)
+	assert.Nil(t, err)
+	copied, err := proxy.GetFile(ctx, "local-dest", "copied/dest.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "copy me", copied.Content)
+	assert.Equal(t, "DAART", copied.Metadata["data_stream_id"])
+	assert.Equal(t, "text/plain", copied.Metadata[storage.MetadataContentType])
+
+	other := getLocalProxy(t)
+	err = other.CopyFileFromRemoteStorage(ctx, "local-container", "source.txt", "local-container", "remote.txt", &proxy, 1)
+	assert.Nil(t, err)
+	content, err := other.GetFileContentAsString(ctx, "local-container", "remote.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "copy me", content)
+
+	url, err := proxy.GetSourceBlobSignedURL(ctx, "local-container", "source.txt")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(url, "file:///"))
+	assert.True(t, strings.HasSuffix(url, "/local-container/source.txt"))
+}
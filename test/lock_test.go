@@ -0,0 +1,106 @@
+package test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"lib-cloud-proxy-go/storage/lock"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLockAcquireAndRelease(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	first := lock.New(proxy, "memory-container", "locks/nightly-export", lock.Options{Owner: "first"})
+	second := lock.New(proxy, "memory-container", "locks/nightly-export", lock.Options{Owner: "second"})
+
+	assert.Nil(t, first.Acquire(ctx))
+	assert.ErrorIs(t, second.Acquire(ctx), lock.ErrHeld)
+	assert.Nil(t, first.Renew(ctx))
+	assert.ErrorIs(t, second.Renew(ctx), lock.ErrLost)
+
+	assert.Nil(t, first.Release(ctx))
+	exists, err := proxy.Exists(ctx, "memory-container", "locks/nightly-export")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	assert.Nil(t, second.Acquire(ctx))
+	assert.ErrorIs(t, first.Acquire(ctx), lock.ErrHeld)
+	// releasing a lock that is not held does nothing
+	assert.Nil(t, first.Release(ctx))
+	assert.Nil(t, second.Release(ctx))
+}
+
+func TestLockExpiry(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	first := lock.New(proxy, "memory-container", "locks/nightly-export", lock.Options{TTL: 50 * time.Millisecond})
+	second := lock.New(proxy, "memory-container", "locks/nightly-export", lock.Options{TTL: 50 * time.Millisecond})
+
+	assert.Nil(t, first.Acquire(ctx))
+	assert.ErrorIs(t, second.Acquire(ctx), lock.ErrHeld)
+	time.Sleep(100 * time.Millisecond)
+	// the first owner did not renew in time
+	assert.Nil(t, second.Acquire(ctx))
+	assert.ErrorIs(t, first.Renew(ctx), lock.ErrLost)
+	assert.ErrorIs(t, first.Acquire(ctx), lock.ErrHeld)
+	assert.Nil(t, second.Release(ctx))
+}
+
+func TestRunAsLeader(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	var leaders, runs atomic.Int32
+	wg := sync.WaitGroup{}
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			candidate := lock.New(proxy, "memory-container", "locks/leader", lock.Options{TTL: 60 * time.Millisecond})
+			err := lock.RunAsLeader(ctx, candidate, func(ctx context.Context) error {
+				assert.Equal(t, int32(1), leaders.Add(1))
+				// longer than the TTL, so the lock has to be renewed
+				time.Sleep(100 * time.Millisecond)
+				assert.Nil(t, ctx.Err())
+				leaders.Add(-1)
+				runs.Add(1)
+				return nil
+			})
+			assert.Nil(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(3), runs.Load())
+}
+
+func TestRunAsLeaderLost(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	leader := lock.New(proxy, "memory-container", "locks/leader", lock.Options{TTL: 60 * time.Millisecond})
+	elected := make(chan struct{})
+	result := make(chan error)
+	go func() {
+		result <- lock.RunAsLeader(ctx, leader, func(ctx context.Context) error {
+			close(elected)
+			<-ctx.Done()
+			return nil
+		})
+	}()
+	<-elected
+	// another owner takes the lock from under the leader
+	_, err := proxy.UploadFileFromString(ctx, "memory-container", "locks/leader", nil, "{}")
+	assert.Nil(t, err)
+	select {
+	case err = <-result:
+		assert.ErrorIs(t, err, lock.ErrLost)
+	case <-time.After(time.Second):
+		t.Fatal("the leader did not stop after losing the lock")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = lock.RunAsLeader(cancelled, lock.New(proxy, "memory-container", "locks/leader", lock.Options{}),
+		func(ctx context.Context) error { return nil })
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,750 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/fs"
+	"lib-cloud-proxy-go/storage"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func getInMemoryProxy(t *testing.T) storage.CloudStorageProxy {
+	proxy, err := storage.CloudStorageProxyFactory(storage.ProxyAuthHandlerInMemory{
+		Containers: []string{"memory-container"},
+	})
+	if err != nil {
+		printCloudError(err)
+		t.FailNow()
+	}
+	return proxy
+}
+
+func TestInMemoryUploadAndGetFile(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	metadata := map[string]string{
+		"Upload ID":      "1234567890",
+		"data_stream_id": "DAART",
+	}
+	_, err := proxy.UploadFileFromString(ctx, "memory-container", "testFolder/test.HL7", metadata, "MSH|^~\\&|")
+	assert.Nil(t, err)
+
+	cloudFile, err := proxy.GetFile(ctx, "memory-container", "testFolder/test.HL7")
+	assert.Nil(t, err)
+	assert.Equal(t, "MSH|^~\\&|", cloudFile.Content)
+	assert.Equal(t, "1234567890", cloudFile.Metadata["upload_id"])
+	assert.Equal(t, "DAART", cloudFile.Metadata["data_stream_id"])
+	assert.Equal(t, "9", cloudFile.Metadata["content_length"])
+	assert.NotEmpty(t, cloudFile.Metadata["last_modified"])
+
+	reader, err := proxy.GetFileContentAsInputStream(ctx, "memory-container", "testFolder/test.HL7")
+	assert.Nil(t, err)
+	content, _ := io.ReadAll(reader)
+	assert.Equal(t, "MSH|^~\\&|", string(content))
+
+	_, err = proxy.GetFile(ctx, "memory-container", "testFolder/missing.HL7")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = proxy.Exists(ctx, "missing-container", "testFolder/test.HL7")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = proxy.GetMetadata(ctx, "missing-container", "testFolder/test.HL7")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	exists, err := proxy.Exists(ctx, "memory-container", "testFolder/test.HL7")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	_, err = proxy.UploadFileFromString(ctx, "missing-container", "test.HL7", nil, "content")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, proxy.DeleteFile(ctx, "memory-container", "testFolder/test.HL7"))
+	assert.NotNil(t, proxy.DeleteFile(ctx, "memory-container", "testFolder/test.HL7"))
+	exists, err = proxy.Exists(ctx, "memory-container", "testFolder/test.HL7")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestInMemoryListFilesAndFolders(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	for _, name := range []string{"hl7_a/1.HL7", "hl7_a/2.HL7", "hl7_b/c/1.HL7", "hl7_top.HL7", "other/1.HL7", "top.HL7"} {
+		_, err := proxy.UploadFileFromString(ctx, "memory-container", name, nil, name)
+		assert.Nil(t, err)
+	}
+
+	folders, err := proxy.ListFolders(ctx, "memory-container", 10, "hl7_")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hl7_a/", "hl7_b/"}, folders)
+
+	folders, err = proxy.ListFolders(ctx, "memory-container", 1, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hl7_a/"}, folders)
+
+	files, err := proxy.ListFiles(ctx, "memory-container", 0, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hl7_top.HL7", "top.HL7"}, files)
+
+	files, err = proxy.ListFiles(ctx, "memory-container", 10, "hl7_a/")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hl7_a/1.HL7", "hl7_a/2.HL7"}, files)
+
+	_, err = proxy.ListFiles(ctx, "missing-container", 10, "")
+	assert.NotNil(t, err)
+}
+
+func TestInMemoryListObjects(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	_, err := proxy.UploadFileFromString(ctx, "memory-container", "hl7/1.HL7", map[string]string{"upload_id": "1"}, "same")
+	assert.Nil(t, err)
+	_, err = proxy.UploadFileFromString(ctx, "memory-container", "hl7/2.HL7", nil, "same")
+	assert.Nil(t, err)
+	_, err = proxy.UploadFileFromString(ctx, "memory-container", "hl7/nested/3.HL7", nil, "other")
+	assert.Nil(t, err)
+
+	objects, err := proxy.ListObjects(ctx, "memory-container", 0, "hl7/", true)
+	assert.Nil(t, err)
+	if !assert.Len(t, objects, 2) {
+		return
+	}
+	assert.Equal(t, "hl7/1.HL7", objects[0].Name)
+	assert.Equal(t, int64(4), objects[0].Size)
+	assert.Equal(t, map[string]string{"upload_id": "1"}, objects[0].Metadata)
+	// identical content has an identical ETag
+	assert.Equal(t, objects[0].ETag, objects[1].ETag)
+
+	_, err = proxy.ListObjects(ctx, "missing-container", 10, "", false)
+	assert.NotNil(t, err)
+}
+
+func TestInMemoryListObjectsPage(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	for i := 0; i < 25; i++ {
+		name := fmt.Sprintf("batch/%02d.HL7", i)
+		_, err := proxy.UploadFileFromString(ctx, "memory-container", name, nil, name)
+		assert.Nil(t, err)
+	}
+
+	// a listing resumed from a saved token continues where it stopped, even after new files arrive
+	options := storage.ListOptions{Prefix: "batch/", PageSize: 10}
+	pages := 0
+	var token string
+	for page, err := range storage.Pages(ctx, proxy, "memory-container", options) {
+		assert.Nil(t, err)
+		pages++
+		token = page.ContinuationToken
+		break
+	}
+	assert.Equal(t, 1, pages)
+	_, err := proxy.UploadFileFromString(ctx, "memory-container", "batch/00a.HL7", nil, "late")
+	assert.Nil(t, err)
+	options.PageToken = token
+	names := make([]string, 0)
+	for object, err := range storage.Objects(ctx, proxy, "memory-container", options) {
+		assert.Nil(t, err)
+		names = append(names, object.Name)
+	}
+	assert.Len(t, names, 15)
+	assert.Equal(t, "batch/10.HL7", names[0])
+}
+
+func TestInMemoryFindFiles(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	files := map[string]string{
+		"hl7_lab/2024/01/a.HL7":  "a",
+		"hl7_lab/2024/02/b.HL7":  "bbbb",
+		"hl7_lab/2024/c.HL7":     "cc",
+		"hl7_lab/2024/c.csv":     "c",
+		"hl7_lab/2023/01/d.HL7":  "d",
+		"hl7_elr/2024/e.HL7":     "eee",
+		"other/2024/01/f.HL7":    "f",
+		"hl7_top/2024/readme.md": "",
+	}
+	for name, content := range files {
+		_, err := proxy.UploadFileFromString(ctx, "memory-container", name, nil, content)
+		assert.Nil(t, err)
+	}
+	names := func(objects []storage.ObjectInfo) []string {
+		result := make([]string, len(objects))
+		for i, object := range objects {
+			result[i] = object.Name
+		}
+		return result
+	}
+
+	found, err := storage.FindFiles(ctx, proxy, "memory-container", storage.FileFilter{Glob: "hl7_*/2024/**/*.HL7"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hl7_elr/2024/e.HL7", "hl7_lab/2024/01/a.HL7", "hl7_lab/2024/02/b.HL7", "hl7_lab/2024/c.HL7"}, names(found))
+
+	found, err = storage.FindFiles(ctx, proxy, "memory-container", storage.FileFilter{
+		Prefix: "hl7_lab/", Glob: "*/2024/*/*", MinSize: 2, SortBy: storage.SortBySize, Descending: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hl7_lab/2024/02/b.HL7"}, names(found))
+
+	found, err = storage.FindFiles(ctx, proxy, "memory-container", storage.FileFilter{
+		Regex: regexp.MustCompile(`/20(23|24)/0[12]/`), Suffix: ".HL7", MaxSize: 1, SortBy: storage.SortBySize})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hl7_lab/2023/01/d.HL7", "hl7_lab/2024/01/a.HL7", "other/2024/01/f.HL7"}, names(found))
+
+	found, err = storage.FindFiles(ctx, proxy, "memory-container", storage.FileFilter{Prefix: "other/", Glob: "hl7_*/**"})
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+	_, err = storage.FindFiles(ctx, proxy, "memory-container", storage.FileFilter{Glob: "hl7_[/*.HL7"})
+	assert.NotNil(t, err)
+
+	walked := make([]string, 0)
+	err = storage.Walk(ctx, proxy, "memory-container", "hl7_lab/", func(object storage.ObjectInfo) error {
+		walked = append(walked, object.Name)
+		if len(walked) == 3 {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hl7_lab/2023/01/d.HL7", "hl7_lab/2024/01/a.HL7", "hl7_lab/2024/02/b.HL7"}, walked)
+}
+
+func TestInMemoryDeleteFiles(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	for _, name := range []string{"batch/1.HL7", "batch/2.HL7", "keep.HL7"} {
+		_, err := proxy.UploadFileFromString(ctx, "memory-container", name, nil, name)
+		assert.Nil(t, err)
+	}
+
+	// files that are already gone count as deleted, so a batch can be retried
+	results, err := proxy.DeleteFiles(ctx, "memory-container", []string{"batch/2.HL7", "batch/1.HL7", "batch/3.HL7"})
+	assert.Nil(t, err)
+	assert.Equal(t, []storage.FileResult{{Name: "batch/2.HL7"}, {Name: "batch/1.HL7"}, {Name: "batch/3.HL7"}}, results)
+	files, _ := proxy.ListFiles(ctx, "memory-container", 10, "")
+	assert.Equal(t, []string{"keep.HL7"}, files)
+
+	_, err = proxy.DeleteFiles(ctx, "missing-container", []string{"keep.HL7"})
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestInMemoryMovePrefix(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	assert.Nil(t, proxy.CreateContainerIfNotExists(ctx, "memory-archive"))
+	for i := 0; i < 3; i++ {
+		_, err := proxy.UploadFileFromString(ctx, "memory-container", fmt.Sprintf("incoming/%d.HL7", i), nil, "MSH")
+		assert.Nil(t, err)
+	}
+
+	results, err := proxy.MovePrefix(ctx, "memory-container", "incoming/", "memory-archive", "2024/", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []storage.FileResult{{Name: "incoming/0.HL7"}, {Name: "incoming/1.HL7"}, {Name: "incoming/2.HL7"}}, results)
+	files, err := proxy.ListFiles(ctx, "memory-archive", 10, "2024/")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2024/0.HL7", "2024/1.HL7", "2024/2.HL7"}, files)
+	files, err = proxy.ListFiles(ctx, "memory-container", 10, "incoming/")
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+
+	// the file at the destination may not be the one that was moved
+	err = proxy.MoveFile(ctx, "memory-container", "incoming/0.HL7", "memory-archive", "2024/0.HL7")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	err = proxy.MoveFile(ctx, "memory-container", "incoming/0.HL7", "memory-archive", "2024/9.HL7")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestInMemoryContentHeaders(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	metadata := map[string]string{
+		"Content-Type":                     "application/hl7-v2",
+		storage.MetadataContentDisposition: `attachment; filename="test.HL7"`,
+		"data_stream_id":                   "DAART",
+	}
+	_, err := proxy.UploadFileFromString(ctx, "memory-container", "test.HL7", metadata, "MSH|^~\\&|")
+	assert.Nil(t, err)
+
+	cloudFile, err := proxy.GetFile(ctx, "memory-container", "test.HL7")
+	assert.Nil(t, err)
+	assert.Equal(t, "application/hl7-v2", cloudFile.Metadata[storage.MetadataContentType])
+	assert.Equal(t, `attachment; filename="test.HL7"`, cloudFile.Metadata[storage.MetadataContentDisposition])
+	assert.NotContains(t, cloudFile.Metadata, storage.MetadataCacheControl)
+	objects, err := proxy.ListObjects(ctx, "memory-container", 10, "", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "application/hl7-v2", objects[0].ContentType)
+	// the headers are not user metadata
+	assert.Equal(t, map[string]string{"data_stream_id": "DAART"}, objects[0].Metadata)
+
+	localProxy := getLocalProxy(t)
+	err = localProxy.CopyFileFromRemoteStorage(ctx, "memory-container", "test.HL7", "local-container", "test.HL7",
+		&proxy, 1)
+	assert.Nil(t, err)
+	copied, err := localProxy.GetMetadata(ctx, "local-container", "test.HL7")
+	assert.Nil(t, err)
+	assert.Equal(t, "application/hl7-v2", copied[storage.MetadataContentType])
+	assert.Equal(t, `attachment; filename="test.HL7"`, copied[storage.MetadataContentDisposition])
+	assert.Equal(t, "DAART", copied["data_stream_id"])
+}
+
+func TestInMemoryTags(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	for _, name := range []string{"hl7/1.HL7", "hl7/2.HL7", "hl7/nested/3.HL7", "other/4.HL7"} {
+		_, err := proxy.UploadFileFromString(ctx, "memory-container", name, nil, name)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, proxy.SetTags(ctx, "memory-container", "hl7/1.HL7", map[string]string{"status": "validated", "jurisdiction": "MN"}))
+	assert.Nil(t, proxy.SetTags(ctx, "memory-container", "hl7/2.HL7", map[string]string{"status": "validated", "jurisdiction": "WI"}))
+	assert.Nil(t, proxy.SetTags(ctx, "memory-container", "hl7/nested/3.HL7", map[string]string{"status": "validated", "jurisdiction": "MN"}))
+	assert.Nil(t, proxy.SetTags(ctx, "memory-container", "other/4.HL7", map[string]string{"status": "validated", "jurisdiction": "MN"}))
+
+	tags, err := proxy.GetTags(ctx, "memory-container", "hl7/1.HL7")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"status": "validated", "jurisdiction": "MN"}, tags)
+	// tags do not change the content or metadata
+	content, err := proxy.GetFileContentAsString(ctx, "memory-container", "hl7/1.HL7")
+	assert.Nil(t, err)
+	assert.Equal(t, "hl7/1.HL7", content)
+
+	found, err := proxy.FindFilesByTags(ctx, "memory-container", "hl7/", map[string]string{"status": "validated", "jurisdiction": "MN"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hl7/1.HL7", "hl7/nested/3.HL7"}, found)
+	found, err = proxy.FindFilesByTags(ctx, "memory-container", "", map[string]string{"jurisdiction": "WI"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hl7/2.HL7"}, found)
+
+	// uploading replaces the tags along with the content
+	_, err = proxy.UploadFileFromString(ctx, "memory-container", "hl7/2.HL7", nil, "new")
+	assert.Nil(t, err)
+	tags, err = proxy.GetTags(ctx, "memory-container", "hl7/2.HL7")
+	assert.Nil(t, err)
+	assert.Empty(t, tags)
+
+	_, err = proxy.FindFilesByTags(ctx, "memory-container", "", nil)
+	assert.NotNil(t, err)
+	_, err = proxy.GetTags(ctx, "memory-container", "missing.HL7")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestInMemoryVersions(t *testing.T) {
+	proxy, err := storage.CloudStorageProxyFactory(storage.ProxyAuthHandlerInMemory{
+		Containers: []string{"memory-container"},
+		Versioning: true,
+	})
+	if err != nil {
+		printCloudError(err)
+		t.FailNow()
+	}
+	ctx := context.Background()
+	_, err = proxy.UploadFileFromString(ctx, "memory-container", "versioned.txt", nil, "first")
+	assert.Nil(t, err)
+	_, err = proxy.UploadFileFromString(ctx, "memory-container", "versioned.txt", nil, "second")
+	assert.Nil(t, err)
+	_, err = proxy.UploadFileFromString(ctx, "memory-container", "versioned.txt.bak", nil, "other file")
+	assert.Nil(t, err)
+
+	versions, err := proxy.ListFileVersions(ctx, "memory-container", "versioned.txt")
+	assert.Nil(t, err)
+	assert.Len(t, versions, 2)
+	assert.True(t, versions[0].IsCurrent)
+	assert.False(t, versions[1].IsCurrent)
+	first := versions[1].VersionID
+
+	cloudFile, err := proxy.GetFile(ctx, "memory-container", "versioned.txt", storage.WithVersion(first))
+	assert.Nil(t, err)
+	assert.Equal(t, "first", cloudFile.Content)
+	assert.Equal(t, first, cloudFile.Metadata["version_id"])
+	reader, err := proxy.GetFileContentAsInputStream(ctx, "memory-container", "versioned.txt", storage.WithVersion(first))
+	assert.Nil(t, err)
+	content, _ := io.ReadAll(reader)
+	assert.Equal(t, "first", string(content))
+
+	// deleting leaves a delete marker, and the earlier versions can still be read and restored
+	assert.Nil(t, proxy.DeleteFile(ctx, "memory-container", "versioned.txt"))
+	exists, err := proxy.Exists(ctx, "memory-container", "versioned.txt")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	versions, err = proxy.ListFileVersions(ctx, "memory-container", "versioned.txt")
+	assert.Nil(t, err)
+	assert.Len(t, versions, 3)
+	assert.True(t, versions[0].IsDeleteMarker)
+
+	assert.Nil(t, proxy.RestoreFileVersion(ctx, "memory-container", "versioned.txt", first))
+	restored, err := proxy.GetFileContentAsString(ctx, "memory-container", "versioned.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "first", restored)
+	versions, err = proxy.ListFileVersions(ctx, "memory-container", "versioned.txt")
+	assert.Nil(t, err)
+	assert.Len(t, versions, 4)
+
+	// deleting a version removes it permanently
+	assert.Nil(t, proxy.DeleteFile(ctx, "memory-container", "versioned.txt", storage.WithVersion(first)))
+	_, err = proxy.GetFile(ctx, "memory-container", "versioned.txt", storage.WithVersion(first))
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = proxy.ListFileVersions(ctx, "memory-container", "missing.txt")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// without versioning, versions are not supported
+	_, err = getInMemoryProxy(t).ListFileVersions(ctx, "memory-container", "versioned.txt")
+	assert.ErrorIs(t, err, storage.ErrNotSupported)
+}
+
+func TestInMemoryUndelete(t *testing.T) {
+	proxy, err := storage.CloudStorageProxyFactory(storage.ProxyAuthHandlerInMemory{
+		Containers: []string{"memory-container"},
+		Versioning: true,
+	})
+	if err != nil {
+		printCloudError(err)
+		t.FailNow()
+	}
+	ctx := context.Background()
+	for _, name := range []string{"hl7/1.HL7", "hl7/2.HL7", "other/3.HL7"} {
+		_, err = proxy.UploadFileFromString(ctx, "memory-container", name, nil, name)
+		assert.Nil(t, err)
+	}
+	_, err = proxy.UploadFileFromString(ctx, "memory-container", "hl7/1.HL7", nil, "second version")
+	assert.Nil(t, err)
+	for _, name := range []string{"hl7/1.HL7", "hl7/2.HL7", "other/3.HL7"} {
+		assert.Nil(t, proxy.DeleteFile(ctx, "memory-container", name))
+	}
+	// uploaded again since it was deleted
+	_, err = proxy.UploadFileFromString(ctx, "memory-container", "hl7/2.HL7", nil, "replaced")
+	assert.Nil(t, err)
+
+	deleted, err := proxy.ListDeletedFiles(ctx, "memory-container", "hl7/")
+	assert.Nil(t, err)
+	assert.Len(t, deleted, 1)
+	assert.Equal(t, "hl7/1.HL7", deleted[0].Name)
+	assert.Equal(t, int64(len("second version")), deleted[0].Size)
+	assert.False(t, deleted[0].DeletedTime.IsZero())
+
+	assert.Nil(t, proxy.UndeleteFile(ctx, "memory-container", "hl7/1.HL7"))
+	content, err := proxy.GetFileContentAsString(ctx, "memory-container", "hl7/1.HL7")
+	assert.Nil(t, err)
+	assert.Equal(t, "second version", content)
+	// undeleting a file that is not deleted leaves it as it is
+	assert.Nil(t, proxy.UndeleteFile(ctx, "memory-container", "hl7/2.HL7"))
+	content, err = proxy.GetFileContentAsString(ctx, "memory-container", "hl7/2.HL7")
+	assert.Nil(t, err)
+	assert.Equal(t, "replaced", content)
+	err = proxy.UndeleteFile(ctx, "memory-container", "missing.HL7")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	deleted, err = proxy.ListDeletedFiles(ctx, "memory-container", "")
+	assert.Nil(t, err)
+	assert.Len(t, deleted, 1)
+	assert.Equal(t, "other/3.HL7", deleted[0].Name)
+
+	// without versioning, deleted files are gone
+	_, err = getInMemoryProxy(t).ListDeletedFiles(ctx, "memory-container", "")
+	assert.ErrorIs(t, err, storage.ErrNotSupported)
+}
+
+func TestInMemoryConditionalWrites(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	etag, err := proxy.UploadFileFromString(ctx, "memory-container", "config/routes.json", nil, "first",
+		storage.IfNoneMatch("*"))
+	assert.Nil(t, err)
+	assert.NotEmpty(t, etag)
+	metadata, err := proxy.GetMetadata(ctx, "memory-container", "config/routes.json")
+	assert.Nil(t, err)
+	assert.Equal(t, etag, metadata["etag"])
+
+	// create-only fails once the file exists
+	_, err = proxy.UploadFileFromString(ctx, "memory-container", "config/routes.json", nil, "other",
+		storage.IfNoneMatch("*"))
+	assert.ErrorIs(t, err, storage.ErrPreconditionFailed)
+
+	updated, err := proxy.UploadFileFromInputStream(ctx, "memory-container", "config/routes.json", nil,
+		strings.NewReader("second"), 6, 1, storage.IfMatch(etag))
+	assert.Nil(t, err)
+	assert.NotEqual(t, etag, updated)
+	// the first ETag is stale now
+	_, err = proxy.UploadFileFromString(ctx, "memory-container", "config/routes.json", nil, "lost update",
+		storage.IfMatch(etag))
+	assert.ErrorIs(t, err, storage.ErrPreconditionFailed)
+	err = proxy.DeleteFile(ctx, "memory-container", "config/routes.json", storage.IfMatch(etag))
+	assert.ErrorIs(t, err, storage.ErrPreconditionFailed)
+	content, err := proxy.GetFileContentAsString(ctx, "memory-container", "config/routes.json")
+	assert.Nil(t, err)
+	assert.Equal(t, "second", content)
+
+	assert.Nil(t, proxy.DeleteFile(ctx, "memory-container", "config/routes.json", storage.IfMatch(updated)))
+	_, err = proxy.UploadFileFromString(ctx, "memory-container", "config/routes.json", nil, "missing",
+		storage.IfMatch(updated))
+	assert.ErrorIs(t, err, storage.ErrPreconditionFailed)
+	// IfMatch fails the same way on a file that is missing, rather than with ErrNotFound
+	err = proxy.DeleteFile(ctx, "memory-container", "config/routes.json", storage.IfMatch(updated))
+	assert.ErrorIs(t, err, storage.ErrPreconditionFailed)
+	_, err = proxy.GetFileRange(ctx, "memory-container", "config/routes.json", 0, 1, storage.IfMatch(updated))
+	assert.ErrorIs(t, err, storage.ErrPreconditionFailed)
+}
+
+func TestInMemoryFileRange(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	_, err := proxy.UploadFileFromString(ctx, "memory-container", "test.HL7", nil, "MSH|^~\\&|DAART")
+	assert.Nil(t, err)
+
+	for _, tc := range []struct {
+		offset, length int64
+		expected       string
+	}{
+		{0, 3, "MSH"},
+		{4, 4, "^~\\&"},
+		{9, -1, "DAART"},
+		{9, 100, "DAART"},
+	} {
+		body, err := proxy.GetFileRange(ctx, "memory-container", "test.HL7", tc.offset, tc.length)
+		assert.Nil(t, err)
+		content, err := io.ReadAll(body)
+		assert.Nil(t, err)
+		assert.Nil(t, body.Close())
+		assert.Equal(t, tc.expected, string(content))
+	}
+	_, err = proxy.GetFileRange(ctx, "memory-container", "test.HL7", 14, 1)
+	assert.NotNil(t, err)
+	_, err = proxy.GetFileRange(ctx, "memory-container", "test.HL7", -1, 1)
+	assert.NotNil(t, err)
+	_, err = proxy.GetFileRange(ctx, "memory-container", "missing.HL7", 0, 1)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestInMemoryOpenReader(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	// larger than the read-ahead buffer, so that reads cross it
+	content := make([]byte, 3*1024*1024+17)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	_, err := proxy.UploadFileFromInputStream(ctx, "memory-container", "large.bin", nil, bytes.NewReader(content),
+		int64(len(content)), 1)
+	assert.Nil(t, err)
+
+	reader, err := proxy.OpenReader(ctx, "memory-container", "large.bin")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), reader.Size())
+	read, err := io.ReadAll(io.LimitReader(reader, 1024*1024+5))
+	assert.Nil(t, err)
+	assert.Equal(t, content[:1024*1024+5], read)
+	part := make([]byte, 100)
+	n, err := reader.ReadAt(part, 2*1024*1024-50)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, n)
+	assert.Equal(t, content[2*1024*1024-50:2*1024*1024+50], part)
+	// the offset of Read is not moved by ReadAt
+	n, err = reader.Read(part)
+	assert.Nil(t, err)
+	assert.Equal(t, content[1024*1024+5:1024*1024+5+n], part[:n])
+
+	position, err := reader.Seek(-10, io.SeekEnd)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)-10), position)
+	n, err = reader.ReadAt(part, position)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, io.EOF, err)
+	rest, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, content[len(content)-10:], rest)
+	assert.Nil(t, reader.Close())
+	_, err = reader.Read(part)
+	assert.ErrorIs(t, err, fs.ErrClosed)
+
+	// archive/zip reads the directory at the end of the file and then each file
+	archive := bytes.Buffer{}
+	zipWriter := zip.NewWriter(&archive)
+	for _, name := range []string{"hl7/1.HL7", "hl7/2.HL7"} {
+		file, err := zipWriter.Create(name)
+		assert.Nil(t, err)
+		_, err = file.Write([]byte(strings.Repeat(name, 1000)))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, zipWriter.Close())
+	_, err = proxy.UploadFileFromString(ctx, "memory-container", "batch.zip", nil, archive.String())
+	assert.Nil(t, err)
+	reader, err = proxy.OpenReader(ctx, "memory-container", "batch.zip")
+	assert.Nil(t, err)
+	defer reader.Close()
+	zipReader, err := zip.NewReader(reader, reader.Size())
+	assert.Nil(t, err)
+	assert.Len(t, zipReader.File, 2)
+	for _, file := range zipReader.File {
+		fileReader, err := file.Open()
+		assert.Nil(t, err)
+		unzipped, err := io.ReadAll(fileReader)
+		assert.Nil(t, err)
+		assert.Equal(t, strings.Repeat(file.Name, 1000), string(unzipped))
+	}
+
+	// concurrent reads at different offsets
+	reader, err = proxy.OpenReader(ctx, "memory-container", "large.bin")
+	assert.Nil(t, err)
+	wg := sync.WaitGroup{}
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			offset := int64(i) * 400 * 1024
+			part := make([]byte, 1000)
+			_, err := reader.ReadAt(part, offset)
+			assert.Nil(t, err)
+			assert.Equal(t, content[offset:offset+1000], part)
+		}()
+	}
+	wg.Wait()
+	assert.Nil(t, reader.Close())
+
+	// a file that is overwritten is not read from two versions
+	reader, err = proxy.OpenReader(ctx, "memory-container", "large.bin")
+	assert.Nil(t, err)
+	_, err = reader.Read(part)
+	assert.Nil(t, err)
+	_, err = proxy.UploadFileFromString(ctx, "memory-container", "large.bin", nil, "replaced")
+	assert.Nil(t, err)
+	_, err = reader.ReadAt(part, 2*1024*1024)
+	assert.ErrorIs(t, err, storage.ErrPreconditionFailed)
+	assert.Nil(t, reader.Close())
+
+	_, err = proxy.OpenReader(ctx, "memory-container", "missing.zip")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestInMemoryOpenWriter(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	content := strings.Repeat("MSH|^~\\&|DAART\r", 100)
+	writer, err := proxy.OpenWriter(ctx, "memory-container", "hl7/batch.HL7", storage.WriterOptions{
+		Metadata:    map[string]string{"data_stream_id": "DAART", storage.MetadataContentType: "text/plain"},
+		PartSize:    64,
+		Concurrency: 3,
+	})
+	assert.Nil(t, err)
+	// writes that do not line up with the parts
+	for start := 0; start < len(content); start += 37 {
+		n, err := writer.Write([]byte(content[min(start, len(content)):min(start+37, len(content))]))
+		assert.Nil(t, err)
+		assert.Equal(t, min(37, len(content)-start), n)
+	}
+	assert.Nil(t, writer.Close())
+	assert.NotEmpty(t, writer.ETag())
+
+	file, err := proxy.GetFile(ctx, "memory-container", "hl7/batch.HL7")
+	assert.Nil(t, err)
+	assert.Equal(t, content, file.Content)
+	assert.Equal(t, writer.ETag(), file.Metadata["etag"])
+	assert.Equal(t, "DAART", file.Metadata["data_stream_id"])
+	assert.Equal(t, "text/plain", file.Metadata[storage.MetadataContentType])
+	_, err = writer.Write([]byte("more"))
+	assert.NotNil(t, err)
+
+	writer, err = proxy.OpenWriter(ctx, "memory-container", "empty.txt", storage.WriterOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+	content, err = proxy.GetFileContentAsString(ctx, "memory-container", "empty.txt")
+	assert.Nil(t, err)
+	assert.Empty(t, content)
+
+	// conditions are checked when the file is committed
+	writer, err = proxy.OpenWriter(ctx, "memory-container", "hl7/batch.HL7", storage.WriterOptions{
+		FileOptions: []storage.FileOption{storage.IfNoneMatch("*")},
+	})
+	assert.Nil(t, err)
+	_, err = writer.Write([]byte("replaced"))
+	assert.Nil(t, err)
+	assert.ErrorIs(t, writer.Close(), storage.ErrPreconditionFailed)
+	assert.Empty(t, writer.ETag())
+
+	_, err = proxy.OpenWriter(ctx, "missing-container", "file.txt", storage.WriterOptions{})
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestInMemoryOpenWriterGrowth(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	// 20000 parts of 1 byte would be more than the 10000 parts allowed, but the parts grow with the file
+	content := strings.Repeat("0123456789", 2000)
+	writer, err := proxy.OpenWriter(ctx, "memory-container", "large.txt", storage.WriterOptions{PartSize: 1})
+	assert.Nil(t, err)
+	n, err := writer.Write([]byte(content))
+	assert.Nil(t, err)
+	assert.Equal(t, len(content), n)
+	assert.Nil(t, writer.Close())
+	read, err := proxy.GetFileContentAsString(ctx, "memory-container", "large.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, content, read)
+
+	// a stream of unknown size
+	_, err = proxy.UploadFileFromInputStream(ctx, "memory-container", "stream.txt", nil, strings.NewReader(content), -1, 0)
+	assert.Nil(t, err)
+	read, err = proxy.GetFileContentAsString(ctx, "memory-container", "stream.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, content, read)
+}
+
+func TestInMemoryOpenWriterCancel(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	writer, err := proxy.OpenWriter(ctx, "memory-container", "hl7/batch.HL7", storage.WriterOptions{PartSize: 16})
+	assert.Nil(t, err)
+	_, err = writer.Write([]byte(strings.Repeat("MSH|^~\\&|DAART\r", 10)))
+	assert.Nil(t, err)
+	cancel()
+
+	_, err = writer.Write([]byte("MSH"))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, writer.Close(), context.Canceled)
+	exists, err := proxy.Exists(context.Background(), "memory-container", "hl7/batch.HL7")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestInMemoryConcurrentUploads(t *testing.T) {
+	proxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("concurrent/%02d.txt", i)
+			_, err := proxy.UploadFileFromInputStream(ctx, "memory-container", name, nil,
+				strings.NewReader(name), int64(len(name)), 1)
+			assert.Nil(t, err)
+			_, err = proxy.ListFiles(ctx, "memory-container", 100, "concurrent/")
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+	files, err := proxy.ListFiles(ctx, "memory-container", 100, "concurrent/")
+	assert.Nil(t, err)
+	assert.Len(t, files, 50)
+}
+
+func TestInMemoryCopyToLocal(t *testing.T) {
+	memoryProxy := getInMemoryProxy(t)
+	localProxy := getLocalProxy(t)
+	ctx := context.Background()
+	_, err := memoryProxy.UploadFileFromString(ctx, "memory-container", "source.txt",
+		map[string]string{"data_stream_id": "DAART"}, "copy me")
+	assert.Nil(t, err)
+
+	err = localProxy.CopyFileFromRemoteStorage(ctx, "memory-container", "source.txt",
+		"local-container", "dest.txt", &memoryProxy, 1)
+	assert.Nil(t, err)
+	metadata, err := localProxy.GetMetadata(ctx, "local-container", "dest.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "DAART", metadata["data_stream_id"])
+	assert.Equal(t, "7", metadata["content_length"])
+
+	err = memoryProxy.CopyFileFromRemoteStorage(ctx, "local-container", "dest.txt",
+		"memory-container", "round-trip.txt", &localProxy, 1)
+	assert.Nil(t, err)
+	content, err := memoryProxy.GetFileContentAsString(ctx, "memory-container", "round-trip.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "copy me", content)
+}
@@ -0,0 +1,251 @@
+package test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"lib-cloud-proxy-go/storage"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+const sftpContainer = "inbound/lab"
+
+// startSFTPServer serves t.TempDir() over SFTP on a random local port, accepting the password
+// "sftp-password" and the returned client key. It returns the served directory, the port, the server's host key
+// and the client key
+func startSFTPServer(t *testing.T) (string, int, string, ed25519.PrivateKey) {
+	rootDir := t.TempDir()
+	_, hostPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPrivateKey)
+	assert.Nil(t, err)
+	clientPublicKey, clientPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	authorizedKey, err := ssh.NewPublicKey(clientPublicKey)
+	assert.Nil(t, err)
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) == "sftp-password" {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTPConnection(conn, config, rootDir)
+		}
+	}()
+	return rootDir, listener.Addr().(*net.TCPAddr).Port, string(ssh.MarshalAuthorizedKey(hostSigner.PublicKey())),
+		clientPrivateKey
+}
+
+func serveSFTPConnection(conn net.Conn, config *ssh.ServerConfig, rootDir string) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for request := range channelRequests {
+				// the payload is the length-prefixed subsystem name
+				isSFTP := request.Type == "subsystem" && string(request.Payload[4:]) == "sftp"
+				_ = request.Reply(isSFTP, nil)
+			}
+		}()
+		go func() {
+			server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(rootDir))
+			if err == nil {
+				_ = server.Serve()
+			}
+			_ = channel.Close()
+		}()
+	}
+}
+
+func getSFTPProxy(t *testing.T) (storage.CloudStorageProxy, string) {
+	rootDir, port, hostKey, _ := startSFTPServer(t)
+	proxy, err := storage.CloudStorageProxyFactory(storage.ProxyAuthHandlerSFTPPassword{
+		Host:     "127.0.0.1",
+		Port:     port,
+		Username: "lab",
+		Password: "sftp-password",
+		HostKey:  hostKey,
+	})
+	if err != nil {
+		printCloudError(err)
+		t.FailNow()
+	}
+	t.Cleanup(func() { _ = proxy.(*storage.SFTPCloudStorageProxy).Close() })
+	err = proxy.CreateContainerIfNotExists(context.Background(), sftpContainer)
+	printCloudError(err)
+	assert.Nil(t, err)
+	return proxy, rootDir
+}
+
+func TestSFTPUploadAndGetFile(t *testing.T) {
+	sftpProxy, rootDir := getSFTPProxy(t)
+	ctx := context.Background()
+	content, err := os.ReadFile("test.HL7")
+	assert.Nil(t, err)
+
+	_, err = sftpProxy.UploadFileFromString(ctx, sftpContainer, "2024/test-upload.HL7", nil, string(content))
+	printCloudError(err)
+	assert.Nil(t, err)
+	onDisk, err := os.ReadFile(filepath.Join(rootDir, "inbound", "lab", "2024", "test-upload.HL7"))
+	assert.Nil(t, err)
+	assert.Equal(t, content, onDisk)
+
+	cloudFile, err := sftpProxy.GetFile(ctx, sftpContainer, "2024/test-upload.HL7")
+	printCloudError(err)
+	assert.Equal(t, string(content), cloudFile.Content)
+	assert.Equal(t, strconv.Itoa(len(content)), cloudFile.Metadata["content_length"])
+
+	largeContent, err := sftpProxy.GetLargeFileContentAsByteArray(ctx, sftpContainer, "2024/test-upload.HL7", 0, 4)
+	printCloudError(err)
+	assert.Equal(t, content, largeContent)
+
+	// uploads replace existing files
+	_, err = sftpProxy.UploadFileFromString(ctx, sftpContainer, "2024/test-upload.HL7", nil, "replaced")
+	printCloudError(err)
+	replaced, err := sftpProxy.GetFileContentAsString(ctx, sftpContainer, "2024/test-upload.HL7")
+	assert.Equal(t, "replaced", replaced)
+	err = sftpProxy.SetTags(ctx, sftpContainer, "2024/test-upload.HL7", map[string]string{"status": "validated"})
+	assert.ErrorIs(t, err, storage.ErrNotSupported)
+
+	err = sftpProxy.MoveFile(ctx, sftpContainer, "2024/test-upload.HL7", sftpContainer, "processed/test-upload.HL7")
+	printCloudError(err)
+	assert.Nil(t, err)
+	moved, err := sftpProxy.GetFileContentAsString(ctx, sftpContainer, "processed/test-upload.HL7")
+	assert.Equal(t, "replaced", moved)
+	err = sftpProxy.MoveFile(ctx, sftpContainer, "2024/test-upload.HL7", sftpContainer, "processed/test-upload.HL7")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.Nil(t, sftpProxy.MoveFile(ctx, sftpContainer, "processed/test-upload.HL7", sftpContainer, "2024/test-upload.HL7"))
+
+	err = sftpProxy.DeleteFile(ctx, sftpContainer, "2024/test-upload.HL7")
+	printCloudError(err)
+	assert.Nil(t, err)
+	_, err = sftpProxy.GetFile(ctx, sftpContainer, "2024/test-upload.HL7")
+	assert.NotNil(t, err)
+	assert.NotNil(t, sftpProxy.DeleteFile(ctx, sftpContainer, "2024/test-upload.HL7"))
+}
+
+func TestSFTPListFilesAndFolders(t *testing.T) {
+	sftpProxy, rootDir := getSFTPProxy(t)
+	ctx := context.Background()
+	for _, name := range []string{"a.HL7", "b.HL7", "2024/c.HL7", "2025/d.HL7"} {
+		_, err := sftpProxy.UploadFileFromString(ctx, sftpContainer, name, nil, name)
+		printCloudError(err)
+	}
+	// partial uploads in progress are never listed
+	err := os.WriteFile(filepath.Join(rootDir, "inbound", "lab", ".e.HL7.1234.partial"), nil, 0o644)
+	assert.Nil(t, err)
+
+	files, err := sftpProxy.ListFiles(ctx, sftpContainer, 10, "")
+	printCloudError(err)
+	assert.Equal(t, []string{"a.HL7", "b.HL7"}, files)
+	files, err = sftpProxy.ListFiles(ctx, sftpContainer, 1, "")
+	assert.Equal(t, []string{"a.HL7"}, files)
+	folders, err := sftpProxy.ListFolders(ctx, sftpContainer, 10, "20")
+	printCloudError(err)
+	assert.Equal(t, []string{"2024/", "2025/"}, folders)
+	files, err = sftpProxy.ListFiles(ctx, sftpContainer, 10, "2024/")
+	assert.Equal(t, []string{"2024/c.HL7"}, files)
+
+	page, err := sftpProxy.ListObjectsPage(ctx, sftpContainer, storage.ListOptions{Recursive: true, PageSize: 3})
+	printCloudError(err)
+	assert.Len(t, page.Objects, 3)
+	assert.Equal(t, "2024/c.HL7", page.Objects[0].Name)
+	page, err = sftpProxy.ListObjectsPage(ctx, sftpContainer, storage.ListOptions{
+		Recursive: true, PageSize: 3, PageToken: page.ContinuationToken})
+	assert.Nil(t, err)
+	if assert.Len(t, page.Objects, 1) {
+		assert.Equal(t, "b.HL7", page.Objects[0].Name)
+	}
+	assert.Empty(t, page.ContinuationToken)
+
+	_, err = sftpProxy.ListFiles(ctx, "outbound", 10, "")
+	assert.NotNil(t, err)
+}
+
+func TestSFTPPrivateKeyAndHostKey(t *testing.T) {
+	_, port, hostKey, clientKey := startSFTPServer(t)
+	block, err := ssh.MarshalPrivateKey(clientKey, "")
+	assert.Nil(t, err)
+	handler := storage.ProxyAuthHandlerSFTPPrivateKey{
+		Host:       "127.0.0.1",
+		Port:       port,
+		Username:   "lab",
+		PrivateKey: string(pem.EncodeToMemory(block)),
+		HostKey:    hostKey,
+	}
+	proxy, err := storage.CloudStorageProxyFactory(handler)
+	printCloudError(err)
+	assert.Nil(t, err)
+	_ = proxy.(*storage.SFTPCloudStorageProxy).Close()
+
+	// a host key is required unless verification is explicitly turned off
+	handler.HostKey = ""
+	_, err = storage.CloudStorageProxyFactory(handler)
+	assert.NotNil(t, err)
+	// and a server presenting a different key is rejected
+	otherPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	otherKey, err := ssh.NewPublicKey(otherPublicKey)
+	assert.Nil(t, err)
+	handler.HostKey = string(ssh.MarshalAuthorizedKey(otherKey))
+	_, err = storage.CloudStorageProxyFactory(handler)
+	assert.NotNil(t, err)
+}
+
+func TestSFTPCopyToInMemory(t *testing.T) {
+	sftpProxy, _ := getSFTPProxy(t)
+	memProxy := getInMemoryProxy(t)
+	ctx := context.Background()
+	_, err := sftpProxy.UploadFileFromString(ctx, sftpContainer, "test.HL7", nil, "MSH|^~\\&|")
+	printCloudError(err)
+
+	err = memProxy.CopyFileFromRemoteStorage(ctx, sftpContainer, "test.HL7", "memory-container", "lab/test.HL7",
+		&sftpProxy, 1)
+	printCloudError(err)
+	assert.Nil(t, err)
+	content, err := memProxy.GetFileContentAsString(ctx, "memory-container", "lab/test.HL7")
+	assert.Equal(t, "MSH|^~\\&|", content)
+
+	signedURL, err := sftpProxy.GetSourceBlobSignedURL(ctx, sftpContainer, "test.HL7")
+	printCloudError(err)
+	assert.Contains(t, signedURL, "sftp://lab@127.0.0.1:")
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"lib-cloud-proxy-go/secrets"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeParameterStore serves GetParameter and GetParametersByPath over the SSM JSON protocol,
+// returning one parameter per page so that paging is exercised
+type fakeParameterStore struct {
+	mutex      sync.Mutex
+	parameters map[string]string
+	calls      int
+}
+
+func (fake *fakeParameterStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.calls++
+	var input struct {
+		Name           string
+		Path           string
+		Recursive      bool
+		WithDecryption bool
+		NextToken      string
+	}
+	_ = json.NewDecoder(r.Body).Decode(&input)
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	switch r.Header.Get("X-Amz-Target") {
+	case "AmazonSSM.GetParameter":
+		value, ok := fake.parameters[input.Name]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ParameterNotFound","message":"not found"}`))
+			return
+		}
+		if !input.WithDecryption {
+			value = "encrypted"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"Parameter": map[string]interface{}{"Name": input.Name, "Type": "SecureString", "Value": value},
+		})
+	case "AmazonSSM.GetParametersByPath":
+		names := make([]string, 0)
+		for name := range fake.parameters {
+			if strings.HasPrefix(name, input.Path+"/") && (input.Recursive || !strings.Contains(name[len(input.Path)+1:], "/")) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		response := map[string]interface{}{"Parameters": []interface{}{}}
+		for i, name := range names {
+			if name > input.NextToken {
+				response["Parameters"] = []interface{}{map[string]interface{}{"Name": name, "Value": fake.parameters[name]}}
+				if i < len(names)-1 {
+					response["NextToken"] = name
+				}
+				break
+			}
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestParameterStoreGetSecret(t *testing.T) {
+	fake := &fakeParameterStore{parameters: map[string]string{
+		"/hl7/prod/db/password": "s3cr3t",
+		"/hl7/prod/api-key":     "abc123",
+		"/hl7/dev/api-key":      "dev",
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	t.Setenv("AWS_ENDPOINT_URL_SSM", server.URL)
+
+	ps, err := secrets.CloudSecretsProxyFactory(secrets.ProxyAuthHandlerAWSConfiguredIdentity{
+		AccessID:       "test",
+		AccessKey:      "test",
+		Region:         "us-east-1",
+		ParameterStore: true,
+	}, &secrets.CloudSecretsCacheOptions{
+		MaxEntries: 10,
+		TTL:        time.Minute * 10,
+	})
+	printCloudSecretsError(err)
+	if !assert.Nil(t, err) {
+		return
+	}
+	ctx := context.Background()
+
+	value, err := ps.GetSecret(ctx, "/hl7/prod/db/password")
+	printCloudSecretsError(err)
+	assert.Equal(t, "s3cr3t", value)
+	_, err = ps.GetSecret(ctx, "/hl7/prod/missing")
+	assert.ErrorIs(t, err, secrets.ErrNotFound)
+
+	parameters, err := ps.(*secrets.AWSParameterStoreSecretsProxy).GetParametersByPath(ctx, "/hl7/prod")
+	printCloudSecretsError(err)
+	assert.Equal(t, map[string]string{"/hl7/prod/db/password": "s3cr3t", "/hl7/prod/api-key": "abc123"}, parameters)
+
+	// parameters read by path are cached for GetSecret
+	calls := fake.calls
+	value, err = ps.GetSecret(ctx, "/hl7/prod/api-key")
+	assert.Equal(t, "abc123", value)
+	assert.Equal(t, calls, fake.calls)
+}
@@ -194,7 +194,7 @@ func TestUploadText(t *testing.T) {
 				"upload_id":      "1234567890",
 				"data_stream_id": "DAART",
 			}
-			err = az.UploadFileFromString(context.Background(), container,
+			_, err = az.UploadFileFromString(context.Background(), container,
 				"testFolder/test-fldr-upload.HL7",
 				metadata, string(content))
 			if err != nil {
@@ -231,7 +231,7 @@ func TestUploadStream(t *testing.T) {
 			"data_stream_id": "DAART",
 		}
 		reader := bufio.NewReader(file)
-		err = az.UploadFileFromInputStream(context.Background(), container, "10gb.txt",
+		_, err = az.UploadFileFromInputStream(context.Background(), container, "10gb.txt",
 			metadata, reader, fileSize, 20)
 		if err != nil {
 			printCloudError(err)
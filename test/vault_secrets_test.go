@@ -0,0 +1,162 @@
+package test
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"lib-cloud-proxy-go/secrets"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVault implements just enough of the Vault HTTP API for the proxy: AppRole and Kubernetes login,
+// token lookup and renewal, and KV v2 reads from the "secret" mount
+type fakeVault struct {
+	mutex    sync.Mutex
+	tokenTTL int
+	logins   int
+	renewals int
+	secrets  map[string]map[string]interface{}
+}
+
+func (fake *fakeVault) auth(token string) map[string]interface{} {
+	return map[string]interface{}{"auth": map[string]interface{}{
+		"client_token":   token,
+		"renewable":      true,
+		"lease_duration": fake.tokenTTL,
+	}}
+}
+
+func (fake *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	var body map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	var response interface{}
+	switch r.URL.Path {
+	case "/v1/auth/approle/login":
+		if body["role_id"] != "role" || body["secret_id"] != "secret-id" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["invalid role or secret ID"]}`))
+			return
+		}
+		fake.logins++
+		response = fake.auth("approle-token")
+	case "/v1/auth/kubernetes/login":
+		if body["role"] != "hl7-pipeline" || body["jwt"] != "service-account-jwt" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		fake.logins++
+		response = fake.auth("kubernetes-token")
+	case "/v1/auth/token/lookup-self":
+		response = map[string]interface{}{"data": map[string]interface{}{"ttl": 0, "renewable": false}}
+	case "/v1/auth/token/renew-self":
+		fake.renewals++
+		response = fake.auth(r.Header.Get("X-Vault-Token"))
+	default:
+		data, ok := fake.secrets[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		response = map[string]interface{}{"data": map[string]interface{}{
+			"data":     data,
+			"metadata": map[string]interface{}{"version": 1},
+		}}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func startFakeVault(t *testing.T, tokenTTL int) (*fakeVault, string) {
+	fake := &fakeVault{
+		tokenTTL: tokenTTL,
+		secrets: map[string]map[string]interface{}{
+			"/v1/secret/data/hl7/db": {"username": "hl7", "password": "s3cr3t"},
+		},
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server.URL
+}
+
+var vaultCacheOptions = &secrets.CloudSecretsCacheOptions{
+	MaxEntries: 10,
+	TTL:        time.Minute * 10,
+}
+
+func TestVaultAppRoleGetSecret(t *testing.T) {
+	fake, address := startFakeVault(t, 3)
+	proxy, err := secrets.CloudSecretsProxyFactory(secrets.ProxyAuthHandlerVaultAppRole{
+		Address:  address,
+		RoleID:   "role",
+		SecretID: "secret-id",
+	}, vaultCacheOptions)
+	printCloudSecretsError(err)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer proxy.(*secrets.VaultCloudSecretsProxy).Close()
+
+	value, err := proxy.GetSecret(context.Background(), "hl7/db")
+	printCloudSecretsError(err)
+	assert.JSONEq(t, `{"username":"hl7","password":"s3cr3t"}`, value)
+	_, err = proxy.GetSecret(context.Background(), "hl7/missing")
+	assert.ErrorIs(t, err, secrets.ErrNotFound)
+
+	// the three second token is renewed in the background
+	assert.Eventually(t, func() bool {
+		fake.mutex.Lock()
+		defer fake.mutex.Unlock()
+		return fake.renewals > 0
+	}, 5*time.Second, 100*time.Millisecond)
+
+	_, err = secrets.CloudSecretsProxyFactory(secrets.ProxyAuthHandlerVaultAppRole{
+		Address:  address,
+		RoleID:   "role",
+		SecretID: "wrong",
+	}, vaultCacheOptions)
+	assert.NotNil(t, err)
+	assert.NotErrorIs(t, err, secrets.ErrNotFound)
+}
+
+func TestVaultKubernetesAndTokenAuth(t *testing.T) {
+	fake, address := startFakeVault(t, 3600)
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(tokenPath, []byte("service-account-jwt"), 0o600))
+	proxy, err := secrets.CloudSecretsProxyFactory(secrets.ProxyAuthHandlerVaultKubernetes{
+		Address:                 address,
+		Role:                    "hl7-pipeline",
+		ServiceAccountTokenPath: tokenPath,
+	}, vaultCacheOptions)
+	printCloudSecretsError(err)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer proxy.(*secrets.VaultCloudSecretsProxy).Close()
+	binary, err := proxy.GetBinarySecret(context.Background(), "hl7/db")
+	printCloudSecretsError(err)
+	assert.JSONEq(t, `{"username":"hl7","password":"s3cr3t"}`, string(binary))
+	assert.Equal(t, 1, fake.logins)
+
+	tokenProxy, err := secrets.CloudSecretsProxyFactory(secrets.ProxyAuthHandlerVaultToken{
+		Address: address,
+		Token:   "root",
+	}, vaultCacheOptions)
+	printCloudSecretsError(err)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer tokenProxy.(*secrets.VaultCloudSecretsProxy).Close()
+	value, err := tokenProxy.GetSecret(context.Background(), "hl7/db")
+	printCloudSecretsError(err)
+	assert.JSONEq(t, `{"username":"hl7","password":"s3cr3t"}`, value)
+}